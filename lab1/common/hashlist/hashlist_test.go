@@ -0,0 +1,121 @@
+package hashlist
+
+import (
+	"strings"
+	"testing"
+)
+
+const testHash = "098f6bcd4621d373cade4e832627b4f6" // md5("test")
+
+var (
+	md5Options  = Options{Algorithm: "md5", HexLength: 32}
+	ntlmOptions = Options{Algorithm: "ntlm", HexLength: 32}
+)
+
+func TestParseLine(t *testing.T) {
+	tests := []struct {
+		name    string
+		line    string
+		opts    Options
+		want    Entry
+		wantErr bool
+	}{
+		{name: "hash", line: testHash, opts: md5Options, want: Entry{Hash: testHash, Format: FormatHash}},
+		{name: "upper case", line: strings.ToUpper(testHash), opts: md5Options, want: Entry{Hash: testHash, Format: FormatHash}},
+		{name: "spaces", line: "  " + testHash + "\t", opts: md5Options, want: Entry{Hash: testHash, Format: FormatHash}},
+		{name: "dynamic_0 tag", line: "$dynamic_0$" + testHash, opts: md5Options, want: Entry{Hash: testHash, Format: FormatHash}},
+		{name: "raw-md5 tag", line: "$RAW-MD5$" + testHash, opts: md5Options, want: Entry{Hash: testHash, Format: FormatHash}},
+		// $dynamic_1$ - md5($p.$s) с солью, а не MD5 пароля
+		{name: "dynamic_1 tag", line: "$dynamic_1$" + testHash, opts: md5Options, wantErr: true},
+		{name: "tag of other algorithm", line: "$NT$" + testHash, opts: md5Options, wantErr: true},
+		{name: "user:hash", line: "alice:" + testHash, opts: md5Options, want: Entry{User: "alice", Hash: testHash, Format: FormatUserHash}},
+		{
+			name: "passwd fields",
+			line: "alice:" + testHash + ":1001:1001:Alice:/home/alice:/bin/sh",
+			opts: md5Options,
+			want: Entry{User: "alice", Hash: testHash, Format: FormatUserHash},
+		},
+		{
+			name: "pwdump",
+			line: "Administrator:500:aad3b435b51404eeaad3b435b51404ee:31D6CFE0D16AE931B73C59D7E0C089C0:::",
+			opts: ntlmOptions,
+			want: Entry{User: "Administrator", Hash: "31d6cfe0d16ae931b73c59d7e0c089c0", Format: FormatPwdump},
+		},
+		{
+			name:    "pwdump for md5 task",
+			line:    "Administrator:500:aad3b435b51404eeaad3b435b51404ee:31d6cfe0d16ae931b73c59d7e0c089c0:::",
+			opts:    md5Options,
+			wantErr: true,
+		},
+		{name: "salt rejected", line: testHash + ":salt", opts: md5Options, wantErr: true},
+		{
+			name: "salt allowed",
+			line: testHash + ":s:a:lt",
+			opts: Options{Algorithm: "md5", HexLength: 32, AllowSalt: true},
+			want: Entry{Hash: testHash, Salt: "s:a:lt", Format: FormatHashSalt},
+		},
+		{name: "empty", line: "   ", opts: md5Options, wantErr: true},
+		{name: "short hash", line: "098f6bcd", opts: md5Options, wantErr: true},
+		{name: "not hex", line: strings.Repeat("z", 32), opts: md5Options, wantErr: true},
+		{name: "user with bad hash", line: "bob:zzz", opts: md5Options, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseLine(tt.line, tt.opts)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ParseLine(%q) = %+v, want error", tt.line, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseLine(%q): %v", tt.line, err)
+			}
+			if got != tt.want {
+				t.Fatalf("ParseLine(%q) = %+v, want %+v", tt.line, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsPwdump(t *testing.T) {
+	tests := []struct {
+		line string
+		want bool
+	}{
+		{"user:500:lm:ntlm:::", true},
+		{"user:0:::::", true},
+		{"user::lm:ntlm:::", false},           // нет uid
+		{"user:5a0:lm:ntlm:::", false},        // uid не число
+		{"user:500:lm:ntlm::", false},         // шесть полей
+		{"user:500:lm:ntlm::::", false},       // восемь полей
+		{"user:500:lm:ntlm:x::", false},       // непустое поле после хеша
+		{"user:500:lm:ntlm:::comment", false}, // непустое последнее поле
+	}
+	for _, tt := range tests {
+		if got := isPwdump(strings.Split(tt.line, ":")); got != tt.want {
+			t.Errorf("isPwdump(%q) = %v, want %v", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestParseSkipsCommentsAndCollectsErrors(t *testing.T) {
+	input := "# список\n" + testHash + "\n\nbob:zzz\nalice:" + strings.ToUpper(testHash) + "\n"
+	entries, rejected, err := Parse(strings.NewReader(input), md5Options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Entry{
+		{Line: 2, Hash: testHash, Format: FormatHash},
+		{Line: 5, User: "alice", Hash: testHash, Format: FormatUserHash},
+	}
+	if len(entries) != len(want) || entries[0] != want[0] || entries[1] != want[1] {
+		t.Fatalf("entries = %+v, want %+v", entries, want)
+	}
+	if len(rejected) != 1 || rejected[0].Line != 4 || rejected[0].Text != "bob:zzz" {
+		t.Fatalf("rejected = %+v, want line 4", rejected)
+	}
+	if hashes := Hashes(entries); len(hashes) != 1 || hashes[0] != testHash {
+		t.Fatalf("Hashes = %v, want [%s]", hashes, testHash)
+	}
+}
@@ -0,0 +1,90 @@
+package hashlist
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// PotEntry - строка potfile: взломанный хеш и его пароль.
+type PotEntry struct {
+	Line  int
+	Hash  string
+	Plain string
+}
+
+// FormatPotLine возвращает строку potfile в формате hashcat "hash:plain".
+// Пароли с непечатаемыми символами (и сами похожие на $HEX[...]) кодируются как $HEX[...], как это делает hashcat.
+func FormatPotLine(hash, plain string) string {
+	return hash + ":" + encodePlain(plain)
+}
+
+// ParsePotLine разбирает строку "hash:plain". Разделителем считается первое двоеточие,
+// поэтому пароль может содержать ':'. Хеш нормализуется так же, как в ParseLine.
+func ParsePotLine(line string, opts Options) (PotEntry, error) {
+	hashPart, plain, ok := strings.Cut(line, ":")
+	if !ok {
+		return PotEntry{}, fmt.Errorf("ожидается строка hash:plain")
+	}
+	hash, err := normalize(hashPart, opts)
+	if err != nil {
+		return PotEntry{}, err
+	}
+	plain, err = decodePlain(plain)
+	if err != nil {
+		return PotEntry{}, err
+	}
+	return PotEntry{Hash: hash, Plain: plain}, nil
+}
+
+// ParsePot читает potfile. Пустые строки пропускаются, ошибочные возвращаются отдельно,
+// ошибка возвращается только при сбое чтения.
+func ParsePot(r io.Reader, opts Options) ([]PotEntry, []LineError, error) {
+	var entries []PotEntry
+	var rejected []LineError
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		// Пробелы в конце могут быть частью пароля, поэтому обрезается только перевод строки Windows
+		text := strings.TrimSuffix(scanner.Text(), "\r")
+		if text == "" {
+			continue
+		}
+		entry, err := ParsePotLine(text, opts)
+		if err != nil {
+			rejected = append(rejected, LineError{Line: line, Text: text, Err: err.Error()})
+			continue
+		}
+		entry.Line = line
+		entries = append(entries, entry)
+	}
+	return entries, rejected, scanner.Err()
+}
+
+// encodePlain кодирует пароль как $HEX[...], если его нельзя записать в строку potfile как есть.
+func encodePlain(plain string) string {
+	if strings.HasPrefix(plain, "$HEX[") {
+		return "$HEX[" + hex.EncodeToString([]byte(plain)) + "]"
+	}
+	for i := 0; i < len(plain); i++ {
+		if plain[i] < 0x20 || plain[i] > 0x7e {
+			return "$HEX[" + hex.EncodeToString([]byte(plain)) + "]"
+		}
+	}
+	return plain
+}
+
+// decodePlain раскодирует пароль вида $HEX[...].
+func decodePlain(plain string) (string, error) {
+	if !strings.HasPrefix(plain, "$HEX[") || !strings.HasSuffix(plain, "]") {
+		return plain, nil
+	}
+	decoded, err := hex.DecodeString(plain[len("$HEX[") : len(plain)-1])
+	if err != nil {
+		return "", fmt.Errorf("некорректный пароль в формате $HEX[...]")
+	}
+	return string(decoded), nil
+}
@@ -0,0 +1,72 @@
+package hashlist
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPotLineRoundTrip(t *testing.T) {
+	tests := []struct {
+		name  string
+		plain string
+		line  string // ожидаемая строка potfile
+	}{
+		{name: "plain", plain: "test", line: testHash + ":test"},
+		{name: "colon", plain: "pa:ss", line: testHash + ":pa:ss"},
+		{name: "spaces", plain: " pass ", line: testHash + ": pass "},
+		{name: "empty", plain: "", line: testHash + ":"},
+		{name: "non-ascii", plain: "пароль", line: testHash + ":$HEX[d0bfd0b0d180d0bed0bbd18c]"},
+		{name: "control character", plain: "a\tb", line: testHash + ":$HEX[610962]"},
+		{name: "hex lookalike", plain: "$HEX[41]", line: testHash + ":$HEX[244845585b34315d]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			line := FormatPotLine(testHash, tt.plain)
+			if line != tt.line {
+				t.Fatalf("FormatPotLine(%q) = %q, want %q", tt.plain, line, tt.line)
+			}
+			entry, err := ParsePotLine(line, md5Options)
+			if err != nil {
+				t.Fatalf("ParsePotLine(%q): %v", line, err)
+			}
+			if entry.Hash != testHash || entry.Plain != tt.plain {
+				t.Fatalf("ParsePotLine(%q) = %+v, want hash %s, plain %q", line, entry, testHash, tt.plain)
+			}
+		})
+	}
+}
+
+func TestParsePotLineErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+	}{
+		{name: "no separator", line: testHash},
+		{name: "bad hash", line: "zzz:test"},
+		{name: "bad hex plain", line: testHash + ":$HEX[zz]"},
+		{name: "tag of other algorithm", line: "$NT$" + testHash + ":test"},
+	}
+	for _, tt := range tests {
+		if entry, err := ParsePotLine(tt.line, md5Options); err == nil {
+			t.Errorf("%s: ParsePotLine(%q) = %+v, want error", tt.name, tt.line, entry)
+		}
+	}
+}
+
+func TestParsePot(t *testing.T) {
+	input := FormatPotLine(testHash, "test") + "\r\n\n" + "zzz:x\n" + FormatPotLine("900150983cd24fb0d6963f7d28e17f72", "ab c ") + "\n"
+	entries, rejected, err := ParsePot(strings.NewReader(input), md5Options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []PotEntry{
+		{Line: 1, Hash: testHash, Plain: "test"},
+		{Line: 4, Hash: "900150983cd24fb0d6963f7d28e17f72", Plain: "ab c "},
+	}
+	if len(entries) != len(want) || entries[0] != want[0] || entries[1] != want[1] {
+		t.Fatalf("entries = %+v, want %+v", entries, want)
+	}
+	if len(rejected) != 1 || rejected[0].Line != 3 {
+		t.Fatalf("rejected = %+v, want line 3", rejected)
+	}
+}
@@ -0,0 +1,101 @@
+package keyspace
+
+import (
+	"math/big"
+	"sort"
+)
+
+// Offset возвращает номер первого кандидата пространства в общей нумерации всех строк алфавита,
+// начиная с длины 1. В этой нумерации диапазоны пространств с разными MinLength и MaxLength
+// сопоставимы, поэтому по ней учитывается уже проверенная часть пространства.
+func (s Space) Offset() *big.Int {
+	offset := new(big.Int)
+	for length := 1; length < s.MinLength; length++ {
+		offset.Add(offset, s.LengthSizeBig(length))
+	}
+	return offset
+}
+
+// Shift возвращает диапазон, сдвинутый на delta.
+func (r Range) Shift(delta *big.Int) Range {
+	return Range{Start: new(big.Int).Add(r.Start, delta), End: new(big.Int).Add(r.End, delta)}
+}
+
+// Merge сортирует диапазоны и объединяет пересекающиеся и соседние. Пустые диапазоны отбрасываются.
+func Merge(ranges []Range) []Range {
+	sorted := make([]Range, 0, len(ranges))
+	for _, r := range ranges {
+		if r.End.Cmp(r.Start) > 0 {
+			sorted = append(sorted, r)
+		}
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Start.Cmp(sorted[j].Start) < 0 })
+
+	var merged []Range
+	for _, r := range sorted {
+		last := len(merged) - 1
+		if last >= 0 && r.Start.Cmp(merged[last].End) <= 0 {
+			if r.End.Cmp(merged[last].End) > 0 {
+				merged[last].End = new(big.Int).Set(r.End)
+			}
+			continue
+		}
+		merged = append(merged, Range{Start: new(big.Int).Set(r.Start), End: new(big.Int).Set(r.End)})
+	}
+	return merged
+}
+
+// Subtract возвращает части диапазона r, не покрытые диапазонами covered, в порядке возрастания.
+func Subtract(r Range, covered []Range) []Range {
+	var rest []Range
+	start := new(big.Int).Set(r.Start)
+	for _, c := range Merge(covered) {
+		if c.End.Cmp(start) <= 0 {
+			continue
+		}
+		if c.Start.Cmp(r.End) >= 0 {
+			break
+		}
+		if c.Start.Cmp(start) > 0 {
+			rest = append(rest, Range{Start: start, End: new(big.Int).Set(c.Start)})
+		}
+		start = new(big.Int).Set(c.End)
+	}
+	if start.Cmp(r.End) < 0 {
+		rest = append(rest, Range{Start: start, End: new(big.Int).Set(r.End)})
+	}
+	return rest
+}
+
+// PartitionRanges делит несколько непересекающихся диапазонов на части не более чем по maxPerPart кандидатов.
+// Части не переходят через границы диапазонов; maxParts распределяется пропорционально размерам диапазонов,
+// но каждому достаётся хотя бы одна часть, поэтому частей может быть больше maxParts на число диапазонов.
+// Для нулевого maxPerPart или неположительного maxParts возвращает nil.
+func PartitionRanges(ranges []Range, maxPerPart uint64, maxParts int) []Range {
+	if maxPerPart == 0 || maxParts <= 0 {
+		return nil
+	}
+	total := new(big.Int)
+	for _, r := range ranges {
+		total.Add(total, r.Len())
+	}
+	if total.Sign() <= 0 {
+		return nil
+	}
+	var parts []Range
+	for _, r := range ranges {
+		if r.Len().Sign() <= 0 {
+			continue
+		}
+		share := new(big.Int).Mul(r.Len(), big.NewInt(int64(maxParts)))
+		share.Quo(share, total)
+		rangeParts := 1
+		if share.IsInt64() && share.Int64() > 1 {
+			rangeParts = int(share.Int64())
+		}
+		for _, part := range Partition(r.Len(), maxPerPart, rangeParts) {
+			parts = append(parts, part.Shift(r.Start))
+		}
+	}
+	return parts
+}
@@ -0,0 +1,138 @@
+package keyspace
+
+import (
+	"strings"
+	"testing"
+)
+
+// format записывает диапазоны одной строкой для сравнения в тестах.
+func format(ranges []Range) string {
+	parts := make([]string, len(ranges))
+	for i, r := range ranges {
+		parts[i] = r.String()
+	}
+	return strings.Join(parts, " ")
+}
+
+func TestMerge(t *testing.T) {
+	tests := []struct {
+		name   string
+		ranges []Range
+		want   string
+	}{
+		{name: "none", ranges: nil, want: ""},
+		{name: "only empty", ranges: []Range{rng(5, 5)}, want: ""},
+		{name: "disjoint unsorted", ranges: []Range{rng(10, 20), rng(0, 5)}, want: "[0, 5) [10, 20)"},
+		{name: "overlapping", ranges: []Range{rng(0, 10), rng(5, 15)}, want: "[0, 15)"},
+		{name: "adjacent", ranges: []Range{rng(5, 10), rng(0, 5)}, want: "[0, 10)"},
+		{name: "nested", ranges: []Range{rng(0, 20), rng(5, 10)}, want: "[0, 20)"},
+		{name: "chain", ranges: []Range{rng(20, 30), rng(0, 10), rng(10, 20), rng(40, 50), rng(25, 35)}, want: "[0, 35) [40, 50)"},
+		{name: "empty between", ranges: []Range{rng(0, 5), rng(7, 7), rng(10, 15)}, want: "[0, 5) [10, 15)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := format(Merge(tt.ranges)); got != tt.want {
+				t.Fatalf("Merge = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMergeDoesNotAliasInput(t *testing.T) {
+	input := []Range{rng(0, 10), rng(5, 15)}
+	merged := Merge(input)
+	merged[0].End.SetInt64(100)
+	if input[0].End.Int64() != 10 || input[1].End.Int64() != 15 {
+		t.Fatalf("Merge result shares big.Int values with the input: %s", format(input))
+	}
+}
+
+func TestSubtract(t *testing.T) {
+	tests := []struct {
+		name    string
+		r       Range
+		covered []Range
+		want    string
+	}{
+		{name: "nothing covered", r: rng(0, 100), covered: nil, want: "[0, 100)"},
+		{name: "fully covered", r: rng(10, 20), covered: []Range{rng(0, 100)}, want: ""},
+		{name: "exactly covered", r: rng(10, 20), covered: []Range{rng(10, 20)}, want: ""},
+		{name: "covered by adjacent", r: rng(0, 20), covered: []Range{rng(10, 20), rng(0, 10)}, want: ""},
+		{name: "empty range", r: rng(5, 5), covered: nil, want: ""},
+		{name: "covered outside", r: rng(10, 20), covered: []Range{rng(0, 10), rng(20, 30)}, want: "[10, 20)"},
+		{name: "head covered", r: rng(0, 100), covered: []Range{rng(0, 30)}, want: "[30, 100)"},
+		{name: "tail covered", r: rng(0, 100), covered: []Range{rng(70, 200)}, want: "[0, 70)"},
+		{name: "holes", r: rng(0, 100), covered: []Range{rng(50, 60), rng(10, 20), rng(15, 30)}, want: "[0, 10) [30, 50) [60, 100)"},
+		{name: "empty covered", r: rng(0, 10), covered: []Range{rng(5, 5)}, want: "[0, 10)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := format(Subtract(tt.r, tt.covered)); got != tt.want {
+				t.Fatalf("Subtract(%s, %s) = %q, want %q", tt.r, format(tt.covered), got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPartitionRanges(t *testing.T) {
+	tests := []struct {
+		name       string
+		ranges     []Range
+		maxPerPart uint64
+		maxParts   int
+		wantParts  []int // количество частей каждого непустого диапазона
+	}{
+		{name: "none", ranges: nil, maxPerPart: 10, maxParts: 10, wantParts: nil},
+		{name: "only empty", ranges: []Range{rng(3, 3)}, maxPerPart: 10, maxParts: 10, wantParts: nil},
+		{name: "single", ranges: []Range{rng(100, 131)}, maxPerPart: 10, maxParts: 10, wantParts: []int{4}},
+		{name: "two within limit", ranges: []Range{rng(0, 20), rng(50, 75)}, maxPerPart: 10, maxParts: 100, wantParts: []int{2, 3}},
+		{name: "proportional", ranges: []Range{rng(0, 300), rng(1000, 1100)}, maxPerPart: 1, maxParts: 8, wantParts: []int{6, 2}},
+		// Маленькому диапазону достаётся хотя бы одна часть, даже сверх maxParts
+		{name: "tiny range", ranges: []Range{rng(0, 1000), rng(2000, 2001)}, maxPerPart: 1, maxParts: 1, wantParts: []int{1, 1}},
+		{name: "skips empty", ranges: []Range{rng(0, 10), rng(20, 20), rng(30, 40)}, maxPerPart: 5, maxParts: 100, wantParts: []int{2, 2}},
+	}
+	for _, bad := range []struct {
+		maxPerPart uint64
+		maxParts   int
+	}{{0, 10}, {10, 0}, {10, -1}} {
+		if parts := PartitionRanges([]Range{rng(0, 100)}, bad.maxPerPart, bad.maxParts); parts != nil {
+			t.Fatalf("PartitionRanges(maxPerPart=%d, maxParts=%d) = %s, want nil", bad.maxPerPart, bad.maxParts, format(parts))
+		}
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parts := PartitionRanges(tt.ranges, tt.maxPerPart, tt.maxParts)
+			rest := parts
+			i := 0
+			for _, r := range tt.ranges {
+				if r.Len().Sign() <= 0 {
+					continue
+				}
+				if i >= len(tt.wantParts) || len(rest) < tt.wantParts[i] {
+					t.Fatalf("PartitionRanges = %s, want %v parts per range", format(parts), tt.wantParts)
+				}
+				// Части диапазона не выходят за его границы и покрывают его целиком
+				checkPartition(t, rest[:tt.wantParts[i]], r.Start, r.Len())
+				rest = rest[tt.wantParts[i]:]
+				i++
+			}
+			if len(rest) != 0 || i != len(tt.wantParts) {
+				t.Fatalf("PartitionRanges = %s, want %v parts per range", format(parts), tt.wantParts)
+			}
+		})
+	}
+}
+
+func TestOffsetShiftComparesSpaces(t *testing.T) {
+	// Кандидаты длины 2 имеют одинаковые номера в общей нумерации, какой бы ни была MinLength пространства
+	short := Space{Alphabet: "ab", MinLength: 1, MaxLength: 2}
+	long := Space{Alphabet: "ab", MinLength: 2, MaxLength: 3}
+	shortRange := rng(2, 6).Shift(short.Offset())
+	longRange := rng(0, 4).Shift(long.Offset())
+	if shortRange.String() != longRange.String() {
+		t.Fatalf("length 2 ranges = %s and %s, want equal", shortRange, longRange)
+	}
+	if got := format(Subtract(rng(0, 12).Shift(long.Offset()), []Range{shortRange})); got != "[6, 14)" {
+		t.Fatalf("Subtract = %q, want %q", got, "[6, 14)")
+	}
+}
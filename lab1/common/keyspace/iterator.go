@@ -0,0 +1,68 @@
+package keyspace
+
+import "math/big"
+
+// Iterator перебирает кандидатов подряд, не вычисляя каждого заново по номеру:
+// разряды увеличиваются как в одометре, и в буфере меняются только изменившиеся символы.
+type Iterator struct {
+	positions []string // набор символов для каждой позиции
+	digits    []int    // текущий разряд (номер символа в наборе) для каждой позиции
+	buf       []byte   // текущий кандидат
+
+	// extend возвращает наборы позиций для кандидатов длины length
+	// после переполнения текущей длины или nil, если пространство закончилось.
+	extend func(length int) []string
+}
+
+// NewIterator создаёт итератор, установленный на кандидата с номером index
+// в смешанной системе счисления positions (младший разряд - последняя позиция).
+func NewIterator(positions []string, index *big.Int, extend func(length int) []string) *Iterator {
+	it := &Iterator{extend: extend}
+	it.reset(positions)
+	rest := new(big.Int).Set(index)
+	digit := new(big.Int)
+	for i := len(positions) - 1; i >= 0; i-- {
+		rest.DivMod(rest, big.NewInt(int64(len(positions[i]))), digit)
+		it.digits[i] = int(digit.Int64())
+		it.buf[i] = positions[i][it.digits[i]]
+	}
+	return it
+}
+
+// reset устанавливает итератор на первого кандидата с наборами позиций positions.
+func (it *Iterator) reset(positions []string) {
+	it.positions = positions
+	it.digits = make([]int, len(positions))
+	it.buf = make([]byte, len(positions))
+	for i, charset := range positions {
+		it.buf[i] = charset[0]
+	}
+}
+
+// Candidate возвращает текущего кандидата. Буфер переиспользуется и меняется при вызове Next.
+func (it *Iterator) Candidate() []byte {
+	return it.buf
+}
+
+// Next переходит к следующему кандидату. Возвращает false, если пространство закончилось.
+func (it *Iterator) Next() bool {
+	for i := len(it.digits) - 1; i >= 0; i-- {
+		charset := it.positions[i]
+		it.digits[i]++
+		if it.digits[i] < len(charset) {
+			it.buf[i] = charset[it.digits[i]]
+			return true
+		}
+		it.digits[i] = 0
+		it.buf[i] = charset[0]
+	}
+	if it.extend == nil {
+		return false
+	}
+	positions := it.extend(len(it.positions) + 1)
+	if positions == nil {
+		return false
+	}
+	it.reset(positions)
+	return true
+}
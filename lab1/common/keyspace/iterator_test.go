@@ -0,0 +1,77 @@
+package keyspace
+
+import (
+	"math/big"
+	"testing"
+)
+
+// TestIteratorMatchesDecode проверяет, что итератор, установленный на любой номер, перебирает тех же кандидатов,
+// что и вычисление каждого кандидата по номеру, в том числе при переходе к следующей длине.
+func TestIteratorMatchesDecode(t *testing.T) {
+	space := Space{Alphabet: "abc", MinLength: 1, MaxLength: 4}
+	size, _ := space.Size()
+	for start := uint64(0); start < size; start++ {
+		it := space.Seek(new(big.Int).SetUint64(start))
+		for index := start; index < size; index++ {
+			if want := string(space.Candidate(index, nil)); string(it.Candidate()) != want {
+				t.Fatalf("Seek(%d): candidate %d = %q, want %q", start, index, it.Candidate(), want)
+			}
+			if next := it.Next(); next != (index+1 < size) {
+				t.Fatalf("Seek(%d): Next after %d = %v", start, index, next)
+			}
+		}
+	}
+}
+
+func TestIteratorMixedRadix(t *testing.T) {
+	it := NewIterator([]string{"ab", "xyz"}, big.NewInt(2), nil)
+	var got []string
+	for {
+		got = append(got, string(it.Candidate()))
+		if !it.Next() {
+			break
+		}
+	}
+	want := []string{"az", "bx", "by", "bz"}
+	if len(got) != len(want) {
+		t.Fatalf("candidates = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("candidates = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestWalk(t *testing.T) {
+	tests := []struct {
+		name  string
+		r     Range
+		limit int // сколько кандидатов принять до остановки; 0 - все
+		want  []string
+	}{
+		{name: "empty", r: rng(3, 3), want: nil},
+		{name: "single", r: rng(0, 1), want: []string{"a"}},
+		{name: "across lengths", r: rng(1, 7), want: []string{"b", "aa", "ab", "ba", "bb", "aaa"}},
+		{name: "end of space", r: rng(12, 14), want: []string{"bba", "bbb"}},
+		{name: "whole space", r: rng(0, 14), want: []string{"a", "b", "aa", "ab", "ba", "bb", "aaa", "aab", "aba", "abb", "baa", "bab", "bba", "bbb"}},
+		{name: "stopped", r: rng(0, 14), limit: 3, want: []string{"a", "b", "aa"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			Walk(abSpace, tt.r, func(candidate []byte) bool {
+				got = append(got, string(candidate))
+				return tt.limit == 0 || len(got) < tt.limit
+			})
+			if len(got) != len(tt.want) {
+				t.Fatalf("Walk(%s) = %v, want %v", tt.r, got, tt.want)
+			}
+			for i := range tt.want {
+				if got[i] != tt.want[i] {
+					t.Fatalf("Walk(%s) = %v, want %v", tt.r, got, tt.want)
+				}
+			}
+		})
+	}
+}
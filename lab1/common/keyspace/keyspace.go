@@ -0,0 +1,138 @@
+package keyspace
+
+import (
+	"math/big"
+	"math/bits"
+)
+
+// DefaultAlphabet - алфавит перебора по умолчанию [a-z0-9]
+const DefaultAlphabet = "abcdefghijklmnopqrstuvwxyz0123456789"
+
+// Enumerable - пронумерованное пространство кандидатов (перебор по алфавиту, маска).
+type Enumerable interface {
+	// SizeBig возвращает количество кандидатов в пространстве.
+	SizeBig() *big.Int
+	// Seek возвращает итератор, установленный на кандидата с номером index (index < SizeBig()).
+	Seek(index *big.Int) *Iterator
+}
+
+// Space - пространство перебора по алфавиту: все строки длины от MinLength до MaxLength.
+// Глобальный номер кандидата - это конкатенация пространств всех длин по возрастанию:
+// сначала идут все кандидаты длины MinLength, затем MinLength+1 и т.д.
+type Space struct {
+	Alphabet  string
+	MinLength int
+	MaxLength int
+}
+
+// LengthSize возвращает количество кандидатов заданной длины.
+// Второе значение равно false, если количество не помещается в uint64.
+func (s Space) LengthSize(length int) (uint64, bool) {
+	total := uint64(1)
+	for i := 0; i < length; i++ {
+		hi, lo := bits.Mul64(total, uint64(len(s.Alphabet)))
+		if hi != 0 {
+			return 0, false
+		}
+		total = lo
+	}
+	return total, true
+}
+
+// Size возвращает общее количество кандидатов всех длин.
+// Второе значение равно false, если количество не помещается в uint64.
+func (s Space) Size() (uint64, bool) {
+	var total uint64
+	for length := s.MinLength; length <= s.MaxLength; length++ {
+		size, ok := s.LengthSize(length)
+		if !ok {
+			return 0, false
+		}
+		sum, carry := bits.Add64(total, size, 0)
+		if carry != 0 {
+			return 0, false
+		}
+		total = sum
+	}
+	return total, true
+}
+
+// Locate переводит глобальный номер кандидата в пару (длина, номер среди кандидатов этой длины).
+// Для номера за пределами пространства возвращается длина 0.
+func (s Space) Locate(index uint64) (int, uint64) {
+	for length := s.MinLength; length <= s.MaxLength; length++ {
+		size, ok := s.LengthSize(length)
+		if !ok || index < size {
+			return length, index
+		}
+		index -= size
+	}
+	return 0, 0
+}
+
+// CandidateAt записывает в buf кандидата длины length с номером offset
+// (число в системе счисления с основанием len(Alphabet), младший разряд - последний символ).
+func (s Space) CandidateAt(length int, offset uint64, buf []byte) []byte {
+	buf = append(buf[:0], make([]byte, length)...)
+	base := uint64(len(s.Alphabet))
+	for i := length - 1; i >= 0; i-- {
+		buf[i] = s.Alphabet[offset%base]
+		offset /= base
+	}
+	return buf
+}
+
+// LengthSizeBig возвращает количество кандидатов заданной длины без ограничения разрядности.
+func (s Space) LengthSizeBig(length int) *big.Int {
+	base := big.NewInt(int64(len(s.Alphabet)))
+	return new(big.Int).Exp(base, big.NewInt(int64(length)), nil)
+}
+
+// SizeBig возвращает общее количество кандидатов всех длин без ограничения разрядности.
+func (s Space) SizeBig() *big.Int {
+	total := new(big.Int)
+	for length := s.MinLength; length <= s.MaxLength; length++ {
+		total.Add(total, s.LengthSizeBig(length))
+	}
+	return total
+}
+
+// LocateBig - версия Locate для номеров, не помещающихся в uint64.
+func (s Space) LocateBig(index *big.Int) (int, *big.Int) {
+	offset := new(big.Int).Set(index)
+	for length := s.MinLength; length <= s.MaxLength; length++ {
+		size := s.LengthSizeBig(length)
+		if offset.Cmp(size) < 0 {
+			return length, offset
+		}
+		offset.Sub(offset, size)
+	}
+	return 0, offset
+}
+
+// Candidate записывает в buf кандидата с глобальным номером index.
+func (s Space) Candidate(index uint64, buf []byte) []byte {
+	length, offset := s.Locate(index)
+	return s.CandidateAt(length, offset, buf)
+}
+
+// Seek возвращает итератор, установленный на кандидата с глобальным номером index.
+// После последнего кандидата длины L итератор переходит к первому кандидату длины L+1.
+func (s Space) Seek(index *big.Int) *Iterator {
+	length, offset := s.LocateBig(index)
+	return NewIterator(s.positions(length), offset, func(length int) []string {
+		if length > s.MaxLength {
+			return nil
+		}
+		return s.positions(length)
+	})
+}
+
+// positions возвращает наборы символов позиций кандидата длины length (везде - алфавит).
+func (s Space) positions(length int) []string {
+	positions := make([]string, length)
+	for i := range positions {
+		positions[i] = s.Alphabet
+	}
+	return positions
+}
@@ -0,0 +1,120 @@
+package keyspace
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+)
+
+// Range - полуинтервал [Start, End) глобальных номеров кандидатов, назначенный одной подзадаче.
+// Границы хранятся как big.Int, чтобы пространство могло превышать uint64.
+type Range struct {
+	Start *big.Int
+	End   *big.Int
+}
+
+// Partition делит пространство из total кандидатов на непрерывные диапазоны.
+// Количество диапазонов выбирается так, чтобы в каждом было не более maxPerPart кандидатов,
+// но не больше maxParts (тогда диапазоны увеличиваются). Размеры диапазонов отличаются не более чем на 1.
+// Для пустого пространства, нулевого maxPerPart или неположительного maxParts возвращает nil.
+func Partition(total *big.Int, maxPerPart uint64, maxParts int) []Range {
+	if total.Sign() <= 0 || maxPerPart == 0 || maxParts <= 0 {
+		return nil
+	}
+	perPart := new(big.Int).SetUint64(maxPerPart)
+	parts := new(big.Int).Add(total, perPart)
+	parts.Sub(parts, big.NewInt(1))
+	parts.Quo(parts, perPart)
+	if parts.Cmp(big.NewInt(int64(maxParts))) > 0 {
+		parts.SetInt64(int64(maxParts))
+	}
+	count := int(parts.Int64())
+
+	size, remainder := new(big.Int).QuoRem(total, parts, new(big.Int))
+	extra := int(remainder.Int64())
+
+	ranges := make([]Range, count)
+	start := new(big.Int)
+	for i := 0; i < count; i++ {
+		end := new(big.Int).Add(start, size)
+		if i < extra {
+			end.Add(end, big.NewInt(1))
+		}
+		ranges[i] = Range{Start: start, End: end}
+		start = end
+	}
+	return ranges
+}
+
+// ParseRange разбирает диапазон из десятичных строк (так границы передаются в сообщениях и хранятся в БД).
+func ParseRange(start, end string) (Range, error) {
+	s, ok := new(big.Int).SetString(start, 10)
+	if !ok {
+		return Range{}, fmt.Errorf("некорректная начальная граница диапазона %q", start)
+	}
+	e, ok := new(big.Int).SetString(end, 10)
+	if !ok {
+		return Range{}, fmt.Errorf("некорректная конечная граница диапазона %q", end)
+	}
+	if s.Sign() < 0 || e.Cmp(s) < 0 {
+		return Range{}, fmt.Errorf("некорректный диапазон [%s, %s)", start, end)
+	}
+	return Range{Start: s, End: e}, nil
+}
+
+// CheckBounds проверяет, что диапазон r не выходит за пределы пространства space: итератор, установленный
+// за последним кандидатом, начал бы перебор не с тех кандидатов.
+func CheckBounds(space Enumerable, r Range) error {
+	if size := space.SizeBig(); r.End.Cmp(size) > 0 {
+		return fmt.Errorf("диапазон %s выходит за пределы пространства из %s кандидатов", r, size)
+	}
+	return nil
+}
+
+// Len возвращает количество кандидатов в диапазоне.
+func (r Range) Len() *big.Int {
+	return new(big.Int).Sub(r.End, r.Start)
+}
+
+// Split делит диапазон на n непрерывных частей, размеры которых отличаются не более чем на 1
+// (частей меньше, если в диапазоне меньше n кандидатов).
+func (r Range) Split(n int) []Range {
+	parts := Partition(r.Len(), 1, n)
+	for i, part := range parts {
+		parts[i] = Range{
+			Start: new(big.Int).Add(r.Start, part.Start),
+			End:   new(big.Int).Add(r.Start, part.End),
+		}
+	}
+	return parts
+}
+
+// String возвращает диапазон в виде "[start, end)".
+func (r Range) String() string {
+	return fmt.Sprintf("[%s, %s)", r.Start, r.End)
+}
+
+// Walk перебирает кандидатов диапазона r в пространстве space и вызывает fn для каждого.
+// Перебор прекращается, если fn возвращает false. Номер переводится в кандидата только один раз
+// для начала диапазона, дальше кандидаты получаются инкрементом итератора.
+// Буфер кандидата переиспользуется: fn не должна сохранять его после возврата.
+func Walk(space Enumerable, r Range, fn func(candidate []byte) bool) {
+	remaining := r.Len()
+	if remaining.Sign() <= 0 {
+		return
+	}
+	it := space.Seek(r.Start)
+	for remaining.Sign() > 0 {
+		n := uint64(math.MaxUint64)
+		if remaining.IsUint64() {
+			n = remaining.Uint64()
+		}
+		remaining.Sub(remaining, new(big.Int).SetUint64(n))
+		for ; n > 0; n-- {
+			// Next возвращает false только после последнего кандидата пространства
+			if !fn(it.Candidate()) || !it.Next() {
+				return
+			}
+		}
+	}
+}
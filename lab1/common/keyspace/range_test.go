@@ -0,0 +1,145 @@
+package keyspace
+
+import (
+	"math/big"
+	"testing"
+)
+
+func rng(start, end int64) Range {
+	return Range{Start: big.NewInt(start), End: big.NewInt(end)}
+}
+
+// checkPartition проверяет, что parts подряд покрывают [start, start+total) и размеры частей отличаются не более чем на 1.
+func checkPartition(t *testing.T, parts []Range, start, total *big.Int) {
+	t.Helper()
+	next := new(big.Int).Set(start)
+	var min, max *big.Int
+	for _, part := range parts {
+		if part.Start.Cmp(next) != 0 {
+			t.Fatalf("part %s does not start at %s", part, next)
+		}
+		size := part.Len()
+		if size.Sign() <= 0 {
+			t.Fatalf("empty part %s", part)
+		}
+		if min == nil || size.Cmp(min) < 0 {
+			min = size
+		}
+		if max == nil || size.Cmp(max) > 0 {
+			max = size
+		}
+		next = part.End
+	}
+	if end := new(big.Int).Add(start, total); next.Cmp(end) != 0 {
+		t.Fatalf("parts end at %s, want %s", next, end)
+	}
+	if min != nil && new(big.Int).Sub(max, min).Cmp(big.NewInt(1)) > 0 {
+		t.Fatalf("part sizes differ by more than 1: %s..%s", min, max)
+	}
+}
+
+func TestPartition(t *testing.T) {
+	huge, _ := new(big.Int).SetString("100000000000000000000000", 10) // больше uint64
+	tests := []struct {
+		name       string
+		total      *big.Int
+		maxPerPart uint64
+		maxParts   int
+		wantParts  int
+	}{
+		{name: "empty", total: big.NewInt(0), maxPerPart: 10, maxParts: 5, wantParts: 0},
+		{name: "single candidate", total: big.NewInt(1), maxPerPart: 10, maxParts: 5, wantParts: 1},
+		{name: "exact", total: big.NewInt(30), maxPerPart: 10, maxParts: 5, wantParts: 3},
+		{name: "last partial", total: big.NewInt(31), maxPerPart: 10, maxParts: 5, wantParts: 4},
+		{name: "one less", total: big.NewInt(29), maxPerPart: 10, maxParts: 5, wantParts: 3},
+		{name: "parts capped", total: big.NewInt(100), maxPerPart: 1, maxParts: 7, wantParts: 7},
+		{name: "huge", total: huge, maxPerPart: 15_000_000, maxParts: 10_000, wantParts: 10_000},
+		{name: "zero per part", total: big.NewInt(10), maxPerPart: 0, maxParts: 5, wantParts: 0},
+		{name: "zero parts", total: big.NewInt(10), maxPerPart: 3, maxParts: 0, wantParts: 0},
+		{name: "negative parts", total: big.NewInt(10), maxPerPart: 3, maxParts: -1, wantParts: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parts := Partition(tt.total, tt.maxPerPart, tt.maxParts)
+			if len(parts) != tt.wantParts {
+				t.Fatalf("Partition(%s, %d, %d) = %d parts, want %d", tt.total, tt.maxPerPart, tt.maxParts, len(parts), tt.wantParts)
+			}
+			if tt.wantParts == 0 {
+				return
+			}
+			checkPartition(t, parts, new(big.Int), tt.total)
+			if len(parts) < tt.maxParts {
+				for _, part := range parts {
+					if part.Len().Cmp(new(big.Int).SetUint64(tt.maxPerPart)) > 0 {
+						t.Fatalf("part %s is larger than %d", part, tt.maxPerPart)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestSplit(t *testing.T) {
+	tests := []struct {
+		r         Range
+		n         int
+		wantParts int
+	}{
+		{rng(10, 20), 3, 3},
+		{rng(5, 8), 10, 3}, // кандидатов меньше, чем частей
+		{rng(7, 7), 4, 0},
+		{rng(0, 1), 1, 1},
+	}
+	for _, tt := range tests {
+		parts := tt.r.Split(tt.n)
+		if len(parts) != tt.wantParts {
+			t.Fatalf("%s.Split(%d) = %v, want %d parts", tt.r, tt.n, parts, tt.wantParts)
+		}
+		checkPartition(t, parts, tt.r.Start, tt.r.Len())
+	}
+}
+
+func TestParseRange(t *testing.T) {
+	tests := []struct {
+		start, end string
+		wantErr    bool
+	}{
+		{"0", "10", false},
+		{"5", "5", false}, // пустой диапазон допустим
+		{"0", "100000000000000000000000", false},
+		{"", "10", true},
+		{"x", "10", true},
+		{"0", "1e3", true},
+		{"-1", "10", true},
+		{"10", "5", true},
+	}
+	for _, tt := range tests {
+		r, err := ParseRange(tt.start, tt.end)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseRange(%q, %q) error = %v, wantErr %v", tt.start, tt.end, err, tt.wantErr)
+			continue
+		}
+		if err == nil && (r.Start.String() != tt.start || r.End.String() != tt.end) {
+			t.Errorf("ParseRange(%q, %q) = %s", tt.start, tt.end, r)
+		}
+	}
+}
+
+func TestCheckBounds(t *testing.T) {
+	tests := []struct {
+		r       Range
+		wantErr bool
+	}{
+		{rng(0, 14), false},
+		{rng(13, 14), false},
+		{rng(14, 14), false},
+		{rng(0, 15), true},
+		{rng(14, 15), true},
+		{rng(20, 30), true},
+	}
+	for _, tt := range tests {
+		if err := CheckBounds(abSpace, tt.r); (err != nil) != tt.wantErr {
+			t.Errorf("CheckBounds(%s) error = %v, wantErr %v", tt.r, err, tt.wantErr)
+		}
+	}
+}
@@ -3,65 +3,117 @@ package balancer
 import (
 	"log"
 	"sync"
+	"time"
 )
 
 type WorkerInfo struct {
 	URL         string
 	MaxWorkers  int
 	ActiveTasks int
+	LastSeen    time.Time // время регистрации или последнего heartbeat
 }
 
 type RoundRobin struct {
-	workers     []*WorkerInfo
-	mu          sync.Mutex
-	workerReady chan struct{} // Канал для сигнализации о доступных слотах
+	workers []*WorkerInfo
+	mu      sync.Mutex
+	// slotFree будит GetNextWorker, когда освобождается слот или регистрируется воркер.
+	// Свободные слоты не хранятся отдельно, а считаются по ActiveTasks и MaxWorkers зарегистрированных воркеров,
+	// поэтому слоты исключённого воркера исчезают вместе с ним
+	slotFree *sync.Cond
 }
 
 var LoadBalancer *RoundRobin
 
 func Init() {
 	LoadBalancer = &RoundRobin{
-		workers:     make([]*WorkerInfo, 0),
-		workerReady: make(chan struct{}, 100),
+		workers: make([]*WorkerInfo, 0),
 	}
+	LoadBalancer.slotFree = sync.NewCond(&LoadBalancer.mu)
 }
 
 func (rb *RoundRobin) RegisterWorker(url string, maxWorkers int) {
 	rb.mu.Lock()
 	defer rb.mu.Unlock()
 
+	// Повторная регистрация (воркер перезапустился быстрее, чем его сочли мёртвым) не добавляет слотов:
+	// части, потерянные при перезапуске, вернутся в очередь по истечении аренды и освободят свои слоты
+	for _, worker := range rb.workers {
+		if worker.URL == url {
+			log.Printf("Worker %s registered again", url)
+			worker.LastSeen = time.Now()
+			return
+		}
+	}
+
 	log.Printf("Registering new worker: %s with max tasks: %d", url, maxWorkers)
 	rb.workers = append(rb.workers, &WorkerInfo{
 		URL:         url,
 		MaxWorkers:  maxWorkers,
 		ActiveTasks: 0,
+		LastSeen:    time.Now(),
 	})
 	log.Printf("Total registered workers: %d", len(rb.workers))
 
-	// Изначально все слоты считаются свободными
-	for i := 0; i < maxWorkers; i++ {
-		rb.workerReady <- struct{}{}
-	}
+	// Изначально все слоты нового воркера свободны
+	rb.slotFree.Broadcast()
 }
 
-func (rb *RoundRobin) GetNextWorker() *WorkerInfo {
-	<-rb.workerReady // Ждём появления свободного слота
+// Heartbeat отмечает, что воркер жив. Возвращает false, если воркер не зарегистрирован (или уже исключён)
+func (rb *RoundRobin) Heartbeat(url string) bool {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+
+	for _, worker := range rb.workers {
+		if worker.URL == url {
+			worker.LastSeen = time.Now()
+			return true
+		}
+	}
+	return false
+}
 
+// EvictStale исключает воркеры, от которых дольше timeout не было heartbeat, и возвращает их адреса.
+// Слоты исключённого воркера больше не учитываются: GetNextWorker выбирает только среди оставшихся
+func (rb *RoundRobin) EvictStale(timeout time.Duration) []string {
 	rb.mu.Lock()
 	defer rb.mu.Unlock()
 
-	var selectedWorker *WorkerInfo
+	var evicted []string
+	alive := rb.workers[:0]
 	for _, worker := range rb.workers {
-		if worker.ActiveTasks < worker.MaxWorkers &&
-			(selectedWorker == nil || worker.ActiveTasks < selectedWorker.ActiveTasks) {
-			selectedWorker = worker
+		if time.Since(worker.LastSeen) > timeout {
+			log.Printf("Worker %s missed heartbeats for %s, evicting it", worker.URL, timeout)
+			evicted = append(evicted, worker.URL)
+			continue
 		}
+		alive = append(alive, worker)
+	}
+	rb.workers = alive
+	if len(evicted) > 0 {
+		log.Printf("Total registered workers: %d", len(rb.workers))
 	}
+	return evicted
+}
 
-	if selectedWorker != nil {
-		selectedWorker.ActiveTasks++
+// GetNextWorker ждёт свободного слота и занимает его у наименее загруженного воркера.
+func (rb *RoundRobin) GetNextWorker() *WorkerInfo {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+
+	for {
+		var selectedWorker *WorkerInfo
+		for _, worker := range rb.workers {
+			if worker.ActiveTasks < worker.MaxWorkers &&
+				(selectedWorker == nil || worker.ActiveTasks < selectedWorker.ActiveTasks) {
+				selectedWorker = worker
+			}
+		}
+		if selectedWorker != nil {
+			selectedWorker.ActiveTasks++
+			return selectedWorker
+		}
+		rb.slotFree.Wait() // Ждём появления свободного слота
 	}
-	return selectedWorker
 }
 
 func (rb *RoundRobin) TaskCompleted(workerURL string) {
@@ -72,7 +124,7 @@ func (rb *RoundRobin) TaskCompleted(workerURL string) {
 		if worker.URL == workerURL {
 			if worker.ActiveTasks > 0 {
 				worker.ActiveTasks--
-				rb.workerReady <- struct{}{} // Сигнал о освобождении слота
+				rb.slotFree.Signal() // Сигнал об освобождении слота
 			}
 			break
 		}
@@ -11,23 +11,42 @@ import (
 
 	"common/utils"
 	"manager/balancer"
+	"manager/store"
 )
 
+const (
+	// workerTimeout - через сколько без heartbeat воркер считается мёртвым
+	workerTimeout = 15 * time.Second
+	// leaseTimeout - срок аренды части: heartbeat воркера, который её перебирает, продлевает аренду,
+	// а по истечении часть возвращается в очередь
+	leaseTimeout = 15 * time.Second
+	// monitorInterval - период проверки воркеров и аренд
+	monitorInterval = 5 * time.Second
+)
+
+// lease - часть задачи, отправленная воркеру
+type lease struct {
+	workerURL string
+	task      models.CrackTaskRequest
+	expires   time.Time
+}
+
 type TaskDispatcher struct {
-	taskQueue    *queue.TaskQueue
-	partToWorker map[string]map[int]string // hash -> partNumber -> workerURL
-	mu           sync.RWMutex
+	taskQueue *queue.TaskQueue
+	leases    map[string]map[int]*lease // task key -> partNumber -> аренда части
+	mu        sync.RWMutex
 }
 
 func NewTaskDispatcher(taskQueue *queue.TaskQueue) *TaskDispatcher {
 	return &TaskDispatcher{
-		taskQueue:    taskQueue,
-		partToWorker: make(map[string]map[int]string),
+		taskQueue: taskQueue,
+		leases:    make(map[string]map[int]*lease),
 	}
 }
 
 func (d *TaskDispatcher) Start() {
 	go d.dispatchTasks()
+	go d.monitor()
 }
 
 func (d *TaskDispatcher) dispatchTasks() {
@@ -35,24 +54,27 @@ func (d *TaskDispatcher) dispatchTasks() {
 		task := d.taskQueue.Pop()
 		worker := balancer.LoadBalancer.GetNextWorker()
 
-		if worker != nil {
-			log.Printf("Dispatching task for hash %s (part %d/%d) to worker %s",
-				task.Hash, task.PartNumber, task.PartCount, worker.URL)
-			go d.sendTaskToWorker(worker.URL, *task)
-		} else {
-			// На всякий случай, хотя такого не должно происходить
-			log.Printf("No worker available, returning task to queue")
-			d.taskQueue.Push(*task)
+		// Пока ждали свободный слот, задачу могли отменить
+		taskKey := models.TaskKey(task.Algorithm, task.Hash)
+		if !store.GlobalTaskStorage.IsInProgress(taskKey) {
+			log.Printf("Skipping part %d/%d of finished task %s", task.PartNumber, task.PartCount, taskKey)
+			balancer.LoadBalancer.TaskCompleted(worker.URL)
+			continue
 		}
+
+		log.Printf("Dispatching %s task for hash %s (part %d/%d) to worker %s",
+			task.Algorithm, task.Hash, task.PartNumber, task.PartCount, worker.URL)
+		go d.sendTaskToWorker(worker.URL, *task)
 	}
 }
 
 func (d *TaskDispatcher) sendTaskToWorker(workerURL string, task models.CrackTaskRequest) {
+	taskKey := models.TaskKey(task.Algorithm, task.Hash)
 	d.mu.Lock()
-	if _, exists := d.partToWorker[task.Hash]; !exists {
-		d.partToWorker[task.Hash] = make(map[int]string)
+	if _, exists := d.leases[taskKey]; !exists {
+		d.leases[taskKey] = make(map[int]*lease)
 	}
-	d.partToWorker[task.Hash][task.PartNumber] = workerURL
+	d.leases[taskKey][task.PartNumber] = &lease{workerURL: workerURL, task: task, expires: time.Now().Add(leaseTimeout)}
 	d.mu.Unlock()
 
 	req := utils.SendRequest{
@@ -69,20 +91,118 @@ func (d *TaskDispatcher) sendTaskToWorker(workerURL string, task models.CrackTas
 
 	if err := utils.RetryingSend(req, cfg); err != nil {
 		log.Printf("Failed to send task to worker %s: %v", workerURL, err)
-		balancer.LoadBalancer.TaskCompleted(workerURL) // Освобождаем слот в случае ошибки
-		d.taskQueue.Push(task)                         // Возвращаем задачу в очередь
+		// Аренду могли уже снять по истечении срока - тогда слот освобождён и часть в очереди
+		if _, released := d.releaseLease(taskKey, task.PartNumber, workerURL); released {
+			balancer.LoadBalancer.TaskCompleted(workerURL) // Освобождаем слот в случае ошибки
+			d.taskQueue.Push(task)                         // Возвращаем задачу в очередь
+		}
+	}
+}
+
+// releaseLease снимает аренду части, если она принадлежит воркеру workerURL (пустой адрес - любому),
+// и возвращает адрес арендатора и true, если аренда была снята
+func (d *TaskDispatcher) releaseLease(taskKey string, partNumber int, workerURL string) (string, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	l, exists := d.leases[taskKey][partNumber]
+	if !exists || (workerURL != "" && l.workerURL != workerURL) {
+		return "", false
+	}
+	delete(d.leases[taskKey], partNumber)
+	if len(d.leases[taskKey]) == 0 {
+		delete(d.leases, taskKey)
 	}
+	return l.workerURL, true
 }
 
-func (d *TaskDispatcher) DecrementWorkerTasks(workerURL string) {
-	balancer.LoadBalancer.TaskCompleted(workerURL)
+// CompletePart снимает аренду части, по которой пришёл результат от воркера workerURL, и освобождает слот воркера.
+// Результат прежнего арендатора части, чья аренда уже истекла, аренду не снимает: его слот освобождён при истечении
+func (d *TaskDispatcher) CompletePart(taskKey string, partNumber int, workerURL string) {
+	if holder, released := d.releaseLease(taskKey, partNumber, workerURL); released {
+		balancer.LoadBalancer.TaskCompleted(holder)
+	}
 }
 
-func (d *TaskDispatcher) GetWorkerByPart(hash string, partNumber int) string {
+// Heartbeat продлевает аренду частей, которые воркер перебирает
+func (d *TaskDispatcher) Heartbeat(workerURL string, parts []models.RunningPart) {
+	expires := time.Now().Add(leaseTimeout)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, part := range parts {
+		if l, exists := d.leases[part.TaskKey][part.PartNumber]; exists && l.workerURL == workerURL {
+			l.expires = expires
+		}
+	}
+}
+
+// monitor периодически исключает воркеры без heartbeat и возвращает в очередь части, аренда которых истекла
+// (воркер умер или потерял часть). Слот живого воркера, потерявшего часть, освобождается
+func (d *TaskDispatcher) monitor() {
+	ticker := time.NewTicker(monitorInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		evicted := make(map[string]bool)
+		for _, workerURL := range balancer.LoadBalancer.EvictStale(workerTimeout) {
+			evicted[workerURL] = true
+		}
+
+		now := time.Now()
+		var expired []*lease
+		d.mu.Lock()
+		for taskKey, parts := range d.leases {
+			for partNumber, l := range parts {
+				if evicted[l.workerURL] || now.After(l.expires) {
+					expired = append(expired, l)
+					delete(parts, partNumber)
+				}
+			}
+			if len(parts) == 0 {
+				delete(d.leases, taskKey)
+			}
+		}
+		d.mu.Unlock()
+
+		for _, l := range expired {
+			if !evicted[l.workerURL] {
+				balancer.LoadBalancer.TaskCompleted(l.workerURL)
+			}
+			taskKey := models.TaskKey(l.task.Algorithm, l.task.Hash)
+			if !store.GlobalTaskStorage.IsInProgress(taskKey) {
+				continue
+			}
+			log.Printf("Lease of part %d/%d of task %s on worker %s expired, re-queueing it",
+				l.task.PartNumber, l.task.PartCount, taskKey, l.workerURL)
+			d.taskQueue.Push(l.task)
+		}
+	}
+}
+
+// CancelTask просит всех воркеров, получивших части задачи, прервать их перебор
+// (задачу отменили или хеш уже найден другой частью).
+// Воркеры присылают результат прерванных частей, по которому освобождается слот балансировщика.
+func (d *TaskDispatcher) CancelTask(taskKey string) {
+	algorithm, hash := models.SplitTaskKey(taskKey)
 	d.mu.RLock()
-	defer d.mu.RUnlock()
-	if parts, exists := d.partToWorker[hash]; exists {
-		return parts[partNumber]
+	workers := make(map[string]struct{})
+	for _, l := range d.leases[taskKey] {
+		workers[l.workerURL] = struct{}{}
+	}
+	d.mu.RUnlock()
+
+	for workerURL := range workers {
+		go func(workerURL string) {
+			req := utils.SendRequest{
+				URL:     fmt.Sprintf("%s/internal/api/worker/hash/crack/cancel", workerURL),
+				Payload: models.CancelTaskRequest{Hash: hash, Algorithm: algorithm},
+			}
+			cfg := utils.SendConfig{
+				MaxRetries:    3,
+				Delay:         time.Second,
+				SuccessStatus: http.StatusOK,
+			}
+			if err := utils.RetryingSend(req, cfg); err != nil {
+				log.Printf("Failed to send cancellation of task %s to worker %s: %v", taskKey, workerURL, err)
+			}
+		}(workerURL)
 	}
-	return ""
 }
@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"manager/dispatcher"
+	"manager/queue"
+	"manager/store"
+	"net/http"
+)
+
+// CancelHashHandler отменяет задачу по requestId: неотправленные части удаляются из очереди,
+// а воркеры, которые уже перебирают части задачи, получают команду их прервать
+func CancelHashHandler(taskQueue *queue.TaskQueue, taskDispatcher *dispatcher.TaskDispatcher) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodDelete {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		requestId := r.URL.Query().Get("requestId")
+		if requestId == "" {
+			http.Error(w, "Missing requestId parameter", http.StatusBadRequest)
+			return
+		}
+
+		taskKey, status, exists := store.GlobalTaskStorage.CancelTask(requestId)
+		if !exists {
+			http.Error(w, "Request not found", http.StatusNotFound)
+			return
+		}
+		if status.Status != "CANCELLED" {
+			http.Error(w, "Task is already finished with status "+status.Status, http.StatusConflict)
+			return
+		}
+
+		removed := taskQueue.RemoveTasks(taskKey)
+		log.Printf("Cancelled task %s (request %s), removed %d queued parts", taskKey, requestId, removed)
+		taskDispatcher.CancelTask(taskKey)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(status)
+	}
+}
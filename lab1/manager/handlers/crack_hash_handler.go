@@ -1,12 +1,16 @@
 package handlers
 
 import (
+	"common/keyspace"
+	"common/mask"
 	"encoding/json"
 	"log"
 	"manager/models"
 	"manager/queue"
 	"manager/store"
+	"math/big"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -34,22 +38,20 @@ func CrackHashHandler(taskQueue *queue.TaskQueue) http.HandlerFunc {
 			return
 		}
 
-		requestId := uuid.New().String()
-		needWorker := store.GlobalTaskStorage.AddTask(requestId, request.Hash)
-
-		if needWorker {
-			partCount := request.MaxLength * partCoefficient
-			store.GlobalTaskStorage.SetPartCount(request.Hash, partCount)
-
-			for i := 1; i <= partCount; i++ {
-				task := models.CrackTaskRequest{
-					Hash:       request.Hash,
-					MaxLength:  request.MaxLength,
-					PartNumber: i,
-					PartCount:  partCount,
-				}
-				taskQueue.Push(task)
-			}
+		request.Algorithm = models.NormalizeAlgorithm(request.Algorithm)
+		hash, err := models.ParseHash(request.Algorithm, request.Hash)
+		if err != nil {
+			log.Printf("Invalid hash in crack request: %v", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		request.Hash = hash
+
+		requestId, err := scheduleCrackTask(taskQueue, request)
+		if err != nil {
+			log.Printf("Invalid mask in crack request: %v", err)
+			http.Error(w, "Invalid mask: "+err.Error(), http.StatusBadRequest)
+			return
 		}
 
 		response := models.HashCrackResponse{
@@ -60,3 +62,54 @@ func CrackHashHandler(taskQueue *queue.TaskQueue) http.HandlerFunc {
 		json.NewEncoder(w).Encode(response)
 	}
 }
+
+// scheduleCrackTask регистрирует запрос на взлом проверенного хеша и ставит в очередь части задачи,
+// которые ещё не перебирались (см. TaskStorage.AddTask). Хеши из potfile не перебираются. Ошибка
+// возвращается только для некорректной маски
+func scheduleCrackTask(taskQueue *queue.TaskQueue, request models.HashCrackRequest) (string, error) {
+	// Длина кандидатов определяется маской, если она задана.
+	// Пространство перебора по алфавиту - все длины от 1 до MaxLength подряд, поэтому номера кандидатов
+	// запросов с разной MaxLength совпадают и проверенные диапазоны можно переиспользовать.
+	searchLength := request.MaxLength
+	space := "alphabet:" + keyspace.DefaultAlphabet
+	total := keyspace.Space{Alphabet: keyspace.DefaultAlphabet, MinLength: 1, MaxLength: request.MaxLength}.SizeBig()
+	if request.Mask != "" {
+		m, err := mask.Parse(request.Mask, request.Charsets)
+		if err != nil {
+			return "", err
+		}
+		searchLength = m.Length()
+		space = "mask:" + request.Mask + ":" + strings.Join(request.Charsets, ":")
+		total = m.SizeBig()
+	}
+
+	requestId := uuid.New().String()
+	taskKey := models.TaskKey(request.Algorithm, request.Hash)
+
+	// Пароль уже найден раньше (или импортирован): перебор не нужен
+	if plain, known := store.GlobalPotfile.Lookup(taskKey); known {
+		log.Printf("Hash %s found in potfile, no parts scheduled", taskKey)
+		store.GlobalTaskStorage.AddKnownTask(requestId, taskKey, plain)
+		return requestId, nil
+	}
+
+	// Непроверенная часть пространства делится примерно на searchLength*partCoefficient
+	// непрерывных диапазонов (меньше, если кандидатов не хватает на все части)
+	full := keyspace.Range{Start: new(big.Int), End: total}
+	parts := store.GlobalTaskStorage.AddTask(requestId, taskKey, space, full, searchLength*partCoefficient)
+	for _, part := range parts {
+		task := models.CrackTaskRequest{
+			Hash:       request.Hash,
+			Algorithm:  request.Algorithm,
+			MaxLength:  request.MaxLength,
+			Mask:       request.Mask,
+			Charsets:   request.Charsets,
+			RangeStart: part.Range.Start.String(),
+			RangeEnd:   part.Range.End.String(),
+			PartNumber: part.Number,
+			PartCount:  parts[len(parts)-1].Number,
+		}
+		taskQueue.Push(task)
+	}
+	return requestId, nil
+}
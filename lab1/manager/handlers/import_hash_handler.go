@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"common/hashlist"
+	"encoding/json"
+	"log"
+	"manager/models"
+	"manager/queue"
+	"net/http"
+)
+
+// maxImportSize - наибольший размер загружаемого списка хешей
+const maxImportSize = 8 << 20
+
+// ImportHashHandler принимает список хешей (multipart/form-data: файл в части "hashes" и необязательный
+// JSON с параметрами перебора в части "request") и запускает задачу для каждого различного хеша.
+// Строки в форматах hash, user:hash и pwdump разбираются пакетом hashlist, ошибочные строки возвращаются в ответе
+func ImportHashHandler(taskQueue *queue.TaskQueue) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		r.Body = http.MaxBytesReader(w, r.Body, maxImportSize)
+		if err := r.ParseMultipartForm(maxImportSize); err != nil {
+			http.Error(w, "Invalid multipart form: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		var request models.HashCrackRequest
+		if params := r.FormValue("request"); params != "" {
+			if err := json.Unmarshal([]byte(params), &request); err != nil {
+				http.Error(w, "Invalid request part", http.StatusBadRequest)
+				return
+			}
+		}
+		request.Algorithm = models.NormalizeAlgorithm(request.Algorithm)
+		opts, err := models.HashOptions(request.Algorithm)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		file, _, err := r.FormFile("hashes")
+		if err != nil {
+			http.Error(w, "File part \"hashes\" is required", http.StatusBadRequest)
+			return
+		}
+		defer file.Close()
+		entries, rejected, err := hashlist.Parse(file, opts)
+		if err != nil {
+			http.Error(w, "Cannot read hash list: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		response := models.ImportResponse{Tasks: []models.ImportedHash{}, Rejected: rejected}
+		users := hashlist.Users(entries)
+		for _, hash := range hashlist.Hashes(entries) {
+			request.Hash = hash
+			requestId, err := scheduleCrackTask(taskQueue, request)
+			if err != nil {
+				http.Error(w, "Invalid mask: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			response.Tasks = append(response.Tasks, models.ImportedHash{Hash: hash, Users: users[hash], RequestId: requestId})
+		}
+		log.Printf("Imported %d %s hashes, rejected %d lines", len(response.Tasks), request.Algorithm, len(rejected))
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	}
+}
@@ -0,0 +1,19 @@
+package handlers
+
+import (
+	"encoding/json"
+	"manager/store"
+	"net/http"
+)
+
+// MetricsHandler отдаёт сводку по задачам, в том числе сколько частей не пришлось перебирать
+// благодаря досрочному завершению задач
+func MetricsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(store.GlobalTaskStorage.Metrics())
+}
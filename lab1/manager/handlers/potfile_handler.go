@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"manager/models"
+	"manager/store"
+	"net/http"
+)
+
+// PotfileHandler выгружает (GET) и импортирует (POST) найденные пароли в формате potfile hashcat "hash:plain".
+// Алгоритм задаётся параметром algorithm (по умолчанию md5): hashcat хранит хеши разных алгоритмов вперемешку,
+// а менеджер различает их
+func PotfileHandler(w http.ResponseWriter, r *http.Request) {
+	algorithm := models.NormalizeAlgorithm(r.URL.Query().Get("algorithm"))
+	if _, err := models.HashOptions(algorithm); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		count, err := store.GlobalPotfile.Export(w, algorithm)
+		if err != nil {
+			log.Printf("Failed to export potfile after %d entries: %v", count, err)
+			return
+		}
+		log.Printf("Exported %d %s potfile entries", count, algorithm)
+	case http.MethodPost:
+		r.Body = http.MaxBytesReader(w, r.Body, maxImportSize)
+		result, err := store.GlobalPotfile.Import(r.Body, algorithm)
+		if err != nil {
+			log.Printf("Failed to import potfile: %v", err)
+			http.Error(w, "Cannot import potfile: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		log.Printf("Imported %d %s potfile entries (%d already known, %d lines rejected)",
+			result.Imported, algorithm, result.Existing, len(result.Rejected))
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(result)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
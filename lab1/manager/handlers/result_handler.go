@@ -2,13 +2,15 @@ package handlers
 
 import (
 	"encoding/json"
+	"log"
 	"manager/dispatcher"
 	"manager/models"
+	"manager/queue"
 	"manager/store"
 	"net/http"
 )
 
-func ResultHandler(dispatcher *dispatcher.TaskDispatcher) http.HandlerFunc {
+func ResultHandler(taskQueue *queue.TaskQueue, dispatcher *dispatcher.TaskDispatcher) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -21,11 +23,28 @@ func ResultHandler(dispatcher *dispatcher.TaskDispatcher) http.HandlerFunc {
 			return
 		}
 
-		if workerURL := dispatcher.GetWorkerByPart(result.Hash, result.PartNumber); workerURL != "" {
-			dispatcher.DecrementWorkerTasks(workerURL)
+		taskKey := models.TaskKey(result.Algorithm, result.Hash)
+		dispatcher.CompletePart(taskKey, result.PartNumber, result.WorkerURL)
+
+		// Прерванная часть проверена не полностью: её результат не учитывается
+		if result.Cancelled {
+			w.WriteHeader(http.StatusOK)
+			return
 		}
 
-		store.GlobalTaskStorage.AddPartResult(result.Hash, result.PartNumber, result.Result)
+		// Найденный пароль сохраняется, даже если задача уже решена другой частью или отменена
+		if result.Result != "" {
+			if _, err := store.GlobalPotfile.Add(taskKey, result.Result); err != nil {
+				log.Printf("Failed to save %s to potfile: %v", taskKey, err)
+			}
+		}
+
+		if store.GlobalTaskStorage.AddPartResult(taskKey, result.PartNumber, result.Result) {
+			// Хеш найден: остальные части не нужны - неотправленные убираем из очереди, а отправленные прерываем
+			removed := taskQueue.RemoveTasks(taskKey)
+			log.Printf("Task %s solved by part %d, removed %d queued parts", taskKey, result.PartNumber, removed)
+			dispatcher.CancelTask(taskKey)
+		}
 		w.WriteHeader(http.StatusOK)
 	}
 }
@@ -25,7 +25,7 @@ func ResultTaskHandler(w http.ResponseWriter, r *http.Request) {
 	log.Printf("[ResultHandler] Received result for hash %s part %d: %s",
 		result.Hash, result.PartNumber, result.Result)
 
-	store.GlobalTaskStorage.AddPartResult(result.Hash, result.PartNumber, result.Result)
+	store.GlobalTaskStorage.AddPartResult(models.TaskKey(result.Algorithm, result.Hash), result.PartNumber, result.Result)
 	log.Printf("[ResultHandler] Successfully processed result for hash %s part %d",
 		result.Hash, result.PartNumber)
 
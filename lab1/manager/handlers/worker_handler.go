@@ -3,6 +3,8 @@ package handlers
 import (
 	"encoding/json"
 	"manager/balancer"
+	"manager/dispatcher"
+	"manager/models"
 	"net/http"
 )
 
@@ -25,3 +27,27 @@ func WorkerRegisterHandler(w http.ResponseWriter, r *http.Request) {
 	balancer.LoadBalancer.RegisterWorker(registration.WorkerURL, registration.MaxWorkers)
 	w.WriteHeader(http.StatusOK)
 }
+
+// WorkerHeartbeatHandler принимает heartbeat воркера: отмечает, что воркер жив, и продлевает аренду его частей.
+// Незарегистрированному (или уже исключённому) воркеру отвечает 404, чтобы он зарегистрировался заново
+func WorkerHeartbeatHandler(taskDispatcher *dispatcher.TaskDispatcher) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var heartbeat models.Heartbeat
+		if err := json.NewDecoder(r.Body).Decode(&heartbeat); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if !balancer.LoadBalancer.Heartbeat(heartbeat.WorkerURL) {
+			http.Error(w, "Worker is not registered", http.StatusNotFound)
+			return
+		}
+		taskDispatcher.Heartbeat(heartbeat.WorkerURL, heartbeat.Parts)
+		w.WriteHeader(http.StatusOK)
+	}
+}
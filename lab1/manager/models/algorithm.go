@@ -0,0 +1,63 @@
+package models
+
+import (
+	"common/hashlist"
+	"fmt"
+	"strings"
+)
+
+// DefaultAlgorithm используется, если клиент не указал алгоритм
+const DefaultAlgorithm = "md5"
+
+// hashHexLengths - длина hex-представления хеша для каждого поддерживаемого алгоритма
+var hashHexLengths = map[string]int{
+	"md5":    32,
+	"md4":    32,
+	"ntlm":   32,
+	"sha1":   40,
+	"sha256": 64,
+	"sha512": 128,
+}
+
+// NormalizeAlgorithm приводит имя алгоритма к каноничному виду
+func NormalizeAlgorithm(algorithm string) string {
+	algorithm = strings.ToLower(strings.TrimSpace(algorithm))
+	if algorithm == "" {
+		return DefaultAlgorithm
+	}
+	return algorithm
+}
+
+// HashOptions возвращает параметры разбора хешей алгоритма (длина hex-представления) для пакета hashlist
+func HashOptions(algorithm string) (hashlist.Options, error) {
+	expected, exists := hashHexLengths[algorithm]
+	if !exists {
+		return hashlist.Options{}, fmt.Errorf("unsupported algorithm %q", algorithm)
+	}
+	return hashlist.Options{Algorithm: algorithm, HexLength: expected}, nil
+}
+
+// ParseHash проверяет, что алгоритм поддерживается, и извлекает хеш из строки в любом формате hashlist
+// (hash, user:hash, pwdump): возвращается hex нужной длины в нижнем регистре
+func ParseHash(algorithm string, line string) (string, error) {
+	opts, err := HashOptions(algorithm)
+	if err != nil {
+		return "", err
+	}
+	entry, err := hashlist.ParseLine(line, opts)
+	if err != nil {
+		return "", err
+	}
+	return entry.Hash, nil
+}
+
+// TaskKey - ключ задачи в хранилище: одинаковый hex у разных алгоритмов это разные задачи
+func TaskKey(algorithm string, hash string) string {
+	return NormalizeAlgorithm(algorithm) + ":" + hash
+}
+
+// SplitTaskKey разбирает ключ задачи обратно на алгоритм и хеш
+func SplitTaskKey(taskKey string) (algorithm string, hash string) {
+	algorithm, hash, _ = strings.Cut(taskKey, ":")
+	return algorithm, hash
+}
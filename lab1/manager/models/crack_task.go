@@ -1,14 +1,39 @@
 package models
 
 type CrackTaskRequest struct {
-	Hash       string `json:"hash"`
-	MaxLength  int    `json:"maxLength"`
-	PartNumber int    `json:"partNumber"`
-	PartCount  int    `json:"partCount"`
+	Hash       string   `json:"hash"`
+	Algorithm  string   `json:"algorithm"`
+	MaxLength  int      `json:"maxLength"`
+	Mask       string   `json:"mask,omitempty"`
+	Charsets   []string `json:"charsets,omitempty"`
+	RangeStart string   `json:"rangeStart"` // начало диапазона [start, end) номеров кандидатов
+	RangeEnd   string   `json:"rangeEnd"`
+	PartNumber int      `json:"partNumber"`
+	PartCount  int      `json:"partCount"`
 }
 
 type CrackTaskResult struct {
 	Hash       string `json:"hash"`
+	Algorithm  string `json:"algorithm"`
 	Result     string `json:"result"`
 	PartNumber int    `json:"partNumber"`
+	Cancelled  bool   `json:"cancelled,omitempty"` // перебор части прерван отменой задачи
+	WorkerURL  string `json:"workerUrl,omitempty"` // воркер, перебиравший часть
+}
+
+// Heartbeat - периодическое сообщение воркера: он жив и перебирает перечисленные части
+type Heartbeat struct {
+	WorkerURL string        `json:"workerUrl"`
+	Parts     []RunningPart `json:"parts"`
+}
+
+type RunningPart struct {
+	TaskKey    string `json:"taskKey"` // algorithm:hash
+	PartNumber int    `json:"partNumber"`
+}
+
+// CancelTaskRequest - запрос менеджера воркеру на прерывание всех частей задачи
+type CancelTaskRequest struct {
+	Hash      string `json:"hash"`
+	Algorithm string `json:"algorithm"`
 }
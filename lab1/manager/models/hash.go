@@ -1,10 +1,27 @@
 package models
 
+import "common/hashlist"
+
 type HashCrackRequest struct {
-	Hash      string `json:"hash"`
-	MaxLength int    `json:"maxLength"`
+	Hash      string   `json:"hash"`
+	Algorithm string   `json:"algorithm"`
+	MaxLength int      `json:"maxLength"`
+	Mask      string   `json:"mask,omitempty"`     // маска вместо перебора по алфавиту, например "Company?d?d?d?d"
+	Charsets  []string `json:"charsets,omitempty"` // пользовательские наборы символов ?1..?4
 }
 
 type HashCrackResponse struct {
 	RequestId string `json:"requestId"`
 }
+
+// ImportResponse - результат импорта списка хешей: по задаче на каждый хеш и отклонённые строки
+type ImportResponse struct {
+	Tasks    []ImportedHash       `json:"tasks"`
+	Rejected []hashlist.LineError `json:"rejected,omitempty"`
+}
+
+type ImportedHash struct {
+	Hash      string   `json:"hash"`
+	Users     []string `json:"users,omitempty"` // учётные записи с этим хешем (user:hash, pwdump)
+	RequestId string   `json:"requestId"`
+}
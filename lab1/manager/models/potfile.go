@@ -0,0 +1,151 @@
+package models
+
+import (
+	"bufio"
+	"common/hashlist"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Potfile - все найденные пароли. Записи хранятся в памяти по ключу задачи (algorithm:hash)
+// и дописываются в файл строками "algorithm:hash:plain", поэтому переживают перезапуск менеджера
+type Potfile struct {
+	entries map[string]string // task key -> пароль
+	file    *os.File          // nil, если potfile хранится только в памяти
+	mu      sync.RWMutex
+}
+
+// PotfileImport - итог импорта potfile
+type PotfileImport struct {
+	Imported int                  `json:"imported"` // новые записи
+	Existing int                  `json:"existing"` // хеши, которые уже были в potfile
+	Rejected []hashlist.LineError `json:"rejected,omitempty"`
+}
+
+// OpenPotfile загружает potfile из файла и открывает его на дозапись.
+// Пустой путь означает potfile только в памяти. Повреждённые строки пропускаются
+func OpenPotfile(path string) (*Potfile, error) {
+	p := &Potfile{entries: make(map[string]string)}
+	if path == "" {
+		return p, nil
+	}
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	scanner := bufio.NewScanner(file)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSuffix(scanner.Text(), "\r")
+		if text == "" {
+			continue
+		}
+		taskKey, plain, err := parsePotfileLine(text)
+		if err != nil {
+			log.Printf("[Potfile] Skipping line %d of %s: %v", line, path, err)
+			continue
+		}
+		p.entries[taskKey] = plain
+	}
+	if err := scanner.Err(); err != nil {
+		file.Close()
+		return nil, err
+	}
+	p.file = file
+	log.Printf("[Potfile] Loaded %d entries from %s", len(p.entries), path)
+	return p, nil
+}
+
+// parsePotfileLine разбирает строку файла "algorithm:hash:plain"
+func parsePotfileLine(text string) (string, string, error) {
+	algorithm, rest, ok := strings.Cut(text, ":")
+	if !ok {
+		return "", "", fmt.Errorf("expected algorithm:hash:plain")
+	}
+	opts, err := HashOptions(algorithm)
+	if err != nil {
+		return "", "", err
+	}
+	entry, err := hashlist.ParsePotLine(rest, opts)
+	if err != nil {
+		return "", "", err
+	}
+	return TaskKey(algorithm, entry.Hash), entry.Plain, nil
+}
+
+// Lookup возвращает известный пароль для ключа задачи
+func (p *Potfile) Lookup(taskKey string) (string, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	plain, ok := p.entries[taskKey]
+	return plain, ok
+}
+
+// Add запоминает пароль и дописывает его в файл. Уже известный хеш не перезаписывается.
+// Возвращает true, если запись добавлена
+func (p *Potfile) Add(taskKey string, plain string) (bool, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if _, exists := p.entries[taskKey]; exists {
+		return false, nil
+	}
+	if p.file != nil {
+		if _, err := io.WriteString(p.file, hashlist.FormatPotLine(taskKey, plain)+"\n"); err != nil {
+			return false, err
+		}
+	}
+	p.entries[taskKey] = plain
+	return true, nil
+}
+
+// Export записывает пароли хешей алгоритма в формате hashcat "hash:plain"
+func (p *Potfile) Export(w io.Writer, algorithm string) (int, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	count := 0
+	for taskKey, plain := range p.entries {
+		keyAlgorithm, hash := SplitTaskKey(taskKey)
+		if keyAlgorithm != algorithm {
+			continue
+		}
+		if _, err := io.WriteString(w, hashlist.FormatPotLine(hash, plain)+"\n"); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+// Import добавляет записи potfile hashcat для хешей алгоритма.
+// Менеджер не вычисляет хеши, поэтому пары принимаются без проверки пароля
+func (p *Potfile) Import(r io.Reader, algorithm string) (PotfileImport, error) {
+	var result PotfileImport
+	opts, err := HashOptions(algorithm)
+	if err != nil {
+		return result, err
+	}
+	entries, rejected, err := hashlist.ParsePot(r, opts)
+	if err != nil {
+		return result, err
+	}
+	result.Rejected = rejected
+	for _, entry := range entries {
+		added, err := p.Add(TaskKey(algorithm, entry.Hash), entry.Plain)
+		if err != nil {
+			return result, err
+		}
+		if added {
+			result.Imported++
+		} else {
+			result.Existing++
+		}
+	}
+	return result, nil
+}
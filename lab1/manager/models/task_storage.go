@@ -1,6 +1,7 @@
 package models
 
 import (
+	"common/keyspace"
 	"fmt"
 	"log"
 	"sync"
@@ -12,47 +13,143 @@ type HashCrackStatus struct {
 }
 
 type TaskStorage struct {
-	requestToHash map[string]string         // requestId -> hash
-	hashToStatus  map[string]StatusResponse // hash -> task status
-	partResults   map[string]map[int]string // hash -> (part number -> result)
-	partCounts    map[string]int            // hash -> expected parts count
+	requestToHash map[string]string           // requestId -> task key (algorithm:hash)
+	hashToStatus  map[string]StatusResponse   // task key -> task status (IN_PROGRESS, DONE, FAIL, CANCELLED)
+	partResults   map[string]map[int]string   // task key -> (part number -> result)
+	partCounts    map[string]int              // task key -> expected parts count
+	lastPart      map[string]int              // task key -> last part number, kept across restarts of the task
+	skippedParts  map[string]int              // task key -> parts not finished when the hash was found
+	parts         map[string]map[int]partSpan // task key -> (part number -> search space and range of the part)
+	coverage      map[string][]keyspace.Range // task key + search space -> ranges checked without a match
 	mu            sync.RWMutex
 }
 
+// partSpan - пространство поиска и диапазон части задачи
+type partSpan struct {
+	space string
+	r     keyspace.Range
+}
+
+// ScheduledPart - часть задачи, которую нужно отправить воркерам
+type ScheduledPart struct {
+	Number int
+	Range  keyspace.Range
+}
+
+// TaskMetrics - сводка по задачам и сэкономленному перебору
+type TaskMetrics struct {
+	Tasks        map[string]int `json:"tasks"`        // количество задач по статусам
+	SolvedEarly  int            `json:"solvedEarly"`  // задачи, решённые до проверки всех частей
+	TotalParts   int            `json:"totalParts"`   // части всех запущенных задач
+	SkippedParts int            `json:"skippedParts"` // части, которые не понадобилось проверять до конца
+	SavedPercent float64        `json:"savedPercent"` // доля пропущенных частей (части равны по размеру)
+}
+
 func NewTaskStorage() *TaskStorage {
 	return &TaskStorage{
 		requestToHash: make(map[string]string),
 		hashToStatus:  make(map[string]StatusResponse),
 		partResults:   make(map[string]map[int]string),
 		partCounts:    make(map[string]int),
+		lastPart:      make(map[string]int),
+		skippedParts:  make(map[string]int),
+		parts:         make(map[string]map[int]partSpan),
+		coverage:      make(map[string][]keyspace.Range),
 	}
 }
 
-// AddTask returns true if hash is added for the first time and needs to be cracked
-func (ts *TaskStorage) AddTask(requestId string, hash string) bool {
+// AddTask регистрирует запрос на перебор диапазона full пространства space (например, алфавит или маска)
+// и возвращает части, которые нужно отправить воркерам. Диапазоны, уже проверенные без результата прошлыми
+// запусками, и диапазоны, которые перебирает текущий запуск, не планируются повторно: более широкий запрос
+// к выполняющейся задаче добавляет к ней только недостающие части, а после FAIL или CANCELLED задача
+// перезапускается только для непроверенной части. Если проверять нечего, задача сразу получает FAIL.
+// Пустой результат означает, что ничего отправлять не нужно
+func (ts *TaskStorage) AddTask(requestId string, hash string, space string, full keyspace.Range, maxParts int) []ScheduledPart {
 	ts.mu.Lock()
 	defer ts.mu.Unlock()
 
 	log.Printf("[TaskStorage] Adding new task. RequestID: %s, Hash: %s", requestId, hash)
 	ts.requestToHash[requestId] = hash
 
-	if status, exists := ts.hashToStatus[hash]; exists {
-		if status.Status == "DONE" {
-			log.Printf("[TaskStorage] Hash %s already processed, returning result", hash)
-			return false
+	status, exists := ts.hashToStatus[hash]
+	if exists && status.Status == "DONE" {
+		log.Printf("[TaskStorage] Hash %s already processed, returning result", hash)
+		return nil
+	}
+	running := exists && status.Status == "IN_PROGRESS"
+
+	planned := append([]keyspace.Range{}, ts.coverage[coverageKey(hash, space)]...)
+	if running {
+		for _, part := range ts.parts[hash] {
+			if part.space == space {
+				planned = append(planned, part.r)
+			}
 		}
-		if status.Status == "IN_PROGRESS" {
-			log.Printf("[TaskStorage] Hash %s already in progress", hash)
-			return false
+	}
+	rest := keyspace.Subtract(full, planned)
+
+	if running && len(rest) == 0 {
+		log.Printf("[TaskStorage] Hash %s already in progress", hash)
+		return nil
+	}
+	if !running {
+		// Задача запускается впервые или заново: результаты прошлого запуска сбрасываются, проверенные диапазоны - нет
+		delete(ts.partCounts, hash)
+		delete(ts.partResults, hash)
+		delete(ts.skippedParts, hash)
+		delete(ts.parts, hash)
+		if len(rest) == 0 {
+			ts.hashToStatus[hash] = StatusResponse{Status: "FAIL", Data: []string{}}
+			log.Printf("[TaskStorage] Search space of hash %s is already exhausted", hash)
+			return nil
+		}
+		ts.hashToStatus[hash] = StatusResponse{
+			Status: "IN_PROGRESS",
+			Data:   []string{"0%"},
 		}
+		ts.partResults[hash] = make(map[int]string)
+		ts.parts[hash] = make(map[int]partSpan)
+	}
+
+	// Номера частей не повторяются и после перезапуска задачи: поздний результат части прошлого запуска
+	// (повтор после истечения аренды или часть, не успевшая узнать об отмене) не засчитывается другому диапазону
+	ranges := keyspace.PartitionRanges(rest, 1, maxParts)
+	scheduled := make([]ScheduledPart, len(ranges))
+	first := ts.lastPart[hash] + 1
+	for i, r := range ranges {
+		scheduled[i] = ScheduledPart{Number: first + i, Range: r}
+		ts.parts[hash][first+i] = partSpan{space: space, r: r}
 	}
+	ts.partCounts[hash] += len(ranges)
+	ts.lastPart[hash] += len(ranges)
+	if running {
+		log.Printf("[TaskStorage] Extended hash %s with %d parts", hash, len(ranges))
+	} else {
+		log.Printf("[TaskStorage] Started processing for hash %s (%d parts)", hash, len(ranges))
+	}
+	return scheduled
+}
+
+// coverageKey - ключ проверенных диапазонов: номера кандидатов сопоставимы только внутри одного пространства
+func coverageKey(hash string, space string) string {
+	return hash + "|" + space
+}
 
+// AddKnownTask регистрирует запрос на хеш, пароль которого уже известен из potfile: задача сразу получает
+// статус DONE и не запускается. Выполняющаяся задача не прерывается - её результат совпадёт с известным
+func (ts *TaskStorage) AddKnownTask(requestId string, hash string, result string) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	log.Printf("[TaskStorage] Adding task with known result. RequestID: %s, Hash: %s", requestId, hash)
+	ts.requestToHash[requestId] = hash
+	if ts.hashToStatus[hash].Status == "IN_PROGRESS" {
+		return
+	}
 	ts.hashToStatus[hash] = StatusResponse{
-		Status: "IN_PROGRESS",
-		Data:   []string{"0%"},
+		Status: "DONE",
+		Data:   []string{result},
 	}
-	log.Printf("[TaskStorage] Started processing for hash %s", hash)
-	return true
 }
 
 func (ts *TaskStorage) GetStatus(requestId string) (StatusResponse, bool) {
@@ -70,6 +167,33 @@ func (ts *TaskStorage) GetStatus(requestId string) (StatusResponse, bool) {
 	return status, exists
 }
 
+// CancelTask отменяет задачу, к которой относится requestId, если она ещё выполняется.
+// Возвращает ключ задачи, её статус после вызова и false, если requestId неизвестен.
+// Одна задача может обслуживать несколько requestId с тем же хешем - отмена действует для всех.
+func (ts *TaskStorage) CancelTask(requestId string) (string, StatusResponse, bool) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	hash, exists := ts.requestToHash[requestId]
+	if !exists {
+		return "", StatusResponse{}, false
+	}
+	status := ts.hashToStatus[hash]
+	if status.Status == "IN_PROGRESS" {
+		status = StatusResponse{Status: "CANCELLED", Data: []string{}}
+		ts.hashToStatus[hash] = status
+		log.Printf("[TaskStorage] Task %s cancelled by request %s", hash, requestId)
+	}
+	return hash, status, true
+}
+
+// IsInProgress сообщает, нужно ли ещё перебирать части задачи
+func (ts *TaskStorage) IsInProgress(hash string) bool {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+	return ts.hashToStatus[hash].Status == "IN_PROGRESS"
+}
+
 func (ts *TaskStorage) UpdateStatus(hash string, status string, result []string) {
 	ts.mu.Lock()
 	defer ts.mu.Unlock()
@@ -81,20 +205,28 @@ func (ts *TaskStorage) UpdateStatus(hash string, status string, result []string)
 	}
 }
 
-func (ts *TaskStorage) SetPartCount(hash string, count int) {
+// AddPartResult сохраняет результат части и возвращает true, если этот результат завершил задачу успехом:
+// тогда оставшиеся части больше не нужны и их перебор следует прекратить
+func (ts *TaskStorage) AddPartResult(hash string, partNumber int, result string) bool {
 	ts.mu.Lock()
 	defer ts.mu.Unlock()
 
-	if _, exists := ts.partCounts[hash]; !exists {
-		ts.partCounts[hash] = count
-		ts.partResults[hash] = make(map[int]string)
+	span, exists := ts.parts[hash][partNumber]
+	if !exists {
+		// Часть прошлого запуска задачи: её диапазон уже перебирается заново частями текущего запуска
+		log.Printf("[TaskStorage] Ignoring result of part %d from a previous run of task %s", partNumber, hash)
+		return false
+	}
+	// Часть, проверенная целиком без результата, больше не перебирается, даже если задачу уже отменили
+	if result == "" {
+		key := coverageKey(hash, span.space)
+		ts.coverage[key] = keyspace.Merge(append(ts.coverage[key], span.r))
 	}
-}
-
-func (ts *TaskStorage) AddPartResult(hash string, partNumber int, result string) {
-	ts.mu.Lock()
-	defer ts.mu.Unlock()
 
+	if ts.hashToStatus[hash].Status == "CANCELLED" {
+		log.Printf("[TaskStorage] Ignoring result of part %d for cancelled task %s", partNumber, hash)
+		return false
+	}
 	if _, exists := ts.partResults[hash]; !exists {
 		ts.partResults[hash] = make(map[int]string)
 	}
@@ -110,11 +242,17 @@ func (ts *TaskStorage) AddPartResult(hash string, partNumber int, result string)
 			}
 		}
 		if len(successfulResults) > 0 {
+			solved := ts.hashToStatus[hash].Status == "IN_PROGRESS"
 			ts.hashToStatus[hash] = StatusResponse{
 				Status: "DONE",
 				Data:   successfulResults,
 			}
-			return
+			if solved {
+				ts.skippedParts[hash] = ts.partCounts[hash] - len(ts.partResults[hash])
+				log.Printf("[TaskStorage] Hash %s cracked by part %d, skipping %d of %d parts",
+					hash, partNumber, ts.skippedParts[hash], ts.partCounts[hash])
+			}
+			return solved
 		}
 	}
 
@@ -131,4 +269,29 @@ func (ts *TaskStorage) AddPartResult(hash string, partNumber int, result string)
 			Data:   []string{},
 		}
 	}
+	return false
+}
+
+// Metrics собирает сводку по всем задачам хранилища
+func (ts *TaskStorage) Metrics() TaskMetrics {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+
+	metrics := TaskMetrics{Tasks: make(map[string]int)}
+	for _, status := range ts.hashToStatus {
+		metrics.Tasks[status.Status]++
+	}
+	for _, count := range ts.partCounts {
+		metrics.TotalParts += count
+	}
+	for _, skipped := range ts.skippedParts {
+		if skipped > 0 {
+			metrics.SolvedEarly++
+		}
+		metrics.SkippedParts += skipped
+	}
+	if metrics.TotalParts > 0 {
+		metrics.SavedPercent = float64(metrics.SkippedParts) / float64(metrics.TotalParts) * 100
+	}
+	return metrics
 }
@@ -0,0 +1,45 @@
+package models
+
+import (
+	"math/big"
+	"testing"
+
+	"common/keyspace"
+)
+
+func TestRestartedTaskIgnoresPreviousRunParts(t *testing.T) {
+	ts := NewTaskStorage()
+	full := keyspace.Range{Start: big.NewInt(0), End: big.NewInt(100)}
+
+	first := ts.AddTask("r1", "md5:hash", "abc", full, 4)
+	if len(first) != 4 || first[0].Number != 1 {
+		t.Fatalf("first run parts = %v, want 4 parts starting at 1", first)
+	}
+	ts.CancelTask("r1")
+	// Часть 1 успела завершиться до перезапуска, её диапазон проверен
+	ts.AddPartResult("md5:hash", first[0].Number, "")
+
+	second := ts.AddTask("r2", "md5:hash", "abc", full, 3)
+	if len(second) != 3 || second[0].Number != first[len(first)-1].Number+1 {
+		t.Fatalf("second run parts = %v, want 3 parts numbered after %d", second, first[len(first)-1].Number)
+	}
+	if second[0].Range.Start.Cmp(first[0].Range.End) != 0 {
+		t.Fatalf("second run starts at %s, want %s", second[0].Range.Start, first[0].Range.End)
+	}
+
+	// Поздний результат части 2 прошлого запуска не засчитывается ни одной части текущего запуска
+	ts.AddPartResult("md5:hash", first[1].Number, "")
+	if status, _ := ts.GetStatus("r2"); status.Status != "IN_PROGRESS" || status.Data[0] != "0%" {
+		t.Fatalf("status = %v, want IN_PROGRESS 0%%", status)
+	}
+	if covered := ts.coverage[coverageKey("md5:hash", "abc")]; len(covered) != 1 || covered[0].End.Cmp(first[0].Range.End) != 0 {
+		t.Fatalf("covered = %v, want only the first part of the first run", covered)
+	}
+
+	for _, part := range second {
+		ts.AddPartResult("md5:hash", part.Number, "")
+	}
+	if status, _ := ts.GetStatus("r2"); status.Status != "FAIL" {
+		t.Fatalf("status = %v, want FAIL after all parts of the second run", status)
+	}
+}
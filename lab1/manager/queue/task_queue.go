@@ -34,3 +34,18 @@ func (q *TaskQueue) Pop() *models.CrackTaskRequest {
 	q.tasks = q.tasks[1:]
 	return &task
 }
+
+// RemoveTasks удаляет из очереди все ещё не отправленные части задачи taskKey и возвращает их количество
+func (q *TaskQueue) RemoveTasks(taskKey string) int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	kept := q.tasks[:0]
+	for _, task := range q.tasks {
+		if models.TaskKey(task.Algorithm, task.Hash) != taskKey {
+			kept = append(kept, task)
+		}
+	}
+	removed := len(q.tasks) - len(kept)
+	q.tasks = kept
+	return removed
+}
@@ -9,13 +9,25 @@ import (
 )
 
 func Start(taskQueue *queue.TaskQueue, taskDispatcher *dispatcher.TaskDispatcher) {
-	// Внешние маршруты API (запуск задачи и получение статуса)
-	http.HandleFunc("/api/hash/crack", handlers.CrackHashHandler(taskQueue))
+	// Внешние маршруты API (запуск и отмена задачи, импорт списка хешей, получение статуса, potfile)
+	crackHandler := handlers.CrackHashHandler(taskQueue)
+	cancelHandler := handlers.CancelHashHandler(taskQueue, taskDispatcher)
+	http.HandleFunc("/api/hash/crack", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodDelete {
+			cancelHandler(w, r)
+			return
+		}
+		crackHandler(w, r)
+	})
+	http.HandleFunc("/api/hash/import", handlers.ImportHashHandler(taskQueue))
 	http.HandleFunc("/api/hash/status", handlers.StatusHandler)
+	http.HandleFunc("/api/metrics", handlers.MetricsHandler)
+	http.HandleFunc("/api/potfile", handlers.PotfileHandler)
 
 	// Внутренние маршруты для взаимодействия с воркерами
-	http.HandleFunc("/internal/api/manager/hash/crack/result", handlers.ResultHandler(taskDispatcher))
+	http.HandleFunc("/internal/api/manager/hash/crack/result", handlers.ResultHandler(taskQueue, taskDispatcher))
 	http.HandleFunc("/internal/api/worker/register", handlers.WorkerRegisterHandler)
+	http.HandleFunc("/internal/api/worker/heartbeat", handlers.WorkerHeartbeatHandler(taskDispatcher))
 
 	log.Println("Manager listening on port :8080")
 	if err := http.ListenAndServe(":8080", nil); err != nil {
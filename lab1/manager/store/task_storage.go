@@ -1,9 +1,22 @@
 package store
 
-import "manager/models"
+import (
+	"log"
+	"manager/models"
+	"os"
+)
 
 var GlobalTaskStorage *models.TaskStorage
 
+// GlobalPotfile - найденные пароли, переживающие перезапуск (файл задаётся переменной POTFILE_PATH)
+var GlobalPotfile *models.Potfile
+
 func Init() {
 	GlobalTaskStorage = models.NewTaskStorage()
+
+	potfile, err := models.OpenPotfile(os.Getenv("POTFILE_PATH"))
+	if err != nil {
+		log.Fatalf("Failed to open potfile: %v", err)
+	}
+	GlobalPotfile = potfile
 }
@@ -7,6 +7,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"mime/multipart"
 	"net/http"
 	"os"
 	"strconv"
@@ -14,8 +15,11 @@ import (
 )
 
 type HashCrackRequest struct {
-	Hash      string `json:"hash"`
-	MaxLength int    `json:"maxLength"`
+	Hash      string   `json:"hash"`
+	Algorithm string   `json:"algorithm,omitempty"`
+	MaxLength int      `json:"maxLength"`
+	Mask      string   `json:"mask,omitempty"`
+	Charsets  []string `json:"charsets,omitempty"`
 }
 
 type HashCrackResponse struct {
@@ -35,8 +39,16 @@ func computeMD5(text string) string {
 func usage() {
 	fmt.Println("Usage:")
 	fmt.Println("  -md5 <text>             : prints MD5 hash of text")
-	fmt.Println("  -crack <hash> [maxLength] : sends crack request with optional maxLength (default=3) and returns requestId")
+	fmt.Println("  -crack <hash> [maxLength] [algorithm] : sends crack request with optional maxLength (default=3)")
+	fmt.Println("                          and algorithm (md5, md4, ntlm, sha1, sha256, sha512; default=md5), returns requestId")
+	fmt.Println("  -mask <hash> <mask> [algorithm] [charset1..charset4] : sends mask attack request, e.g. Company?d?d?1 with charset1 ?l?d")
+	fmt.Println("  -import <file> [maxLength] [algorithm] : imports hash list (hash, user:hash, pwdump user:uid:lm:ntlm:::)")
+	fmt.Println("                          and starts a crack request for every hash, prints rejected lines")
 	fmt.Println("  -status <requestId>     : fetches and prints status of crack request")
+	fmt.Println("  -cancel <requestId>     : cancels crack request")
+	fmt.Println("  -metrics                : prints task metrics (parts skipped after early success)")
+	fmt.Println("  -potfile [algorithm]    : prints cracked hashes in hashcat potfile format (hash:plain)")
+	fmt.Println("  -import-potfile <file> [algorithm] : imports hashcat potfile, cracked hashes are answered without work")
 	os.Exit(1)
 }
 
@@ -66,28 +78,47 @@ func main() {
 				fmt.Println("Invalid maxLength provided, using default 3")
 			}
 		}
+		algorithm := ""
+		if len(os.Args) >= 5 {
+			algorithm = os.Args[4]
+		}
 		reqPayload := HashCrackRequest{
 			Hash:      hash,
+			Algorithm: algorithm,
 			MaxLength: maxLength,
 		}
-		jsonData, err := json.Marshal(reqPayload)
-		if err != nil {
-			fmt.Println("Error marshalling JSON:", err)
-			return
+		sendCrackRequest(reqPayload)
+	case "-mask":
+		if len(os.Args) < 4 {
+			usage()
 		}
-		crackURL := "http://localhost:8080/api/hash/crack"
-		resp, err := http.Post(crackURL, "application/json", bytes.NewBuffer(jsonData))
-		if err != nil {
-			fmt.Println("Error sending crack request:", err)
-			return
+		reqPayload := HashCrackRequest{
+			Hash: os.Args[2],
+			Mask: os.Args[3],
 		}
-		defer resp.Body.Close()
-		var crackResp HashCrackResponse
-		if err := json.NewDecoder(resp.Body).Decode(&crackResp); err != nil {
-			fmt.Println("Error decoding response:", err)
-			return
+		if len(os.Args) >= 5 {
+			reqPayload.Algorithm = os.Args[4]
+		}
+		if len(os.Args) >= 6 {
+			reqPayload.Charsets = os.Args[5:]
+		}
+		sendCrackRequest(reqPayload)
+	case "-import":
+		if len(os.Args) < 3 {
+			usage()
 		}
-		fmt.Println("RequestId:", crackResp.RequestId)
+		reqPayload := HashCrackRequest{MaxLength: 3}
+		if len(os.Args) >= 4 {
+			if v, err := strconv.Atoi(os.Args[3]); err == nil {
+				reqPayload.MaxLength = v
+			} else {
+				fmt.Println("Invalid maxLength provided, using default 3")
+			}
+		}
+		if len(os.Args) >= 5 {
+			reqPayload.Algorithm = os.Args[4]
+		}
+		importHashes(os.Args[2], reqPayload)
 	case "-status":
 		if len(os.Args) < 3 {
 			usage()
@@ -125,7 +156,207 @@ func main() {
 		} else if status.Status == "FAIL" {
 			fmt.Println("No results found")
 		}
+	case "-cancel":
+		if len(os.Args) < 3 {
+			usage()
+		}
+		cancelURL := fmt.Sprintf("http://localhost:8080/api/hash/crack?requestId=%s", os.Args[2])
+		req, err := http.NewRequest(http.MethodDelete, cancelURL, nil)
+		if err != nil {
+			fmt.Println("Error creating cancel request:", err)
+			return
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			fmt.Println("Error sending cancel request:", err)
+			return
+		}
+		defer resp.Body.Close()
+		body, _ := ioutil.ReadAll(resp.Body)
+		if resp.StatusCode != http.StatusOK {
+			fmt.Printf("Cancel request rejected (%d): %s", resp.StatusCode, body)
+			return
+		}
+		fmt.Println("Task cancelled")
+	case "-metrics":
+		resp, err := http.Get("http://localhost:8080/api/metrics")
+		if err != nil {
+			fmt.Println("Error fetching metrics:", err)
+			return
+		}
+		defer resp.Body.Close()
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			fmt.Println("Error reading response:", err)
+			return
+		}
+		var metrics struct {
+			Tasks        map[string]int `json:"tasks"`
+			SolvedEarly  int            `json:"solvedEarly"`
+			TotalParts   int            `json:"totalParts"`
+			SkippedParts int            `json:"skippedParts"`
+			SavedPercent float64        `json:"savedPercent"`
+		}
+		if err := json.Unmarshal(body, &metrics); err != nil {
+			fmt.Println("Error decoding metrics:", err)
+			return
+		}
+		for status, count := range metrics.Tasks {
+			fmt.Printf("%s: %d\n", status, count)
+		}
+		fmt.Printf("Solved early: %d\n", metrics.SolvedEarly)
+		fmt.Printf("Skipped parts: %d of %d (%.1f%%)\n", metrics.SkippedParts, metrics.TotalParts, metrics.SavedPercent)
+	case "-potfile":
+		potfileURL := "http://localhost:8080/api/potfile"
+		if len(os.Args) >= 3 {
+			potfileURL += "?algorithm=" + os.Args[2]
+		}
+		resp, err := http.Get(potfileURL)
+		if err != nil {
+			fmt.Println("Error fetching potfile:", err)
+			return
+		}
+		defer resp.Body.Close()
+		body, _ := ioutil.ReadAll(resp.Body)
+		if resp.StatusCode != http.StatusOK {
+			fmt.Printf("Potfile request rejected (%d): %s", resp.StatusCode, body)
+			return
+		}
+		fmt.Print(string(body))
+	case "-import-potfile":
+		if len(os.Args) < 3 {
+			usage()
+			return
+		}
+		algorithm := ""
+		if len(os.Args) >= 4 {
+			algorithm = os.Args[3]
+		}
+		importPotfile(os.Args[2], algorithm)
 	default:
 		usage()
 	}
 }
+
+func sendCrackRequest(reqPayload HashCrackRequest) {
+	jsonData, err := json.Marshal(reqPayload)
+	if err != nil {
+		fmt.Println("Error marshalling JSON:", err)
+		return
+	}
+	crackURL := "http://localhost:8080/api/hash/crack"
+	resp, err := http.Post(crackURL, "application/json", bytes.NewBuffer(jsonData))
+	if err != nil {
+		fmt.Println("Error sending crack request:", err)
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		fmt.Printf("Crack request rejected (%d): %s", resp.StatusCode, body)
+		return
+	}
+	var crackResp HashCrackResponse
+	if err := json.NewDecoder(resp.Body).Decode(&crackResp); err != nil {
+		fmt.Println("Error decoding response:", err)
+		return
+	}
+	fmt.Println("RequestId:", crackResp.RequestId)
+}
+
+func importHashes(path string, reqPayload HashCrackRequest) {
+	hashes, err := ioutil.ReadFile(path)
+	if err != nil {
+		fmt.Println("Error reading hash list:", err)
+		return
+	}
+	params, err := json.Marshal(reqPayload)
+	if err != nil {
+		fmt.Println("Error encoding request:", err)
+		return
+	}
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	form.WriteField("request", string(params))
+	part, err := form.CreateFormFile("hashes", path)
+	if err != nil {
+		fmt.Println("Error creating form:", err)
+		return
+	}
+	part.Write(hashes)
+	form.Close()
+
+	resp, err := http.Post("http://localhost:8080/api/hash/import", form.FormDataContentType(), &body)
+	if err != nil {
+		fmt.Println("Error sending import request:", err)
+		return
+	}
+	defer resp.Body.Close()
+	respBody, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		fmt.Printf("Import rejected (%d): %s", resp.StatusCode, respBody)
+		return
+	}
+	var result struct {
+		Tasks []struct {
+			Hash      string   `json:"hash"`
+			Users     []string `json:"users"`
+			RequestId string   `json:"requestId"`
+		} `json:"tasks"`
+		Rejected []struct {
+			Line int    `json:"line"`
+			Text string `json:"text"`
+			Err  string `json:"error"`
+		} `json:"rejected"`
+	}
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		fmt.Println("Error decoding response:", err)
+		return
+	}
+	for _, task := range result.Tasks {
+		fmt.Printf("%s %s %s\n", task.RequestId, task.Hash, strings.Join(task.Users, ","))
+	}
+	for _, rejected := range result.Rejected {
+		fmt.Printf("Line %d rejected (%s): %s\n", rejected.Line, rejected.Err, rejected.Text)
+	}
+}
+
+func importPotfile(path string, algorithm string) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		fmt.Println("Error reading potfile:", err)
+		return
+	}
+	potfileURL := "http://localhost:8080/api/potfile"
+	if algorithm != "" {
+		potfileURL += "?algorithm=" + algorithm
+	}
+	resp, err := http.Post(potfileURL, "text/plain", bytes.NewReader(data))
+	if err != nil {
+		fmt.Println("Error sending potfile:", err)
+		return
+	}
+	defer resp.Body.Close()
+	respBody, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		fmt.Printf("Potfile import rejected (%d): %s", resp.StatusCode, respBody)
+		return
+	}
+	var result struct {
+		Imported int `json:"imported"`
+		Existing int `json:"existing"`
+		Rejected []struct {
+			Line int    `json:"line"`
+			Text string `json:"text"`
+			Err  string `json:"error"`
+		} `json:"rejected"`
+	}
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		fmt.Println("Error decoding response:", err)
+		return
+	}
+	fmt.Printf("Imported: %d, already known: %d\n", result.Imported, result.Existing)
+	for _, rejected := range result.Rejected {
+		fmt.Printf("Line %d rejected (%s): %s\n", rejected.Line, rejected.Err, rejected.Text)
+	}
+}
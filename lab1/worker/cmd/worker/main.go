@@ -3,6 +3,7 @@ package main
 import (
 	"log"
 	"worker/config"
+	"worker/control"
 	"worker/pool"
 	"worker/registration"
 	"worker/server"
@@ -19,6 +20,10 @@ func main() {
 	// Создаём пул воркеров
 	workerPool := pool.New(cfg)
 
+	// Heartbeat сообщает менеджеру, что воркер жив и какие части он перебирает
+	registry := control.NewRegistry()
+	go registration.SendHeartbeats(cfg, registry)
+
 	// Запускаем HTTP-сервер
-	server.Start(cfg, workerPool)
+	server.Start(cfg, workerPool, registry)
 }
@@ -3,31 +3,54 @@ package config
 import (
 	"log"
 	"os"
+	"runtime"
 	"strconv"
+	"time"
 )
 
 type Config struct {
 	MaxWorkers int
+	Threads    int // горутин, между которыми делится диапазон одной задачи
 	WorkerURL  string
 	ManagerURL string
 	Port       string
+	// HeartbeatInterval - период heartbeat менеджеру; менеджер считает воркер мёртвым, если heartbeat не приходит
+	HeartbeatInterval time.Duration
 }
 
 const (
 	defaultMaxWorkers = 10
 	defaultPort       = "8080"
+
+	defaultHeartbeatInterval = 5 * time.Second
 )
 
 func Load() *Config {
-	maxWorkers := defaultMaxWorkers
+	// По умолчанию одна задача занимает все ядра
+	threads := runtime.GOMAXPROCS(0)
+	if val := os.Getenv("WORKER_THREADS"); val != "" {
+		if parsed, err := strconv.Atoi(val); err == nil && parsed > 0 {
+			threads = parsed
+		} else {
+			log.Printf("Warning: Invalid WORKER_THREADS value: %s, using default: %d", val, threads)
+		}
+	}
+
+	// Каждая задача и так занимает threads горутин, поэтому по умолчанию воркер выполняет одну задачу за раз,
+	// а не defaultMaxWorkers*threads горутин; прежнее значение остаётся для WORKER_THREADS=1
+	defaultWorkers := defaultMaxWorkers
+	if threads > 1 {
+		defaultWorkers = 1
+	}
+	maxWorkers := defaultWorkers
 	if val := os.Getenv("MAX_WORKERS"); val != "" {
 		if parsed, err := strconv.Atoi(val); err == nil {
 			maxWorkers = parsed
 		} else {
-			log.Printf("Warning: Invalid MAX_WORKERS value: %s, using default: %d", val, defaultMaxWorkers)
+			log.Printf("Warning: Invalid MAX_WORKERS value: %s, using default: %d", val, defaultWorkers)
 		}
 	} else {
-		log.Printf("Info: MAX_WORKERS not set, using default: %d", defaultMaxWorkers)
+		log.Printf("Info: MAX_WORKERS not set, using default: %d", defaultWorkers)
 	}
 
 	workerURL := os.Getenv("WORKER_URL")
@@ -40,10 +63,22 @@ func Load() *Config {
 		port = defaultPort
 	}
 
+	heartbeatInterval := defaultHeartbeatInterval
+	if val := os.Getenv("HEARTBEAT_INTERVAL"); val != "" {
+		if parsed, err := time.ParseDuration(val); err == nil && parsed > 0 {
+			heartbeatInterval = parsed
+		} else {
+			log.Printf("Warning: Invalid HEARTBEAT_INTERVAL value: %s, using default: %s", val, defaultHeartbeatInterval)
+		}
+	}
+
 	return &Config{
 		MaxWorkers: maxWorkers,
+		Threads:    threads,
 		WorkerURL:  workerURL,
 		ManagerURL: managerURL,
 		Port:       port,
+
+		HeartbeatInterval: heartbeatInterval,
 	}
 }
@@ -0,0 +1,72 @@
+package control
+
+import (
+	"context"
+	"sync"
+)
+
+// Registry хранит части задач, которые воркер перебирает сейчас (ключ - algorithm:hash), и функции их отмены
+type Registry struct {
+	mu      sync.Mutex
+	nextID  uint64
+	running map[string]map[uint64]runningPart
+}
+
+type runningPart struct {
+	partNumber int
+	cancel     context.CancelFunc
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		running: make(map[string]map[uint64]runningPart),
+	}
+}
+
+// Start регистрирует часть partNumber задачи taskKey и возвращает контекст, который отменяется вместе с задачей.
+// done нужно вызвать по окончании перебора части
+func (r *Registry) Start(taskKey string, partNumber int) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.nextID++
+	id := r.nextID
+	if r.running[taskKey] == nil {
+		r.running[taskKey] = make(map[uint64]runningPart)
+	}
+	r.running[taskKey][id] = runningPart{partNumber: partNumber, cancel: cancel}
+
+	return ctx, func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		delete(r.running[taskKey], id)
+		if len(r.running[taskKey]) == 0 {
+			delete(r.running, taskKey)
+		}
+		cancel()
+	}
+}
+
+// Cancel прерывает все выполняющиеся части задачи taskKey и возвращает их количество
+func (r *Registry) Cancel(taskKey string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, part := range r.running[taskKey] {
+		part.cancel()
+	}
+	return len(r.running[taskKey])
+}
+
+// Parts возвращает номера частей, которые перебираются сейчас, по ключам задач
+func (r *Registry) Parts() map[string][]int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	parts := make(map[string][]int, len(r.running))
+	for taskKey, running := range r.running {
+		for _, part := range running {
+			parts[taskKey] = append(parts[taskKey], part.partNumber)
+		}
+	}
+	return parts
+}
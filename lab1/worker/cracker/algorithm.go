@@ -0,0 +1,73 @@
+package cracker
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"fmt"
+	"hash"
+	"strings"
+	"unicode/utf16"
+
+	"golang.org/x/crypto/md4"
+)
+
+// DefaultAlgorithm используется, если в задаче алгоритм не указан
+const DefaultAlgorithm = "md5"
+
+// Algorithm описывает хеш-функцию, которой может перебирать воркер
+type Algorithm struct {
+	Name string
+	Size int // размер дайджеста в байтах
+	New  func() hash.Hash
+}
+
+var algorithms = map[string]Algorithm{}
+
+func init() {
+	Register(Algorithm{Name: "md5", Size: md5.Size, New: md5.New})
+	Register(Algorithm{Name: "md4", Size: md4.Size, New: md4.New})
+	Register(Algorithm{Name: "sha1", Size: sha1.Size, New: sha1.New})
+	Register(Algorithm{Name: "sha256", Size: sha256.Size, New: sha256.New})
+	Register(Algorithm{Name: "sha512", Size: sha512.Size, New: sha512.New})
+	Register(Algorithm{Name: "ntlm", Size: md4.Size, New: newNTLM})
+}
+
+// Register добавляет алгоритм в реестр (или заменяет существующий с тем же именем)
+func Register(algorithm Algorithm) {
+	algorithms[strings.ToLower(algorithm.Name)] = algorithm
+}
+
+// GetAlgorithm возвращает алгоритм по имени; пустое имя означает DefaultAlgorithm
+func GetAlgorithm(name string) (Algorithm, error) {
+	if name == "" {
+		name = DefaultAlgorithm
+	}
+	algorithm, exists := algorithms[strings.ToLower(name)]
+	if !exists {
+		return Algorithm{}, fmt.Errorf("unsupported algorithm %q", name)
+	}
+	return algorithm, nil
+}
+
+// ntlmHash - NTLM это MD4 от пароля в кодировке UTF-16LE
+type ntlmHash struct {
+	hash.Hash
+}
+
+func newNTLM() hash.Hash {
+	return &ntlmHash{Hash: md4.New()}
+}
+
+func (h *ntlmHash) Write(p []byte) (int, error) {
+	units := utf16.Encode([]rune(string(p)))
+	encoded := make([]byte, 0, len(units)*2)
+	for _, unit := range units {
+		encoded = append(encoded, byte(unit), byte(unit>>8))
+	}
+	if _, err := h.Hash.Write(encoded); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -0,0 +1,68 @@
+package cracker
+
+import (
+	"bytes"
+	"common/keyspace"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"worker/models"
+)
+
+type BruteForceCracker struct {
+	alphabet  string
+	algorithm Algorithm
+	threads   int
+}
+
+// brute force cracker [a-z0-9] для заданного алгоритма хеширования
+func NewBruteForceCracker(algorithm Algorithm, threads int) *BruteForceCracker {
+	return &BruteForceCracker{
+		alphabet:  keyspace.DefaultAlphabet,
+		algorithm: algorithm,
+		threads:   threads,
+	}
+}
+
+// Crack перебирает назначенный диапазон номеров кандидатов. Пространство - все строки
+// длины от 1 до MaxLength подряд, номер переводится в строку в алфавитной системе счисления.
+func (c *BruteForceCracker) Crack(ctx context.Context, task models.CrackTaskRequest) (string, error) {
+	r, err := keyspace.ParseRange(task.RangeStart, task.RangeEnd)
+	if err != nil {
+		return "", err
+	}
+	space := keyspace.Space{Alphabet: c.alphabet, MinLength: 1, MaxLength: task.MaxLength}
+
+	log.Printf("Starting %s crack attempt for hash: %s (max length: %d, part: %d/%d, range: %s, threads: %d)",
+		c.algorithm.Name, task.Hash, task.MaxLength, task.PartNumber, task.PartCount, r, c.threads)
+
+	found, ok := crackRange(ctx, c.algorithm, space, r, task.Hash, c.threads)
+	switch {
+	case ok:
+		return found, nil
+	case ctx.Err() != nil:
+		return "", ErrCancelled
+	}
+	return "", fmt.Errorf("solution not found")
+}
+
+// crackRange хеширует всех кандидатов диапазона r в threads горутинах и возвращает первого,
+// чей хеш совпал с targetHash. Перебор прекращается при отмене ctx. Целевой хеш декодируется один раз, дальше сравниваются сырые дайджесты;
+// у каждой горутины свои хешер и буфер дайджеста, строка создаётся только для найденного кандидата.
+func crackRange(ctx context.Context, algorithm Algorithm, space keyspace.Enumerable, r keyspace.Range, targetHash string, threads int) (string, bool) {
+	target, err := hex.DecodeString(targetHash)
+	if err != nil || len(target) != algorithm.Size {
+		return "", false
+	}
+	return keyspace.Search(ctx, space, r, threads, func() func([]byte) bool {
+		hasher := algorithm.New()
+		sum := make([]byte, 0, algorithm.Size)
+		return func(candidate []byte) bool {
+			hasher.Reset()
+			hasher.Write(candidate)
+			sum = hasher.Sum(sum[:0])
+			return bytes.Equal(sum, target)
+		}
+	})
+}
@@ -1,9 +1,51 @@
 package cracker
 
 import (
+	"common/keyspace"
+	"common/mask"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
 	"worker/models"
 )
 
+// ErrCancelled возвращается Crack, если перебор прерван отменой задачи
+var ErrCancelled = errors.New("crack cancelled")
+
 type Cracker interface {
-	Crack(task models.CrackTaskRequest) (string, error)
+	Crack(ctx context.Context, task models.CrackTaskRequest) (string, error)
+}
+
+// New подбирает реализацию Cracker под алгоритм и режим атаки, указанные в задаче.
+// Диапазон задачи делится между threads горутинами.
+func New(task models.CrackTaskRequest, threads int) (Cracker, error) {
+	algorithm, err := GetAlgorithm(task.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+	if target, err := hex.DecodeString(task.Hash); err != nil || len(target) != algorithm.Size {
+		return nil, fmt.Errorf("invalid %s hash %q", algorithm.Name, task.Hash)
+	}
+	// Диапазон проверяем сразу, чтобы отклонить задачу до её постановки в работу: диапазон за пределами
+	// пространства перебрал бы не тех кандидатов, а менеджер счёл бы его проверенным
+	r, err := keyspace.ParseRange(task.RangeStart, task.RangeEnd)
+	if err != nil {
+		return nil, err
+	}
+	if task.Mask != "" {
+		m, err := mask.Parse(task.Mask, task.Charsets)
+		if err != nil {
+			return nil, err
+		}
+		if err := keyspace.CheckBounds(m, r); err != nil {
+			return nil, err
+		}
+		return NewMaskCracker(algorithm, m, threads), nil
+	}
+	space := keyspace.Space{Alphabet: keyspace.DefaultAlphabet, MinLength: 1, MaxLength: task.MaxLength}
+	if err := keyspace.CheckBounds(space, r); err != nil {
+		return nil, err
+	}
+	return NewBruteForceCracker(algorithm, threads), nil
 }
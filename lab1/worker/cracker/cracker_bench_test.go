@@ -0,0 +1,120 @@
+package cracker
+
+import (
+	"common/keyspace"
+	"common/mask"
+	"context"
+	"encoding/hex"
+	"math/big"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// benchTarget возвращает хеш, которого нет в перебираемых диапазонах: бенчмарки проходят диапазон целиком.
+func benchTarget(algorithm Algorithm) string {
+	return strings.Repeat("ff", algorithm.Size)
+}
+
+type benchSpace struct {
+	name  string
+	space keyspace.Enumerable
+}
+
+// benchSpaces - пространства, на которых сравниваются генераторы кандидатов.
+func benchSpaces(b *testing.B) []benchSpace {
+	m, err := mask.Parse("?u?l?l?l?l?d?d?s", nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+	return []benchSpace{
+		{"alphabet", keyspace.Space{Alphabet: keyspace.DefaultAlphabet, MinLength: 1, MaxLength: 7}},
+		{"mask", m},
+	}
+}
+
+// benchAlgorithms - алгоритмы, для которых измеряется скорость перебора.
+var benchAlgorithms = []string{"md5", "sha256", "ntlm"}
+
+// benchRange возвращает диапазон из n кандидатов в середине пространства.
+func benchRange(space keyspace.Enumerable, n int) keyspace.Range {
+	start := new(big.Int).Rsh(space.SizeBig(), 1)
+	return keyspace.Range{Start: start, End: new(big.Int).Add(start, big.NewInt(int64(n)))}
+}
+
+func reportHashRate(b *testing.B) {
+	b.ReportMetric(float64(b.N)/b.Elapsed().Seconds(), "hashes/s")
+}
+
+// BenchmarkLegacyDecode - прежняя схема: каждый кандидат заново вычисляется делением из номера,
+// превращается в строку, а дайджест кодируется в hex перед сравнением строк.
+func BenchmarkLegacyDecode(b *testing.B) {
+	for _, name := range benchAlgorithms {
+		algorithm, err := GetAlgorithm(name)
+		if err != nil {
+			b.Fatal(err)
+		}
+		targetHash := benchTarget(algorithm)
+		for _, bs := range benchSpaces(b) {
+			candidate := bs.space.(interface {
+				Candidate(index uint64, buf []byte) []byte
+			})
+			b.Run(name+"/"+bs.name, func(b *testing.B) {
+				hasher := algorithm.New()
+				start := benchRange(bs.space, 0).Start.Uint64()
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					word := string(candidate.Candidate(start+uint64(i), nil))
+					hasher.Reset()
+					hasher.Write([]byte(word))
+					if hex.EncodeToString(hasher.Sum(nil)) == targetHash {
+						b.Fatal("unexpected match")
+					}
+				}
+				reportHashRate(b)
+			})
+		}
+	}
+}
+
+// BenchmarkIterator - инкрементальный итератор с переиспользуемыми буферами и сравнением сырых дайджестов.
+func BenchmarkIterator(b *testing.B) {
+	for _, name := range benchAlgorithms {
+		algorithm, err := GetAlgorithm(name)
+		if err != nil {
+			b.Fatal(err)
+		}
+		targetHash := benchTarget(algorithm)
+		for _, bs := range benchSpaces(b) {
+			b.Run(name+"/"+bs.name, func(b *testing.B) {
+				r := benchRange(bs.space, b.N)
+				b.ResetTimer()
+				if _, ok := crackRange(context.Background(), algorithm, bs.space, r, targetHash, 1); ok {
+					b.Fatal("unexpected match")
+				}
+				reportHashRate(b)
+			})
+		}
+	}
+}
+
+// BenchmarkIteratorParallel - итератор, когда диапазон делится между GOMAXPROCS горутинами.
+func BenchmarkIteratorParallel(b *testing.B) {
+	for _, name := range benchAlgorithms {
+		algorithm, err := GetAlgorithm(name)
+		if err != nil {
+			b.Fatal(err)
+		}
+		targetHash := benchTarget(algorithm)
+		for _, bs := range benchSpaces(b) {
+			b.Run(name+"/"+bs.name, func(b *testing.B) {
+				r := benchRange(bs.space, b.N)
+				b.ResetTimer()
+				if _, ok := crackRange(context.Background(), algorithm, bs.space, r, targetHash, runtime.GOMAXPROCS(0)); ok {
+					b.Fatal("unexpected match")
+				}
+				reportHashRate(b)
+			})
+		}
+	}
+}
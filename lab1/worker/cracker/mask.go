@@ -0,0 +1,44 @@
+package cracker
+
+import (
+	"common/keyspace"
+	"common/mask"
+	"context"
+	"fmt"
+	"log"
+	"worker/models"
+)
+
+// MaskCracker перебирает кандидатов, заданных маской (?l?u?d?s?a, ?1..?4 и литералы)
+type MaskCracker struct {
+	mask      *mask.Mask
+	algorithm Algorithm
+	threads   int
+}
+
+func NewMaskCracker(algorithm Algorithm, m *mask.Mask, threads int) *MaskCracker {
+	return &MaskCracker{
+		mask:      m,
+		algorithm: algorithm,
+		threads:   threads,
+	}
+}
+
+func (c *MaskCracker) Crack(ctx context.Context, task models.CrackTaskRequest) (string, error) {
+	r, err := keyspace.ParseRange(task.RangeStart, task.RangeEnd)
+	if err != nil {
+		return "", err
+	}
+
+	log.Printf("Starting %s mask crack attempt for hash: %s (mask: %s, keyspace: %s, part: %d/%d, range: %s, threads: %d)",
+		c.algorithm.Name, task.Hash, task.Mask, c.mask.SizeBig(), task.PartNumber, task.PartCount, r, c.threads)
+
+	found, ok := crackRange(ctx, c.algorithm, c.mask, r, task.Hash, c.threads)
+	switch {
+	case ok:
+		return found, nil
+	case ctx.Err() != nil:
+		return "", ErrCancelled
+	}
+	return "", fmt.Errorf("solution not found")
+}
@@ -2,6 +2,9 @@ module worker
 
 go 1.21
 
-require common v0.0.0
+require (
+	common v0.0.0
+	golang.org/x/crypto v0.26.0
+)
 
 replace common => ../common
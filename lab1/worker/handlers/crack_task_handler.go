@@ -3,9 +3,11 @@ package handlers
 import (
 	"common/utils"
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
 	"time"
+	"worker/control"
 	"worker/cracker"
 	"worker/models"
 	"worker/pool"
@@ -17,9 +19,10 @@ const (
 	retryDelay = time.Second
 )
 
-var md5Cracker = cracker.NewMD5Cracker()
-
-func CreateCrackTaskHandler(workerPool *pool.WorkerPool) http.HandlerFunc {
+// CreateCrackTaskHandler принимает задачи от менеджера; диапазон каждой задачи перебирается в threads горутинах.
+// Выполняющиеся части регистрируются в registry, чтобы их можно было прервать по команде менеджера
+// и сообщать о них в heartbeat. workerURL передаётся менеджеру вместе с результатом
+func CreateCrackTaskHandler(workerPool *pool.WorkerPool, registry *control.Registry, threads int, workerURL string) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
 			log.Printf("Invalid method %s for crack task", r.Method)
@@ -34,6 +37,14 @@ func CreateCrackTaskHandler(workerPool *pool.WorkerPool) http.HandlerFunc {
 			return
 		}
 
+		taskCracker, err := cracker.New(task, threads)
+		if err != nil {
+			log.Printf("Rejecting task for hash %s (part %d/%d): %v",
+				task.Hash, task.PartNumber, task.PartCount, err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
 		if !workerPool.Acquire() {
 			log.Printf("No available workers for hash %s (part %d/%d)",
 				task.Hash, task.PartNumber, task.PartCount)
@@ -41,21 +52,36 @@ func CreateCrackTaskHandler(workerPool *pool.WorkerPool) http.HandlerFunc {
 			return
 		}
 
+		// Регистрируем часть до ответа менеджеру, чтобы отмена, пришедшая сразу после, её застала
+		ctx, done := registry.Start(models.TaskKey(task.Algorithm, task.Hash), task.PartNumber)
 		go func() {
 			defer workerPool.Release()
+			defer done()
 
 			log.Printf("Starting crack attempt for hash %s (part %d/%d)",
 				task.Hash, task.PartNumber, task.PartCount)
 
-			result, err := md5Cracker.Crack(task)
+			result, err := taskCracker.Crack(ctx, task)
+			if errors.Is(err, cracker.ErrCancelled) {
+				log.Printf("Crack cancelled for hash %s (part %d/%d)",
+					task.Hash, task.PartNumber, task.PartCount)
+				sendResult(models.CrackTaskResult{
+					Hash:       task.Hash,
+					Algorithm:  task.Algorithm,
+					PartNumber: task.PartNumber,
+					Cancelled:  true,
+				}, workerURL)
+				return
+			}
 			if err != nil {
 				log.Printf("Crack failed for hash %s (part %d/%d): %v",
 					task.Hash, task.PartNumber, task.PartCount, err)
 				sendResult(models.CrackTaskResult{
 					Hash:       task.Hash,
+					Algorithm:  task.Algorithm,
 					Result:     "",
 					PartNumber: task.PartNumber,
-				}, r.Host)
+				}, workerURL)
 				return
 			}
 
@@ -64,16 +90,39 @@ func CreateCrackTaskHandler(workerPool *pool.WorkerPool) http.HandlerFunc {
 
 			sendResult(models.CrackTaskResult{
 				Hash:       task.Hash,
+				Algorithm:  task.Algorithm,
 				Result:     result,
 				PartNumber: task.PartNumber,
-			}, r.Host)
+			}, workerURL)
 		}()
 
 		w.WriteHeader(http.StatusOK)
 	}
 }
 
+// CreateCancelTaskHandler прерывает все выполняющиеся на воркере части задачи
+func CreateCancelTaskHandler(registry *control.Registry) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var request models.CancelTaskRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			log.Printf("Failed to decode cancel request: %v", err)
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		cancelled := registry.Cancel(models.TaskKey(request.Algorithm, request.Hash))
+		log.Printf("Cancelled %d running parts for hash %s", cancelled, request.Hash)
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
 func sendResult(result models.CrackTaskResult, workerURL string) {
+	result.WorkerURL = workerURL
 	req := utils.SendRequest{
 		URL:     managerURL,
 		Payload: result,
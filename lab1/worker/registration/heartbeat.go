@@ -0,0 +1,57 @@
+package registration
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+	"worker/config"
+	"worker/control"
+	"worker/models"
+)
+
+// SendHeartbeats каждые cfg.HeartbeatInterval сообщает менеджеру, что воркер жив и какие части он перебирает:
+// по heartbeat менеджер продлевает аренду этих частей. Если менеджер не знает воркер (перезапустился
+// или исключил воркер, не дождавшись heartbeat), воркер регистрируется заново
+func SendHeartbeats(cfg *config.Config, registry *control.Registry) {
+	ticker := time.NewTicker(cfg.HeartbeatInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		heartbeat := models.Heartbeat{WorkerURL: cfg.WorkerURL, Parts: []models.RunningPart{}}
+		for taskKey, parts := range registry.Parts() {
+			for _, part := range parts {
+				heartbeat.Parts = append(heartbeat.Parts, models.RunningPart{TaskKey: taskKey, PartNumber: part})
+			}
+		}
+
+		status, err := postHeartbeat(cfg.ManagerURL, heartbeat)
+		if err != nil {
+			log.Printf("Failed to send heartbeat: %v", err)
+			continue
+		}
+		if status == http.StatusNotFound {
+			log.Printf("Manager does not know this worker, registering again")
+			if err := RegisterWithManager(cfg); err != nil {
+				log.Printf("Failed to register with manager: %v", err)
+			}
+		} else if status != http.StatusOK {
+			log.Printf("Heartbeat rejected with status %d", status)
+		}
+	}
+}
+
+func postHeartbeat(managerURL string, heartbeat models.Heartbeat) (int, error) {
+	data, err := json.Marshal(heartbeat)
+	if err != nil {
+		return 0, err
+	}
+	client := http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Post(managerURL+"/internal/api/worker/heartbeat", "application/json", bytes.NewReader(data))
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	return resp.StatusCode, nil
+}
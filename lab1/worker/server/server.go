@@ -4,14 +4,16 @@ import (
 	"log"
 	"net/http"
 	"worker/config"
+	"worker/control"
 	"worker/handlers"
 	"worker/pool"
 )
 
-func Start(cfg *config.Config, workerPool *pool.WorkerPool) {
-	http.HandleFunc("/internal/api/worker/hash/crack/task", handlers.CreateCrackTaskHandler(workerPool))
+func Start(cfg *config.Config, workerPool *pool.WorkerPool, registry *control.Registry) {
+	http.HandleFunc("/internal/api/worker/hash/crack/task", handlers.CreateCrackTaskHandler(workerPool, registry, cfg.Threads, cfg.WorkerURL))
+	http.HandleFunc("/internal/api/worker/hash/crack/cancel", handlers.CreateCancelTaskHandler(registry))
 
-	log.Printf("Starting worker server on port %s with %d max workers", cfg.Port, cfg.MaxWorkers)
+	log.Printf("Starting worker server on port %s with %d max workers, %d threads per task", cfg.Port, cfg.MaxWorkers, cfg.Threads)
 	if err := http.ListenAndServe(":"+cfg.Port, nil); err != nil {
 		log.Fatal(err)
 	}
@@ -0,0 +1,89 @@
+package amqputil
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+// confirmBuffer - сколько подтверждений может ждать чтения: опоздавшие подтверждения
+// читаются только при следующей публикации, а переполненный буфер остановил бы соединение.
+const confirmBuffer = 64
+
+var (
+	// ErrNotConfirmed возвращается, если брокер отказался принять сообщение (basic.nack).
+	ErrNotConfirmed = errors.New("сообщение не принято брокером")
+	// ErrConfirmTimeout возвращается, если подтверждение не пришло вовремя. Сообщение могло быть
+	// доставлено, поэтому получатель должен обрабатывать повторы.
+	ErrConfirmTimeout = errors.New("истекло время ожидания подтверждения")
+	// ErrPublisherClosed возвращается после закрытия канала публикатора.
+	ErrPublisherClosed = errors.New("канал публикатора закрыт")
+)
+
+// ConfirmPublisher публикует сообщения через канал в режиме подтверждений (publisher confirms):
+// Publish возвращает nil, только когда брокер подтвердил, что принял сообщение. Персистентное сообщение
+// в durable-очереди брокер подтверждает после записи на диск, поэтому оно переживает перезапуск RabbitMQ.
+// Публикации выполняются по одной; безопасен для использования из нескольких горутин.
+type ConfirmPublisher struct {
+	mu       sync.Mutex
+	ch       *amqp.Channel
+	confirms chan amqp.Confirmation
+	timeout  time.Duration
+	sent     uint64 // delivery tag последнего опубликованного сообщения
+	broken   bool   // канал закрыт или публикация в него не удалась
+}
+
+// NewConfirmPublisher включает на канале режим подтверждений. Через канал можно и дальше получать
+// и подтверждать сообщения; публиковать нужно только через ConfirmPublisher.
+// timeout ограничивает ожидание подтверждения каждого сообщения.
+func NewConfirmPublisher(ch *amqp.Channel, timeout time.Duration) (*ConfirmPublisher, error) {
+	if err := ch.Confirm(false); err != nil {
+		return nil, fmt.Errorf("включение режима подтверждений: %w", err)
+	}
+	return &ConfirmPublisher{
+		ch:       ch,
+		confirms: ch.NotifyPublish(make(chan amqp.Confirmation, confirmBuffer)),
+		timeout:  timeout,
+	}, nil
+}
+
+// Publish публикует сообщение и ждёт его подтверждения. Подтверждения сопоставляются по delivery tag:
+// опоздавшее подтверждение сообщения, ожидание которого прервано по таймауту, пропускается.
+// После ErrPublisherClosed или ошибки публикации канал непригоден, и нужен новый.
+func (p *ConfirmPublisher) Publish(exchange, key string, msg amqp.Publishing) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.broken {
+		return ErrPublisherClosed
+	}
+
+	if err := p.ch.Publish(exchange, key, false, false, msg); err != nil {
+		p.broken = true
+		return err
+	}
+	p.sent++
+
+	timer := time.NewTimer(p.timeout)
+	defer timer.Stop()
+	for {
+		select {
+		case confirm, ok := <-p.confirms:
+			if !ok {
+				p.broken = true
+				return ErrPublisherClosed
+			}
+			if confirm.DeliveryTag < p.sent {
+				continue // подтверждение сообщения, ожидание которого уже прервано
+			}
+			if !confirm.Ack {
+				return ErrNotConfirmed
+			}
+			return nil
+		case <-timer.C:
+			return ErrConfirmTimeout
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package amqputil
+
+import (
+	"fmt"
+	"time"
+
+	"common/constants"
+	"common/logger"
+
+	"github.com/streadway/amqp"
+)
+
+// Заголовки сообщений, отправленных в очередь недоставленных или повторно в рабочую очередь.
+const (
+	HeaderReason        = "x-reject-reason"  // почему сообщение не удалось обработать
+	HeaderOriginalQueue = "x-original-queue" // очередь, из которой сообщение попало в DLQ
+	HeaderRejectedAt    = "x-rejected-at"    // время отправки в DLQ (RFC 3339)
+	HeaderRetryCount    = "x-retry-count"    // сколько раз обработка завершилась временной ошибкой
+	HeaderRejectedBy    = "x-rejected-by"    // компонент, отклонивший сообщение
+	deadLetterSuffix    = ".dead"            // имя DLQ - имя рабочей очереди с этим суффиксом
+)
+
+// DeadLetterQueue возвращает имя очереди недоставленных сообщений для рабочей очереди queueName.
+func DeadLetterQueue(queueName string) string {
+	return queueName + deadLetterSuffix
+}
+
+// DeclareQueue объявляет durable-очередь queueName и её очередь недоставленных сообщений: обменник
+// constants.DeadLetterExchange и очередь DeadLetterQueue(queueName). Рабочая очередь объявляется без аргументов
+// x-dead-letter-*: их нельзя изменить у существующей очереди, и повторное объявление очереди, созданной
+// прежней версией, завершилось бы PRECONDITION_FAILED. Перенаправление сообщений, отклонённых без возврата
+// в очередь, в DLQ настраивает политика брокера (см. rabbitmq/policies.sh).
+func DeclareQueue(ch *amqp.Channel, queueName string) error {
+	if err := ch.ExchangeDeclare(constants.DeadLetterExchange, "direct", true, false, false, false, nil); err != nil {
+		return fmt.Errorf("объявление обменника '%s': %w", constants.DeadLetterExchange, err)
+	}
+	dlq := DeadLetterQueue(queueName)
+	if _, err := ch.QueueDeclare(dlq, true, false, false, false, nil); err != nil {
+		return fmt.Errorf("объявление очереди '%s': %w", dlq, err)
+	}
+	if err := ch.QueueBind(dlq, dlq, constants.DeadLetterExchange, false, nil); err != nil {
+		return fmt.Errorf("привязка очереди '%s': %w", dlq, err)
+	}
+	if _, err := ch.QueueDeclare(queueName, true, false, false, false, nil); err != nil {
+		return fmt.Errorf("объявление очереди '%s': %w", queueName, err)
+	}
+	return nil
+}
+
+// RetryCount возвращает значение заголовка HeaderRetryCount сообщения (0, если его нет).
+func RetryCount(headers amqp.Table) int {
+	switch v := headers[HeaderRetryCount].(type) {
+	case int32:
+		return int(v)
+	case int64:
+		return int(v)
+	case int:
+		return v
+	}
+	return 0
+}
+
+// HeaderString возвращает строковый заголовок сообщения или пустую строку.
+func HeaderString(headers amqp.Table, name string) string {
+	s, _ := headers[name].(string)
+	return s
+}
+
+// Reject отправляет сообщение из очереди queueName в её DLQ с причиной reason и подтверждает исходное.
+// Если DLQ недоступна, сообщение отклоняется без возврата в очередь: брокер перенаправит его
+// в DLQ по политике dead-letter-exchange, но уже без заголовка с причиной.
+func Reject(pub *ConfirmPublisher, d amqp.Delivery, queueName, component, reason string) {
+	headers := copyHeaders(d.Headers)
+	headers[HeaderReason] = reason
+	headers[HeaderOriginalQueue] = queueName
+	headers[HeaderRejectedAt] = time.Now().UTC().Format(time.RFC3339)
+	headers[HeaderRejectedBy] = component
+
+	err := pub.Publish(constants.DeadLetterExchange, DeadLetterQueue(queueName), republishing(d, headers))
+	if err != nil {
+		logger.Log(component, fmt.Sprintf("Не удалось отправить сообщение в %s: %v", DeadLetterQueue(queueName), err))
+		_ = d.Nack(false, false)
+		return
+	}
+	logger.Log(component, fmt.Sprintf("Сообщение отправлено в %s: %s", DeadLetterQueue(queueName), reason))
+	_ = d.Ack(false)
+}
+
+// Retry возвращает сообщение, обработка которого завершилась временной ошибкой, в конец очереди queueName
+// с увеличенным счётчиком HeaderRetryCount. После constants.MaxMessageRetries попыток сообщение
+// отправляется в DLQ. Если опубликовать копию не удалось, исходное сообщение возвращается в очередь.
+func Retry(pub *ConfirmPublisher, d amqp.Delivery, queueName, component, reason string) {
+	retries := RetryCount(d.Headers) + 1
+	if retries > constants.MaxMessageRetries {
+		Reject(pub, d, queueName, component, fmt.Sprintf("%s (попыток: %d)", reason, retries))
+		return
+	}
+	headers := copyHeaders(d.Headers)
+	headers[HeaderRetryCount] = int32(retries)
+
+	if err := pub.Publish("", queueName, republishing(d, headers)); err != nil {
+		logger.Log(component, fmt.Sprintf("Не удалось вернуть сообщение в очередь '%s': %v", queueName, err))
+		_ = d.Nack(false, true)
+		return
+	}
+	logger.Log(component, fmt.Sprintf("Временная ошибка, сообщение возвращено в очередь '%s' (попытка %d из %d): %s",
+		queueName, retries, constants.MaxMessageRetries, reason))
+	_ = d.Ack(false)
+}
+
+// republishing возвращает копию полученного сообщения для повторной публикации с заголовками headers.
+func republishing(d amqp.Delivery, headers amqp.Table) amqp.Publishing {
+	return amqp.Publishing{
+		Headers:      headers,
+		ContentType:  d.ContentType,
+		DeliveryMode: amqp.Persistent,
+		MessageId:    d.MessageId,
+		Timestamp:    d.Timestamp,
+		Body:         d.Body,
+	}
+}
+
+// copyHeaders возвращает копию заголовков, в которую можно добавлять новые.
+func copyHeaders(headers amqp.Table) amqp.Table {
+	out := make(amqp.Table, len(headers)+4)
+	for k, v := range headers {
+		out[k] = v
+	}
+	return out
+}
@@ -2,89 +2,43 @@ package amqputil
 
 import (
 	"fmt"
-	"time"
 
 	"common/constants"
-	"common/logger"
 	"github.com/streadway/amqp"
 )
 
-// Максимальное количество попыток повторения операции
-const DefaultMaxRetries = 5
-
-// ConnectRabbitMQ пытается установить соединение с RabbitMQ по указанному URI.
-// Будет повторять попытки соединения до фиксированного количества раз, прежде чем вернуть ошибку.
-func ConnectRabbitMQ(uri string) (*amqp.Connection, error) {
-	const maxRetries = constants.DefaultConnectRetries
-	var conn *amqp.Connection
-	var err error
-	for i := 0; i < maxRetries; i++ {
-		conn, err = amqp.Dial(uri)
-		if err == nil {
-			logger.Log("RabbitMQ", "Соединение с RabbitMQ установлено")
-			return conn, nil
+// DeclareTopology объявляет всё, чем пользуются менеджер и воркеры: очереди "tasks" и "results"
+// (с очередями недоставленных сообщений, см. DeclareQueue) и обменник "control".
+// Передаётся в NewSession, поэтому повторяется после каждого переподключения.
+func DeclareTopology(ch *amqp.Channel) error {
+	for _, queue := range []string{constants.TasksQueue, constants.ResultsQueue} {
+		if err := DeclareQueue(ch, queue); err != nil {
+			return err
 		}
-		logger.Log("RabbitMQ", fmt.Sprintf("Ошибка подключения (попытка %d/%d): %v", i+1, maxRetries, err))
-		time.Sleep(constants.ContextTimeout)
 	}
-	return nil, err
+	if err := DeclareControlExchange(ch); err != nil {
+		return fmt.Errorf("объявление обменника '%s': %w", constants.ControlExchange, err)
+	}
+	return nil
 }
 
-// CreateChannel открывает новый канал на указанном AMQP-соединении, объявляет очередь
-// и применяет настройки QoS, если они указаны.
-func CreateChannel(conn *amqp.Connection, queueName string, qos int) (*amqp.Channel, error) {
-	var ch *amqp.Channel
-	var err error
-	for attempt := 1; attempt <= constants.DefaultChannelRetries; attempt++ {
-		// Пробуем открыть канал
-		ch, err = conn.Channel()
-		if err != nil {
-			logger.Log("RabbitMQ", fmt.Sprintf("Ошибка открытия канала: %v. Повтор через 5 секунд... (Попытка %d/%d)", err, attempt, constants.DefaultChannelRetries))
-			if attempt >= constants.DefaultChannelRetries {
-				return nil, err
-			}
-			time.Sleep(constants.ContextTimeout)
-			continue
-		}
-		// Объявляем очередь
-		_, err = ch.QueueDeclare(queueName, true, false, false, false, nil)
-		if err != nil {
-			logger.Log("RabbitMQ", fmt.Sprintf("Ошибка объявления очереди '%s': %v. Повтор через 5 секунд... (Попытка %d/%d)", queueName, err, attempt, constants.DefaultChannelRetries))
-			_ = ch.Close()
-			if attempt >= constants.DefaultChannelRetries {
-				return nil, err
-			}
-			time.Sleep(constants.ContextTimeout)
-			continue
-		}
-		// Устанавливаем QoS (prefetch count), если запрошен
-		if qos > 0 {
-			if err = ch.Qos(qos, 0, false); err != nil {
-				logger.Log("RabbitMQ", fmt.Sprintf("Ошибка установки QoS: %v. Повтор через 5 секунд... (Попытка %d/%d)", err, attempt, constants.DefaultChannelRetries))
-				_ = ch.Close()
-				if attempt >= constants.DefaultChannelRetries {
-					return nil, err
-				}
-				time.Sleep(constants.ContextTimeout)
-				continue
-			}
-		}
-		return ch, nil
-	}
-	return nil, fmt.Errorf("не удалось создать канал RabbitMQ")
+// DeclareControlExchange объявляет fanout-обменник для управляющих сообщений (например, отмены задач).
+func DeclareControlExchange(ch *amqp.Channel) error {
+	return ch.ExchangeDeclare(constants.ControlExchange, "fanout", true, false, false, false, nil)
 }
 
-// Reconnect проверяет, открыто ли AMQP-соединение (переподключается при необходимости),
-// а затем создает новый канал и объявляет очередь.
-func Reconnect(connPtr **amqp.Connection, uri, queueName string, qos int, maxAttempts int) (*amqp.Channel, error) {
-	// Если соединение закрыто или отсутствует, пытаемся переподключиться
-	if *connPtr == nil || (*connPtr).IsClosed() {
-		newConn, err := ConnectRabbitMQ(uri)
-		if err != nil {
-			return nil, err
-		}
-		*connPtr = newConn
+// ConsumeControl создаёт для воркера собственную временную очередь, привязанную к обменнику "control",
+// и подписывается на неё. Очередь удаляется вместе с каналом, поэтому сообщения получают только подключённые воркеры.
+func ConsumeControl(ch *amqp.Channel) (<-chan amqp.Delivery, error) {
+	if err := DeclareControlExchange(ch); err != nil {
+		return nil, fmt.Errorf("объявление обменника '%s': %w", constants.ControlExchange, err)
+	}
+	q, err := ch.QueueDeclare("", false, true, true, false, nil)
+	if err != nil {
+		return nil, fmt.Errorf("объявление управляющей очереди: %w", err)
+	}
+	if err := ch.QueueBind(q.Name, "", constants.ControlExchange, false, nil); err != nil {
+		return nil, fmt.Errorf("привязка управляющей очереди: %w", err)
 	}
-	// Создаем канал на активном соединении
-	return CreateChannel(*connPtr, queueName, qos)
+	return ch.Consume(q.Name, "", true, true, false, false, nil)
 }
@@ -0,0 +1,204 @@
+package amqputil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"common/logger"
+
+	"github.com/streadway/amqp"
+)
+
+const (
+	// Задержки переподключения и перезапуска: экспоненциальный рост от backoffBase до backoffMax со случайным разбросом
+	backoffBase = 500 * time.Millisecond
+	backoffMax  = 30 * time.Second
+	// Канал, проработавший дольше, считается здоровым: следующий перезапуск начинается с минимальной задержки
+	healthyRun = time.Minute
+)
+
+// ErrSessionClosed возвращается после закрытия сессии.
+var ErrSessionClosed = errors.New("сессия RabbitMQ закрыта")
+
+// Session владеет соединением с RabbitMQ: следит за ним через NotifyClose, переподключается
+// с экспоненциальной задержкой и случайным разбросом и после каждого подключения заново объявляет
+// топологию (очереди и обменники). Компоненты не держат соединение сами, а получают собственные
+// каналы через Channel или Run, поэтому один канал не используется несколькими горутинами.
+type Session struct {
+	uri      string
+	topology func(ch *amqp.Channel) error
+
+	mu    sync.Mutex
+	conn  *amqp.Connection // nil, пока соединения нет
+	ready chan struct{}    // закрывается, когда соединение установлено
+	done  chan struct{}    // закрывается при закрытии сессии
+	once  sync.Once
+}
+
+// NewSession создаёт сессию и начинает подключаться к RabbitMQ в фоне.
+// topology вызывается на новом канале после каждого подключения; nil - объявлять нечего.
+func NewSession(uri string, topology func(ch *amqp.Channel) error) *Session {
+	s := &Session{
+		uri:      uri,
+		topology: topology,
+		ready:    make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go s.supervise()
+	return s
+}
+
+// supervise поддерживает соединение, пока сессия не закрыта.
+func (s *Session) supervise() {
+	attempt := 0
+	for {
+		conn, err := s.connect()
+		if err != nil {
+			delay := Backoff(attempt)
+			attempt++
+			logger.Log("RabbitMQ", fmt.Sprintf("Ошибка подключения (попытка %d): %v. Повтор через %s", attempt, err, delay.Round(time.Millisecond)))
+			if !s.sleep(delay) {
+				return
+			}
+			continue
+		}
+		attempt = 0
+		closed := conn.NotifyClose(make(chan *amqp.Error, 1))
+
+		s.mu.Lock()
+		s.conn = conn
+		close(s.ready)
+		s.mu.Unlock()
+		logger.Log("RabbitMQ", "Соединение с RabbitMQ установлено")
+
+		select {
+		case amqpErr := <-closed:
+			s.mu.Lock()
+			s.conn = nil
+			s.ready = make(chan struct{})
+			s.mu.Unlock()
+			logger.Log("RabbitMQ", fmt.Sprintf("Соединение с RabbitMQ потеряно: %v", amqpErr))
+		case <-s.done:
+			_ = conn.Close()
+			return
+		}
+	}
+}
+
+// connect подключается к брокеру и объявляет топологию.
+func (s *Session) connect() (*amqp.Connection, error) {
+	conn, err := amqp.Dial(s.uri)
+	if err != nil {
+		return nil, err
+	}
+	if s.topology == nil {
+		return conn, nil
+	}
+	ch, err := conn.Channel()
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	defer ch.Close()
+	if err := s.topology(ch); err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("объявление топологии: %w", err)
+	}
+	return conn, nil
+}
+
+// Channel открывает новый канал, дожидаясь соединения не дольше, чем позволяет ctx.
+// Закрывать канал должен получатель.
+func (s *Session) Channel(ctx context.Context) (*amqp.Channel, error) {
+	for attempt := 0; ; attempt++ {
+		s.mu.Lock()
+		conn, ready := s.conn, s.ready
+		s.mu.Unlock()
+
+		if conn != nil {
+			ch, err := conn.Channel()
+			if err == nil {
+				return ch, nil
+			}
+			// Соединение закрывается: supervise скоро заменит его
+			select {
+			case <-time.After(Backoff(attempt)):
+				continue
+			case <-ctx.Done():
+				return nil, err
+			case <-s.done:
+				return nil, ErrSessionClosed
+			}
+		}
+		select {
+		case <-ready:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-s.done:
+			return nil, ErrSessionClosed
+		}
+	}
+}
+
+// Run вызывает fn с новым каналом и повторяет вызов каждый раз, когда fn завершилась (канал или соединение
+// закрыты, либо fn вернула ошибку), пока сессия не закрыта. Перед повтором выдерживается пауза
+// с экспоненциальной задержкой. Канал закрывается после возврата fn. Run блокируется до закрытия сессии.
+func (s *Session) Run(name string, fn func(ch *amqp.Channel) error) {
+	attempt := 0
+	for {
+		ch, err := s.Channel(context.Background())
+		if err != nil {
+			return // сессия закрыта
+		}
+		started := time.Now()
+		err = fn(ch)
+		_ = ch.Close()
+
+		if time.Since(started) > healthyRun {
+			attempt = 0
+		}
+		delay := Backoff(attempt)
+		attempt++
+		if err != nil {
+			logger.Log(name, fmt.Sprintf("Канал RabbitMQ завершён с ошибкой: %v. Перезапуск через %s", err, delay.Round(time.Millisecond)))
+		} else {
+			logger.Log(name, fmt.Sprintf("Канал RabbitMQ закрыт. Перезапуск через %s", delay.Round(time.Millisecond)))
+		}
+		if !s.sleep(delay) {
+			return
+		}
+	}
+}
+
+// Close закрывает соединение и останавливает переподключение. Run и Channel после этого возвращаются.
+func (s *Session) Close() {
+	s.once.Do(func() { close(s.done) })
+}
+
+// sleep ждёт delay и возвращает false, если сессия закрыта раньше.
+func (s *Session) sleep(delay time.Duration) bool {
+	select {
+	case <-time.After(delay):
+		return true
+	case <-s.done:
+		return false
+	}
+}
+
+// Backoff возвращает задержку перед попыткой attempt (с нуля): backoffBase*2^attempt, но не больше backoffMax,
+// из которой случайна вторая половина, чтобы переподключающиеся компоненты не приходили к брокеру одновременно.
+func Backoff(attempt int) time.Duration {
+	delay := backoffMax
+	if attempt < 16 {
+		delay = backoffBase << uint(attempt)
+		if delay > backoffMax {
+			delay = backoffMax
+		}
+	}
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
@@ -0,0 +1,189 @@
+package hashlist
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Форматы строк списка хешей
+const (
+	FormatHash     = "hash"      // только хеш (hashcat)
+	FormatUserHash = "user:hash" // имя пользователя и хеш (John the Ripper; поля после хеша игнорируются)
+	FormatPwdump   = "pwdump"    // user:uid:lm:ntlm::: (выгрузка SAM)
+	FormatHashSalt = "hash:salt" // хеш с солью (hashcat)
+)
+
+// johnTags - префиксы, которыми John the Ripper помечает формат хеша, и алгоритм каждого из них.
+var johnTags = map[string]string{
+	"$NT$":         "ntlm",
+	"$LM$":         "lm",
+	"$dynamic_0$":  "md5",
+	"$SHA1$":       "sha1",
+	"$SHA256$":     "sha256",
+	"$SHA512$":     "sha512",
+	"$MD4$":        "md4",
+	"$raw-md5$":    "md5",
+	"$raw-sha1$":   "sha1",
+	"$raw-sha256$": "sha256",
+}
+
+// Options задаёт, какие хеши ожидаются в списке.
+type Options struct {
+	Algorithm string // алгоритм задачи: проверяется для pwdump и тегов John
+	HexLength int    // длина hex-представления хеша алгоритма
+	AllowSalt bool   // принимать строки hash:salt (иначе они считаются ошибочными)
+}
+
+// Entry - разобранная строка списка.
+type Entry struct {
+	Line   int    `json:"line"`
+	User   string `json:"user,omitempty"`
+	Hash   string `json:"hash"` // hex в нижнем регистре
+	Salt   string `json:"salt,omitempty"`
+	Format string `json:"format"`
+}
+
+// LineError - строка списка, которую не удалось разобрать.
+type LineError struct {
+	Line int    `json:"line"`
+	Text string `json:"text"`
+	Err  string `json:"error"`
+}
+
+func (e LineError) Error() string {
+	return fmt.Sprintf("строка %d: %s", e.Line, e.Err)
+}
+
+// Parse читает список хешей по одному в строке. Пустые строки и комментарии (#) пропускаются.
+// Ошибочные строки не прерывают разбор, а возвращаются отдельно; ошибка возвращается только при сбое чтения.
+func Parse(r io.Reader, opts Options) ([]Entry, []LineError, error) {
+	var entries []Entry
+	var rejected []LineError
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		entry, err := ParseLine(text, opts)
+		if err != nil {
+			rejected = append(rejected, LineError{Line: line, Text: text, Err: err.Error()})
+			continue
+		}
+		entry.Line = line
+		entries = append(entries, entry)
+	}
+	return entries, rejected, scanner.Err()
+}
+
+// ParseLine разбирает одну строку в любом из поддерживаемых форматов и нормализует хеш.
+// Формат определяется по полям, разделённым ':':
+//   - одно поле - хеш;
+//   - user:uid:lm:ntlm::: - pwdump, берётся NTLM-хеш;
+//   - второе поле - хеш: user:hash (остальные поля, как в passwd-формате John, игнорируются);
+//   - первое поле - хеш, второе нет: hash:salt.
+func ParseLine(line string, opts Options) (Entry, error) {
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return Entry{}, fmt.Errorf("пустая строка")
+	}
+	fields := strings.Split(line, ":")
+
+	if len(fields) == 1 {
+		hash, err := normalize(fields[0], opts)
+		if err != nil {
+			return Entry{}, err
+		}
+		return Entry{Hash: hash, Format: FormatHash}, nil
+	}
+
+	if isPwdump(fields) {
+		if opts.Algorithm != "ntlm" {
+			return Entry{}, fmt.Errorf("строка pwdump содержит NTLM-хеш, а задача ожидает %s", opts.Algorithm)
+		}
+		hash, err := normalize(fields[3], opts)
+		if err != nil {
+			return Entry{}, err
+		}
+		return Entry{User: fields[0], Hash: hash, Format: FormatPwdump}, nil
+	}
+
+	hash, userErr := normalize(fields[1], opts)
+	if userErr == nil {
+		return Entry{User: fields[0], Hash: hash, Format: FormatUserHash}, nil
+	}
+	hash, err := normalize(fields[0], opts)
+	if err != nil {
+		// Ни первое, ни второе поле не похожи на хеш: сообщаем об ошибке для формата user:hash
+		return Entry{}, userErr
+	}
+	if !opts.AllowSalt {
+		return Entry{}, fmt.Errorf("хеши с солью не поддерживаются")
+	}
+	return Entry{Hash: hash, Salt: strings.Join(fields[1:], ":"), Format: FormatHashSalt}, nil
+}
+
+// Hashes возвращает хеши записей без повторов в порядке первого появления.
+func Hashes(entries []Entry) []string {
+	seen := make(map[string]bool, len(entries))
+	hashes := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if !seen[entry.Hash] {
+			seen[entry.Hash] = true
+			hashes = append(hashes, entry.Hash)
+		}
+	}
+	return hashes
+}
+
+// Users возвращает имена пользователей для каждого хеша (одним паролем могут пользоваться несколько учётных записей).
+// Записи без имени пользователя не учитываются.
+func Users(entries []Entry) map[string][]string {
+	users := make(map[string][]string)
+	for _, entry := range entries {
+		if entry.User != "" {
+			users[entry.Hash] = append(users[entry.Hash], entry.User)
+		}
+	}
+	return users
+}
+
+// isPwdump проверяет, что поля соответствуют строке user:uid:lm:ntlm:::.
+func isPwdump(fields []string) bool {
+	if len(fields) != 7 || fields[4] != "" || fields[5] != "" || fields[6] != "" {
+		return false
+	}
+	for _, c := range fields[1] {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return fields[1] != ""
+}
+
+// normalize снимает тег формата John, приводит хеш к нижнему регистру и проверяет его длину.
+func normalize(hash string, opts Options) (string, error) {
+	hash = strings.TrimSpace(hash)
+	for tag, algorithm := range johnTags {
+		if len(hash) > len(tag) && strings.EqualFold(hash[:len(tag)], tag) {
+			if algorithm != opts.Algorithm {
+				return "", fmt.Errorf("тег %s означает %s, а задача ожидает %s", tag, algorithm, opts.Algorithm)
+			}
+			hash = hash[len(tag):]
+			break
+		}
+	}
+	hash = strings.ToLower(hash)
+	if len(hash) != opts.HexLength {
+		return "", fmt.Errorf("хеш %s должен состоять из %d hex-символов, а не %d", opts.Algorithm, opts.HexLength, len(hash))
+	}
+	if _, err := hex.DecodeString(hash); err != nil {
+		return "", fmt.Errorf("хеш содержит не hex-символы")
+	}
+	return hash, nil
+}
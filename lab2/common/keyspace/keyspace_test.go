@@ -0,0 +1,110 @@
+package keyspace
+
+import (
+	"math/big"
+	"testing"
+)
+
+// abSpace - все строки алфавита "ab" длины от 1 до 3: 2 + 4 + 8 = 14 кандидатов.
+var abSpace = Space{Alphabet: "ab", MinLength: 1, MaxLength: 3}
+
+func TestLengthSize(t *testing.T) {
+	tests := []struct {
+		space  Space
+		length int
+		want   uint64
+		ok     bool
+	}{
+		{abSpace, 0, 1, true},
+		{abSpace, 3, 8, true},
+		{Space{Alphabet: "abcdefghijklmnopqrstuvwxyz0123456789"}, 12, 4738381338321616896, true},
+		{Space{Alphabet: "abcdefghijklmnopqrstuvwxyz0123456789"}, 13, 0, false}, // 36^13 > 2^64
+	}
+	for _, tt := range tests {
+		got, ok := tt.space.LengthSize(tt.length)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("LengthSize(%q, %d) = %d, %v; want %d, %v", tt.space.Alphabet, tt.length, got, ok, tt.want, tt.ok)
+		}
+		if ok && tt.space.LengthSizeBig(tt.length).Uint64() != got {
+			t.Errorf("LengthSizeBig(%q, %d) = %s, want %d", tt.space.Alphabet, tt.length, tt.space.LengthSizeBig(tt.length), got)
+		}
+	}
+}
+
+func TestSize(t *testing.T) {
+	tests := []struct {
+		space Space
+		want  string
+		ok    bool
+	}{
+		{abSpace, "14", true},
+		{Space{Alphabet: "ab", MinLength: 3, MaxLength: 3}, "8", true},
+		{Space{Alphabet: "ab", MinLength: 4, MaxLength: 3}, "0", true},
+		{Space{Alphabet: "0123456789", MinLength: 1, MaxLength: 19}, "11111111111111111110", true},
+		{Space{Alphabet: "0123456789", MinLength: 19, MaxLength: 19}, "10000000000000000000", true},
+		// 10^20 кандидатов длины 20 не помещаются в uint64, SizeBig по-прежнему считает размер
+		{Space{Alphabet: "0123456789", MinLength: 1, MaxLength: 20}, "111111111111111111110", false},
+	}
+	for _, tt := range tests {
+		got, ok := tt.space.Size()
+		if ok != tt.ok || (ok && new(big.Int).SetUint64(got).String() != tt.want) {
+			t.Errorf("Size(%+v) = %d, %v; want %s, %v", tt.space, got, ok, tt.want, tt.ok)
+		}
+		if big := tt.space.SizeBig().String(); big != tt.want {
+			t.Errorf("SizeBig(%+v) = %s, want %s", tt.space, big, tt.want)
+		}
+	}
+}
+
+func TestLocateAndCandidate(t *testing.T) {
+	tests := []struct {
+		index     uint64
+		length    int
+		offset    uint64
+		candidate string
+	}{
+		{0, 1, 0, "a"},
+		{1, 1, 1, "b"},
+		{2, 2, 0, "aa"}, // первый кандидат следующей длины
+		{5, 2, 3, "bb"},
+		{6, 3, 0, "aaa"},
+		{13, 3, 7, "bbb"}, // последний кандидат пространства
+	}
+	for _, tt := range tests {
+		length, offset := abSpace.Locate(tt.index)
+		if length != tt.length || offset != tt.offset {
+			t.Errorf("Locate(%d) = %d, %d; want %d, %d", tt.index, length, offset, tt.length, tt.offset)
+		}
+		bigLength, bigOffset := abSpace.LocateBig(new(big.Int).SetUint64(tt.index))
+		if bigLength != tt.length || bigOffset.Uint64() != tt.offset {
+			t.Errorf("LocateBig(%d) = %d, %s; want %d, %d", tt.index, bigLength, bigOffset, tt.length, tt.offset)
+		}
+		if got := string(abSpace.Candidate(tt.index, nil)); got != tt.candidate {
+			t.Errorf("Candidate(%d) = %q, want %q", tt.index, got, tt.candidate)
+		}
+	}
+	if length, _ := abSpace.Locate(14); length != 0 {
+		t.Errorf("Locate(14) length = %d, want 0 outside of the space", length)
+	}
+	if length, _ := abSpace.LocateBig(big.NewInt(14)); length != 0 {
+		t.Errorf("LocateBig(14) length = %d, want 0 outside of the space", length)
+	}
+}
+
+func TestOffset(t *testing.T) {
+	tests := []struct {
+		minLength int
+		want      int64
+	}{
+		{1, 0},
+		{2, 2},
+		{3, 6},
+		{4, 14},
+	}
+	for _, tt := range tests {
+		space := Space{Alphabet: "ab", MinLength: tt.minLength, MaxLength: 4}
+		if got := space.Offset(); got.Int64() != tt.want {
+			t.Errorf("Offset(minLength=%d) = %s, want %d", tt.minLength, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package keyspace
+
+import (
+	"context"
+	"sync"
+)
+
+// checkInterval - через сколько кандидатов горутина проверяет, не остановлен ли поиск.
+// Проверка контекста на каждом кандидате заметно снижает скорость перебора.
+const checkInterval = 4096
+
+// Search ищет в диапазоне r кандидата, для которого match вернёт true. Диапазон делится на workers
+// непрерывных частей, каждая перебирается в своей горутине. Как только одна из горутин находит
+// кандидата, остальные прекращают перебор; то же происходит при отмене ctx.
+// newMatcher вызывается один раз в каждой горутине, чтобы у неё были свои хешер и буферы.
+func Search(ctx context.Context, space Enumerable, r Range, workers int, newMatcher func() func(candidate []byte) bool) (string, bool) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg    sync.WaitGroup
+		once  sync.Once
+		found string
+		ok    bool
+	)
+	for _, part := range r.Split(max(workers, 1)) {
+		wg.Add(1)
+		go func(part Range) {
+			defer wg.Done()
+			match := newMatcher()
+			checked := 0
+			Walk(space, part, func(candidate []byte) bool {
+				if checked++; checked%checkInterval == 0 && ctx.Err() != nil {
+					return false
+				}
+				if !match(candidate) {
+					return true
+				}
+				once.Do(func() {
+					found, ok = string(candidate), true
+					cancel()
+				})
+				return false
+			})
+		}(part)
+	}
+	wg.Wait()
+	return found, ok
+}
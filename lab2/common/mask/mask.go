@@ -0,0 +1,149 @@
+package mask
+
+import (
+	"common/keyspace"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// Встроенные наборы символов (как в hashcat)
+const (
+	Lower   = "abcdefghijklmnopqrstuvwxyz"
+	Upper   = "ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+	Digits  = "0123456789"
+	Special = " !\"#$%&'()*+,-./:;<=>?@[\\]^_`{|}~"
+	All     = Lower + Upper + Digits + Special
+
+	// MaxCustomCharsets - количество пользовательских наборов ?1..?4
+	MaxCustomCharsets = 4
+)
+
+var builtin = map[byte]string{
+	'l': Lower,
+	'u': Upper,
+	'd': Digits,
+	's': Special,
+	'a': All,
+}
+
+// Mask - разобранная маска: набор допустимых символов для каждой позиции кандидата.
+type Mask struct {
+	Positions []string
+}
+
+// Parse разбирает маску вида "Company?d?d?d?d".
+// Поддерживаются ?l ?u ?d ?s ?a, пользовательские наборы ?1..?4, "??" для символа '?'
+// и литеральные символы. Пользовательские наборы сами могут содержать встроенные (например "?l?d").
+func Parse(pattern string, charsets []string) (*Mask, error) {
+	if pattern == "" {
+		return nil, fmt.Errorf("маска пуста")
+	}
+	if len(charsets) > MaxCustomCharsets {
+		return nil, fmt.Errorf("допускается не более %d пользовательских наборов символов", MaxCustomCharsets)
+	}
+	custom := make([]string, len(charsets))
+	for i, charset := range charsets {
+		expanded, err := expandCharset(charset)
+		if err != nil {
+			return nil, fmt.Errorf("набор ?%d: %v", i+1, err)
+		}
+		if expanded == "" {
+			return nil, fmt.Errorf("набор ?%d пуст", i+1)
+		}
+		custom[i] = expanded
+	}
+
+	m := &Mask{}
+	for i := 0; i < len(pattern); i++ {
+		if pattern[i] != '?' {
+			m.Positions = append(m.Positions, pattern[i:i+1])
+			continue
+		}
+		if i+1 >= len(pattern) {
+			return nil, fmt.Errorf("маска оканчивается на '?'")
+		}
+		i++
+		placeholder := pattern[i]
+		switch {
+		case placeholder == '?':
+			m.Positions = append(m.Positions, "?")
+		case builtin[placeholder] != "":
+			m.Positions = append(m.Positions, builtin[placeholder])
+		case placeholder >= '1' && placeholder <= '0'+MaxCustomCharsets:
+			index := int(placeholder - '1')
+			if index >= len(custom) {
+				return nil, fmt.Errorf("набор ?%c не задан", placeholder)
+			}
+			m.Positions = append(m.Positions, custom[index])
+		default:
+			return nil, fmt.Errorf("неизвестный набор ?%c", placeholder)
+		}
+	}
+	return m, nil
+}
+
+// expandCharset раскрывает встроенные наборы внутри пользовательского набора и убирает повторы символов.
+func expandCharset(charset string) (string, error) {
+	var b strings.Builder
+	seen := [256]bool{}
+	add := func(chars string) {
+		for i := 0; i < len(chars); i++ {
+			if !seen[chars[i]] {
+				seen[chars[i]] = true
+				b.WriteByte(chars[i])
+			}
+		}
+	}
+	for i := 0; i < len(charset); i++ {
+		if charset[i] != '?' {
+			add(charset[i : i+1])
+			continue
+		}
+		if i+1 >= len(charset) {
+			return "", fmt.Errorf("набор оканчивается на '?'")
+		}
+		i++
+		switch {
+		case charset[i] == '?':
+			add("?")
+		case builtin[charset[i]] != "":
+			add(builtin[charset[i]])
+		default:
+			return "", fmt.Errorf("неизвестный набор ?%c", charset[i])
+		}
+	}
+	return b.String(), nil
+}
+
+// Length возвращает длину кандидатов, порождаемых маской.
+func (m *Mask) Length() int {
+	return len(m.Positions)
+}
+
+// SizeBig возвращает количество кандидатов без ограничения разрядности.
+func (m *Mask) SizeBig() *big.Int {
+	total := big.NewInt(1)
+	for _, charset := range m.Positions {
+		total.Mul(total, big.NewInt(int64(len(charset))))
+	}
+	return total
+}
+
+// Candidate записывает в buf кандидата с номером index в смешанной системе счисления:
+// основание каждого разряда равно размеру набора на этой позиции, младший разряд - последний символ.
+func (m *Mask) Candidate(index uint64, buf []byte) []byte {
+	buf = append(buf[:0], make([]byte, len(m.Positions))...)
+	for i := len(m.Positions) - 1; i >= 0; i-- {
+		charset := m.Positions[i]
+		base := uint64(len(charset))
+		buf[i] = charset[index%base]
+		index /= base
+	}
+	return buf
+}
+
+// Seek возвращает итератор, установленный на кандидата с номером index.
+func (m *Mask) Seek(index *big.Int) *keyspace.Iterator {
+	return keyspace.NewIterator(m.Positions, index, nil)
+}
@@ -0,0 +1,113 @@
+package mask
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name      string
+		pattern   string
+		charsets  []string
+		positions []string
+		size      string
+	}{
+		{name: "literal", pattern: "abc", positions: []string{"a", "b", "c"}, size: "1"},
+		{name: "lower", pattern: "?l", positions: []string{Lower}, size: "26"},
+		{name: "upper", pattern: "?u", positions: []string{Upper}, size: "26"},
+		{name: "digits", pattern: "?d", positions: []string{Digits}, size: "10"},
+		{name: "special", pattern: "?s", positions: []string{Special}, size: "33"},
+		{name: "all", pattern: "?a", positions: []string{All}, size: "95"},
+		{name: "escape", pattern: "a??b", positions: []string{"a", "?", "b"}, size: "1"},
+		{name: "escape only", pattern: "??", positions: []string{"?"}, size: "1"},
+		{name: "mixed", pattern: "Company?d?d?d?d", positions: []string{"C", "o", "m", "p", "a", "n", "y", Digits, Digits, Digits, Digits}, size: "10000"},
+		{
+			name:      "custom",
+			pattern:   "?1?2?3?4",
+			charsets:  []string{"ab", "?d", "x?u", "??!"},
+			positions: []string{"ab", Digits, "x" + Upper, "?!"},
+			size:      "1080", // 2 * 10 * 27 * 2
+		},
+		{name: "custom deduplicated", pattern: "?1", charsets: []string{"aab?l"}, positions: []string{Lower}, size: "26"},
+		{name: "unused custom", pattern: "?d", charsets: []string{"ab"}, positions: []string{Digits}, size: "10"},
+		{name: "huge", pattern: "?a?a?a?a?a?a?a?a?a?a?a", positions: repeat(All, 11), size: "5688000922764599609375"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := Parse(tt.pattern, tt.charsets)
+			if err != nil {
+				t.Fatalf("Parse(%q, %q) error: %v", tt.pattern, tt.charsets, err)
+			}
+			if len(m.Positions) != len(tt.positions) || m.Length() != len(tt.positions) {
+				t.Fatalf("Parse(%q) positions = %q, want %q", tt.pattern, m.Positions, tt.positions)
+			}
+			for i := range tt.positions {
+				if m.Positions[i] != tt.positions[i] {
+					t.Fatalf("Parse(%q) position %d = %q, want %q", tt.pattern, i, m.Positions[i], tt.positions[i])
+				}
+			}
+			if got := m.SizeBig().String(); got != tt.size {
+				t.Fatalf("Parse(%q).SizeBig() = %s, want %s", tt.pattern, got, tt.size)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		pattern  string
+		charsets []string
+	}{
+		{name: "empty", pattern: ""},
+		{name: "trailing question mark", pattern: "abc?"},
+		{name: "unknown builtin", pattern: "?x"},
+		{name: "custom not set", pattern: "?1"},
+		{name: "custom out of range", pattern: "?2", charsets: []string{"ab"}},
+		{name: "custom above four", pattern: "?5", charsets: []string{"a", "b", "c", "d"}},
+		{name: "too many customs", pattern: "?1", charsets: []string{"a", "b", "c", "d", "e"}},
+		{name: "empty custom", pattern: "?1", charsets: []string{""}},
+		{name: "unknown builtin in custom", pattern: "?1", charsets: []string{"?x"}},
+		{name: "custom ends with question mark", pattern: "?1", charsets: []string{"ab?"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Parse(tt.pattern, tt.charsets); err == nil {
+				t.Fatalf("Parse(%q, %q) error = nil, want error", tt.pattern, tt.charsets)
+			}
+		})
+	}
+}
+
+// TestCandidateMatchesIterator проверяет, что кандидат по номеру совпадает с кандидатом итератора маски.
+func TestCandidateMatchesIterator(t *testing.T) {
+	m, err := Parse("?1x?d?1", []string{"ab"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	size := m.SizeBig().Uint64()
+	it := m.Seek(big.NewInt(0))
+	for index := uint64(0); index < size; index++ {
+		if want := string(m.Candidate(index, nil)); string(it.Candidate()) != want {
+			t.Fatalf("candidate %d = %q, want %q", index, it.Candidate(), want)
+		}
+		if next := it.Next(); next != (index+1 < size) {
+			t.Fatalf("Next after %d = %v", index, next)
+		}
+	}
+	if got := string(m.Candidate(0, nil)); got != "ax0a" {
+		t.Fatalf("Candidate(0) = %q, want %q", got, "ax0a")
+	}
+	if got := string(m.Candidate(size-1, nil)); got != "bx9b" {
+		t.Fatalf("Candidate(%d) = %q, want %q", size-1, got, "bx9b")
+	}
+}
+
+func repeat(charset string, n int) []string {
+	positions := make([]string, n)
+	for i := range positions {
+		positions[i] = charset
+	}
+	return positions
+}
@@ -8,46 +8,138 @@ import (
 )
 
 // HashTask представляет собой задачу расшифровки определенного хеша, которая может быть разделена на подзадачи.
+// Подзадачи хранятся в отдельной коллекции subtasks, а в задаче - только их счётчики по статусам.
 type HashTask struct {
-	RequestId          string    `bson:"requestId"`
-	Hash               string    `bson:"hash"`
-	MaxLength          int       `bson:"maxLength"`
-	Status             string    `bson:"status"` // например "IN_PROGRESS", "DONE", "FAIL"
-	SubTaskCount       int       `bson:"subTaskCount"`
-	CompletedTaskCount int       `bson:"completedTaskCount"`
-	Result             string    `bson:"result,omitempty"` // расшифрованный пароль, если найден
-	SubTasks           []SubTask `bson:"subTasks"`
-	CreatedAt          time.Time `bson:"createdAt"`
+	RequestId          string              `bson:"requestId"`
+	Hash               string              `bson:"hash"`                // для пакетной задачи - метка вида "batch(N)"
+	DedupKey           string              `bson:"dedupKey,omitempty"`  // хеш и параметры атаки (уникальный индекс); удаляется, когда задачу нельзя переиспользовать
+	Hashes             []string            `bson:"hashes,omitempty"`    // хеши пакетной задачи (каждый кандидат сверяется со всеми)
+	Users              map[string][]string `bson:"users,omitempty"`     // пакетная задача: хеш -> учётные записи из импортированного списка
+	Mode               string              `bson:"mode,omitempty"`      // "bruteforce" (по умолчанию), "dictionary" или "mask"
+	Wordlist           string              `bson:"wordlist,omitempty"`  // идентификатор словаря для режима "dictionary"
+	Rules              string              `bson:"rules,omitempty"`     // идентификатор набора правил мутации слов словаря
+	Mask               string              `bson:"mask,omitempty"`      // маска для режима "mask", например "Company?d?d?d?d"
+	Charsets           []string            `bson:"charsets"`            // пользовательские наборы символов ?1..?4; у маски без наборов - пустой список
+	Alphabet           string              `bson:"alphabet,omitempty"`  // алфавит перебора; пустой означает constants.Alphabet
+	MinLength          int                 `bson:"minLength,omitempty"` // минимальная длина кандидата; 0 (старые задачи) означает MaxLength
+	MaxLength          int                 `bson:"maxLength"`
+	Status             string              `bson:"status"` // например "IN_PROGRESS", "DONE", "FAIL", "CANCELLED"
+	SubTaskCount       int                 `bson:"subTaskCount"`
+	CompletedTaskCount int                 `bson:"completedTaskCount"`
+	ReceivedTaskCount  int                 `bson:"receivedTaskCount"`           // подзадачи в статусе RECEIVED, ожидающие публикации
+	Result             string              `bson:"result,omitempty"`            // расшифрованный пароль, если найден
+	Results            map[string]string   `bson:"results,omitempty"`           // пакетная задача: хеш -> найденный пароль
+	SkippedTaskCount   int                 `bson:"skippedTaskCount,omitempty"`  // подзадачи, оставшиеся незавершёнными, когда пароль был найден
+	SkippedCandidates  string              `bson:"skippedCandidates,omitempty"` // сколько кандидатов в них (десятичное число; для словаря - строки)
+	DeadTaskCount      int                 `bson:"deadTaskCount,omitempty"`     // подзадачи в статусе DEAD (результат так и не получен)
+	CreatedAt          time.Time           `bson:"createdAt"`
+	// Version увеличивается при каждом изменении документа после создания: статус задачи сохраняется
+	// только если версия не изменилась с момента чтения (оптимистичная блокировка)
+	Version int64 `bson:"version"`
 	// UpdatedAt отсутствует на уровне задачи (каждая SubTask имеет свой UpdatedAt)
 }
 
 // SubTask представляет часть пространства поиска для задачи HashTask.
+// Хранится в коллекции subtasks отдельным документом, ключ - (requestId, subTaskNumber).
 type SubTask struct {
+	RequestId     string    `bson:"requestId"`
 	Hash          string    `bson:"hash"`
 	SubTaskNumber int       `bson:"subTaskNumber"`
-	Status        string    `bson:"status"` // например "RECEIVED", "PUBLISHED, "COMPLETE"
+	Status        string    `bson:"status"`               // например "RECEIVED", "PUBLISHED", "STARTED", "COMPLETE", "CANCELLED", "SKIPPED", "DEAD"
+	Attempts      int       `bson:"attempts,omitempty"`   // сколько раз истекла аренда начатой подзадачи
+	ResultKey     string    `bson:"resultKey,omitempty"`  // ключ идемпотентности публикации, результат которой применён
+	RangeStart    string    `bson:"rangeStart,omitempty"` // начало диапазона [start, end) номеров кандидатов (десятичное число)
+	RangeEnd      string    `bson:"rangeEnd,omitempty"`   // конец диапазона номеров кандидатов (не включается)
+	WordOffset    int64     `bson:"wordOffset,omitempty"` // смещение первой строки словаря в байтах
+	StartLine     int       `bson:"startLine,omitempty"`  // номер первой строки словаря
+	LineCount     int       `bson:"lineCount,omitempty"`  // количество строк словаря в подзадаче
 	CreatedAt     time.Time `bson:"createdAt"`
-	UpdatedAt     time.Time `bson:"updatedAt"`
+	UpdatedAt     time.Time `bson:"updatedAt"` // для STARTED - время последнего heartbeat воркера
+}
+
+// PotEntry - запись potfile: хеш, пароль для которого уже известен (найден воркерами или импортирован).
+type PotEntry struct {
+	Hash      string    `bson:"hash"` // hex MD5 в нижнем регистре, уникален в коллекции
+	Plain     string    `bson:"plain"`
+	RequestId string    `bson:"requestId,omitempty"` // задача, в которой пароль был найден; пусто для импортированных
+	CrackedAt time.Time `bson:"crackedAt"`
 }
 
 // TaskMessage - структура сообщения, отправляемого воркерам через очередь "tasks".
 type TaskMessage struct {
-	Hash          string `json:"hash"`
-	MaxLength     int    `json:"maxLength"`
-	SubTaskNumber int    `json:"subTaskNumber"`
-	SubTaskCount  int    `json:"subTaskCount"`
+	// Ключ идемпотентности публикации (requestId:подзадача:попытка): повторная доставка сообщения сохраняет ключ
+	IdempotencyKey string `json:"idempotencyKey,omitempty"`
+	RequestId      string `json:"requestId"`
+	Hash           string `json:"hash"`
+	// Подзадача пакетной задачи: список хешей воркер один раз на задачу получает у менеджера (см. BatchHashesPath)
+	Batch         bool     `json:"batch,omitempty"`
+	Mode          string   `json:"mode,omitempty"`
+	Alphabet      string   `json:"alphabet,omitempty"`
+	MinLength     int      `json:"minLength,omitempty"`
+	MaxLength     int      `json:"maxLength"`
+	SubTaskNumber int      `json:"subTaskNumber"`
+	SubTaskCount  int      `json:"subTaskCount"`
+	Wordlist      string   `json:"wordlist,omitempty"`
+	Rules         string   `json:"rules,omitempty"`
+	Mask          string   `json:"mask,omitempty"`
+	Charsets      []string `json:"charsets,omitempty"`
+	RangeStart    string   `json:"rangeStart,omitempty"`
+	RangeEnd      string   `json:"rangeEnd,omitempty"`
+	WordOffset    int64    `json:"wordOffset,omitempty"`
+	StartLine     int      `json:"startLine,omitempty"`
+	LineCount     int      `json:"lineCount,omitempty"`
 }
 
 // ResultMessage - структура сообщения, отправляемого обратно через очередь "results".
 type ResultMessage struct {
-	Hash          string `json:"hash"`
-	SubTaskNumber int    `json:"subTaskNumber"`
-	Result        string `json:"result"`
+	IdempotencyKey string      `json:"idempotencyKey,omitempty"` // ключ сообщения подзадачи, для которой получен результат
+	RequestId      string      `json:"requestId"`
+	Hash           string      `json:"hash"`
+	SubTaskNumber  int         `json:"subTaskNumber"`
+	Result         string      `json:"result"`
+	Matches        []HashMatch `json:"matches,omitempty"` // пакетная задача: все хеши, найденные в подзадаче
+	// Heartbeat: не результат, а сообщение воркера о том, что он перебирает подзадачу (продлевает её аренду)
+	Heartbeat bool `json:"heartbeat,omitempty"`
+}
+
+// HashMatch - хеш пакетной задачи и подобранный для него пароль.
+type HashMatch struct {
+	Hash   string `json:"hash"`
+	Result string `json:"result"`
+}
+
+// ControlMessage - управляющее сообщение, рассылаемое всем воркерам через обменник "control".
+type ControlMessage struct {
+	Type      string `json:"type"` // constants.ControlCancel или constants.ControlSolved
+	RequestId string `json:"requestId"`
+	Hash      string `json:"hash"`
 }
 
-// BsonFilterReceived возвращает фильтр MongoDB для поиска задач с подзадачами в статусе "RECEIVED".
+// DeadLetter - сообщение из очереди недоставленных ("tasks.dead" или "results.dead").
+type DeadLetter struct {
+	Queue      string `json:"queue"`                // рабочая очередь, из которой сообщение отклонено
+	Reason     string `json:"reason,omitempty"`     // причина отклонения
+	RejectedBy string `json:"rejectedBy,omitempty"` // компонент, отклонивший сообщение
+	RejectedAt string `json:"rejectedAt,omitempty"` // время отклонения (RFC 3339)
+	RetryCount int    `json:"retryCount"`           // попыток после временных ошибок
+	Body       string `json:"body"`                 // тело сообщения как есть (обычно JSON TaskMessage/ResultMessage)
+}
+
+// BsonFilterReceived возвращает фильтр MongoDB для поиска незавершённых задач с подзадачами в статусе "RECEIVED".
 func BsonFilterReceived() bson.M {
-	return bson.M{"subTasks.status": "RECEIVED"}
+	return bson.M{"status": "IN_PROGRESS", "receivedTaskCount": bson.M{"$gt": 0}}
+}
+
+// Exhausted сообщает, что ни одна подзадача больше не выполняется: все завершены или признаны мёртвыми.
+func (t HashTask) Exhausted() bool {
+	return t.CompletedTaskCount+t.DeadTaskCount >= t.SubTaskCount
+}
+
+// BsonFilterResult возвращает фильтр MongoDB для поиска задачи, к которой относится результат.
+// Задача ищется только по requestId: у одного хеша может быть несколько задач (отменённые, с мёртвыми
+// подзадачами и выполняющаяся), поэтому результат без requestId нельзя отнести ни к одной из них.
+func BsonFilterResult(res ResultMessage) bson.M {
+	return bson.M{"requestId": res.RequestId}
 }
 
 // MarshalTaskMessage сериализует TaskMessage в JSON.
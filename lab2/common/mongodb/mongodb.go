@@ -28,3 +28,18 @@ func ConnectMongo(uri string, dbName string) (*mongo.Client, *mongo.Database, er
 	db := client.Database(dbName)
 	return client, db, nil
 }
+
+// WithTransaction выполняет fn в транзакции на клиенте client и повторяет её при временных ошибках
+// (например, конфликте записи с другой транзакцией). Ошибка fn прерывает транзакцию и возвращается как есть.
+// Транзакции доступны только в replica set.
+func WithTransaction(ctx context.Context, client *mongo.Client, fn func(sc mongo.SessionContext) error) error {
+	session, err := client.StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		return nil, fn(sc)
+	})
+	return err
+}
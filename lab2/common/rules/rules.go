@@ -0,0 +1,325 @@
+package rules
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"common/constants"
+	"common/wordlist"
+)
+
+// Rule - одно правило мутации слова (последовательность функций в синтаксисе hashcat/John).
+type Rule struct {
+	text      string
+	functions []function
+}
+
+// function - одна функция правила с уже разобранными аргументами.
+type function struct {
+	op   byte
+	pos  int  // позиция или количество (N)
+	char byte // символ (X)
+	with byte // второй символ (Y) для замены
+}
+
+// Set - набор правил, применяемых к каждому слову словаря.
+type Set struct {
+	Rules []Rule
+}
+
+// argKinds описывает аргументы каждой поддерживаемой функции:
+// 'N' - позиция/количество (0-9, A-Z), 'X' - произвольный символ.
+var argKinds = map[byte]string{
+	':': "", 'l': "", 'u': "", 'c': "", 'C': "", 't': "", 'r': "", 'd': "", 'f': "",
+	'{': "", '}': "", '[': "", ']': "", 'q': "",
+	'T': "N", 'p': "N", 'D': "N", '\'': "N", 'z': "N", 'Z': "N",
+	'$': "X", '^': "X", '@': "X",
+	's': "XX", 'i': "NX", 'o': "NX",
+}
+
+// Dir возвращает каталог с файлами правил (переменная окружения RULES_DIR или значение по умолчанию).
+func Dir() string {
+	if dir := os.Getenv("RULES_DIR"); dir != "" {
+		return dir
+	}
+	return constants.DefaultRulesDir
+}
+
+// Parse разбирает одну строку правила. Пробелы между функциями игнорируются.
+func Parse(line string) (Rule, error) {
+	rule := Rule{text: line}
+	for i := 0; i < len(line); {
+		op := line[i]
+		i++
+		if op == ' ' || op == '\t' {
+			continue
+		}
+		kinds, ok := argKinds[op]
+		if !ok {
+			return Rule{}, fmt.Errorf("неизвестная функция %q", op)
+		}
+		if i+len(kinds) > len(line) {
+			return Rule{}, fmt.Errorf("функции %q не хватает аргументов", op)
+		}
+		fn := function{op: op}
+		chars := 0
+		for k := 0; k < len(kinds); k++ {
+			arg := line[i+k]
+			switch {
+			case kinds[k] == 'N':
+				pos, err := position(arg)
+				if err != nil {
+					return Rule{}, fmt.Errorf("функция %q: %v", op, err)
+				}
+				fn.pos = pos
+			case chars == 0:
+				fn.char = arg
+				chars++
+			default:
+				fn.with = arg
+			}
+		}
+		i += len(kinds)
+		rule.functions = append(rule.functions, fn)
+	}
+	return rule, nil
+}
+
+// ParseSet разбирает файл правил: по одному правилу на строку,
+// пустые строки и строки, начинающиеся с '#', пропускаются.
+func ParseSet(r io.Reader) (*Set, error) {
+	set := &Set{}
+	scanner := bufio.NewScanner(r)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		rule, err := Parse(line)
+		if err != nil {
+			return nil, fmt.Errorf("строка %d (%q): %v", lineNumber, line, err)
+		}
+		set.Rules = append(set.Rules, rule)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(set.Rules) == 0 {
+		return nil, fmt.Errorf("набор правил пуст")
+	}
+	return set, nil
+}
+
+// Load загружает набор правил по идентификатору (имени файла в каталоге Dir()).
+func Load(id string) (*Set, error) {
+	path, err := wordlist.Path(Dir(), id)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return ParseSet(file)
+}
+
+// Expand применяет каждое правило набора к слову и вызывает fn для каждого кандидата.
+// Возвращает false, если fn попросил прекратить перебор.
+func (s *Set) Expand(word string, fn func(candidate string) bool) bool {
+	buf := make([]byte, 0, 2*len(word)+8)
+	for _, rule := range s.Rules {
+		buf = rule.apply(append(buf[:0], word...))
+		if !fn(string(buf)) {
+			return false
+		}
+	}
+	return true
+}
+
+// String возвращает исходный текст правила.
+func (r Rule) String() string {
+	return r.text
+}
+
+// Apply применяет правило к слову.
+func (r Rule) Apply(word string) string {
+	return string(r.apply([]byte(word)))
+}
+
+func (r Rule) apply(w []byte) []byte {
+	for _, fn := range r.functions {
+		w = fn.apply(w)
+	}
+	return w
+}
+
+func (fn function) apply(w []byte) []byte {
+	switch fn.op {
+	case ':':
+	case 'l':
+		for i := range w {
+			w[i] = toLower(w[i])
+		}
+	case 'u':
+		for i := range w {
+			w[i] = toUpper(w[i])
+		}
+	case 'c':
+		for i := range w {
+			if i == 0 {
+				w[i] = toUpper(w[i])
+			} else {
+				w[i] = toLower(w[i])
+			}
+		}
+	case 'C':
+		for i := range w {
+			if i == 0 {
+				w[i] = toLower(w[i])
+			} else {
+				w[i] = toUpper(w[i])
+			}
+		}
+	case 't':
+		for i := range w {
+			w[i] = toggle(w[i])
+		}
+	case 'T':
+		if fn.pos < len(w) {
+			w[fn.pos] = toggle(w[fn.pos])
+		}
+	case 'r':
+		for i, j := 0, len(w)-1; i < j; i, j = i+1, j-1 {
+			w[i], w[j] = w[j], w[i]
+		}
+	case 'd':
+		w = append(w, w...)
+	case 'p':
+		word := append([]byte(nil), w...)
+		for k := 0; k < fn.pos; k++ {
+			w = append(w, word...)
+		}
+	case 'f':
+		for i := len(w) - 1; i >= 0; i-- {
+			w = append(w, w[i])
+		}
+	case '{':
+		if len(w) > 1 {
+			first := w[0]
+			copy(w, w[1:])
+			w[len(w)-1] = first
+		}
+	case '}':
+		if len(w) > 1 {
+			last := w[len(w)-1]
+			copy(w[1:], w[:len(w)-1])
+			w[0] = last
+		}
+	case '$':
+		w = append(w, fn.char)
+	case '^':
+		w = append(w, 0)
+		copy(w[1:], w[:len(w)-1])
+		w[0] = fn.char
+	case '[':
+		if len(w) > 0 {
+			w = append(w[:0], w[1:]...)
+		}
+	case ']':
+		if len(w) > 0 {
+			w = w[:len(w)-1]
+		}
+	case 'D':
+		if fn.pos < len(w) {
+			w = append(w[:fn.pos], w[fn.pos+1:]...)
+		}
+	case '\'':
+		if fn.pos < len(w) {
+			w = w[:fn.pos]
+		}
+	case 'i':
+		if fn.pos <= len(w) {
+			w = append(w, 0)
+			copy(w[fn.pos+1:], w[fn.pos:len(w)-1])
+			w[fn.pos] = fn.char
+		}
+	case 'o':
+		if fn.pos < len(w) {
+			w[fn.pos] = fn.char
+		}
+	case 's':
+		for i := range w {
+			if w[i] == fn.char {
+				w[i] = fn.with
+			}
+		}
+	case '@':
+		kept := w[:0]
+		for _, b := range w {
+			if b != fn.char {
+				kept = append(kept, b)
+			}
+		}
+		w = kept
+	case 'z':
+		if len(w) > 0 {
+			prefix := make([]byte, fn.pos)
+			for k := range prefix {
+				prefix[k] = w[0]
+			}
+			w = append(prefix, w...)
+		}
+	case 'Z':
+		if len(w) > 0 {
+			last := w[len(w)-1]
+			for k := 0; k < fn.pos; k++ {
+				w = append(w, last)
+			}
+		}
+	case 'q':
+		doubled := make([]byte, 0, 2*len(w))
+		for _, b := range w {
+			doubled = append(doubled, b, b)
+		}
+		w = doubled
+	}
+	return w
+}
+
+// position разбирает позицию в нотации hashcat: 0-9, затем A-Z для 10-35.
+func position(c byte) (int, error) {
+	switch {
+	case c >= '0' && c <= '9':
+		return int(c - '0'), nil
+	case c >= 'A' && c <= 'Z':
+		return int(c-'A') + 10, nil
+	}
+	return 0, fmt.Errorf("некорректная позиция %q", c)
+}
+
+func toLower(c byte) byte {
+	if c >= 'A' && c <= 'Z' {
+		return c + ('a' - 'A')
+	}
+	return c
+}
+
+func toUpper(c byte) byte {
+	if c >= 'a' && c <= 'z' {
+		return c - ('a' - 'A')
+	}
+	return c
+}
+
+func toggle(c byte) byte {
+	if c >= 'a' && c <= 'z' {
+		return toUpper(c)
+	}
+	return toLower(c)
+}
@@ -0,0 +1,103 @@
+package rules
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		rule string
+		word string
+		want string
+	}{
+		{":", "p@ss", "p@ss"},
+		{"l", "PaSs", "pass"},
+		{"u", "PaSs", "PASS"},
+		{"c", "pASS", "Pass"},
+		{"C", "Pass", "pASS"},
+		{"t", "PaSs", "pAsS"},
+		{"T0", "pass", "Pass"},
+		{"T9", "pass", "pass"}, // позиция за концом слова
+		{"TA", "abcdefghijk", "abcdefghijK"},
+		{"r", "abc", "cba"},
+		{"d", "ab", "abab"},
+		{"p2", "ab", "ababab"},
+		{"f", "abc", "abccba"},
+		{"{", "abc", "bca"},
+		{"}", "abc", "cab"},
+		{"$1", "ab", "ab1"},
+		{"^1", "ab", "1ab"},
+		{"[", "abc", "bc"},
+		{"[", "", ""},
+		{"]", "abc", "ab"},
+		{"D1", "abc", "ac"},
+		{"'2", "abcd", "ab"},
+		{"i1X", "abc", "aXbc"},
+		{"i3X", "abc", "abcX"},
+		{"i4X", "abc", "abc"},
+		{"o0X", "abc", "Xbc"},
+		{"sa@", "banana", "b@n@n@"},
+		{"@a", "banana", "bnn"},
+		{"z2", "ab", "aaab"},
+		{"Z2", "ab", "abbb"},
+		{"q", "ab", "aabb"},
+		{"c $1 $2", "pASS", "Pass12"},
+		{"sa4 se3 ^!", "release", "!r3l34s3"},
+	}
+	for _, tt := range tests {
+		rule, err := Parse(tt.rule)
+		if err != nil {
+			t.Fatalf("Parse(%q) error: %v", tt.rule, err)
+		}
+		if got := rule.Apply(tt.word); got != tt.want {
+			t.Errorf("%q.Apply(%q) = %q, want %q", tt.rule, tt.word, got, tt.want)
+		}
+	}
+}
+
+func TestParseRejectsInvalidRules(t *testing.T) {
+	tests := []string{
+		"X",   // неизвестная функция
+		"l K", // неизвестная функция после пробела
+		"$",   // нет символа
+		"sa",  // нет второго символа
+		"i1",  // нет символа вставки
+		"Ta",  // позиция в нижнем регистре
+		"D!",  // некорректная позиция
+	}
+	for _, line := range tests {
+		if _, err := Parse(line); err == nil {
+			t.Errorf("Parse(%q) error = nil, want error", line)
+		}
+	}
+}
+
+func TestParseSet(t *testing.T) {
+	set, err := ParseSet(strings.NewReader("# комментарий\n:\r\n\nd\nr\n"))
+	if err != nil {
+		t.Fatalf("ParseSet error: %v", err)
+	}
+	// Буфер кандидата переиспользуется между правилами, поэтому каждое правило должно начинать с исходного слова
+	var got []string
+	set.Expand("ab", func(candidate string) bool {
+		got = append(got, candidate)
+		return true
+	})
+	if want := []string{"ab", "abab", "ba"}; strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("Expand = %v, want %v", got, want)
+	}
+
+	calls := 0
+	if set.Expand("ab", func(string) bool { calls++; return false }) || calls != 1 {
+		t.Fatalf("Expand did not stop after fn returned false (calls = %d)", calls)
+	}
+
+	if _, err := ParseSet(strings.NewReader("# только комментарий\n\n")); err == nil {
+		t.Fatal("ParseSet of an empty set: error = nil, want error")
+	}
+	_, err = ParseSet(strings.NewReader(":\nX\n"))
+	if err == nil || !strings.Contains(err.Error(), "строка 2") {
+		t.Fatalf("ParseSet error = %v, want error for line 2", err)
+	}
+}
@@ -0,0 +1,113 @@
+package wordlist
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"common/constants"
+)
+
+// Chunk описывает непрерывный диапазон строк словаря, который обрабатывается одной подзадачей.
+type Chunk struct {
+	Offset    int64 // смещение первой строки диапазона в байтах
+	StartLine int   // номер первой строки диапазона (с нуля)
+	LineCount int   // количество строк в диапазоне
+}
+
+// Dir возвращает каталог со словарями (переменная окружения WORDLIST_DIR или значение по умолчанию).
+func Dir() string {
+	if dir := os.Getenv("WORDLIST_DIR"); dir != "" {
+		return dir
+	}
+	return constants.DefaultWordlistDir
+}
+
+// Path возвращает путь к словарю по его идентификатору (имени файла в каталоге dir).
+// Идентификатор не может содержать разделители пути, чтобы нельзя было выйти за пределы каталога.
+func Path(dir string, id string) (string, error) {
+	if id == "" || id == "." || id == ".." || strings.ContainsAny(id, `/\`) {
+		return "", fmt.Errorf("некорректный идентификатор словаря %q", id)
+	}
+	return filepath.Join(dir, id), nil
+}
+
+// Split разбивает словарь на диапазоны не более чем по linesPerChunk строк.
+// Возвращает диапазоны и общее количество строк в словаре.
+func Split(path string, linesPerChunk int) ([]Chunk, int, error) {
+	if linesPerChunk < 1 {
+		return nil, 0, errors.New("linesPerChunk должен быть положительным")
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	var chunks []Chunk
+	var offset int64
+	lines := 0
+	for {
+		lineStart := offset
+		line, err := reader.ReadSlice('\n')
+		offset += int64(len(line))
+		// Слишком длинная строка: дочитываем её до конца, не копируя в память
+		for err == bufio.ErrBufferFull {
+			line, err = reader.ReadSlice('\n')
+			offset += int64(len(line))
+		}
+		if err != nil && err != io.EOF {
+			return nil, 0, err
+		}
+		if offset == lineStart {
+			break
+		}
+		if lines%linesPerChunk == 0 {
+			chunks = append(chunks, Chunk{Offset: lineStart, StartLine: lines})
+		}
+		chunks[len(chunks)-1].LineCount++
+		lines++
+		if err == io.EOF {
+			break
+		}
+	}
+	return chunks, lines, nil
+}
+
+// ReadChunk читает lineCount строк словаря начиная с байтового смещения offset
+// и вызывает fn для каждого слова. Чтение прекращается, если fn возвращает false.
+func ReadChunk(path string, offset int64, lineCount int, fn func(word string) bool) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+
+	reader := bufio.NewReader(file)
+	for read := 0; read < lineCount; read++ {
+		line, err := reader.ReadString('\n')
+		if len(line) == 0 && err == io.EOF {
+			return nil
+		}
+		if err != nil && err != io.EOF {
+			return err
+		}
+		word := strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r")
+		if !fn(word) {
+			return nil
+		}
+		if err == io.EOF {
+			return nil
+		}
+	}
+	return nil
+}
@@ -1,16 +1,30 @@
 package main
 
 import (
+	"context"
 	"log"
+	"os"
 	"sync"
 
+	"common/constants"
 	"common/logger"
 	"manager/internal/connection"
+	"manager/internal/migrations"
+	"manager/internal/outbox"
+	"manager/internal/potfile"
 	"manager/internal/rabbit"
+	"manager/internal/reaper"
 	"manager/internal/server"
+	"manager/internal/subtasks"
 )
 
 func main() {
+	// Подкоманда "manager migrate" применяет миграции схемы и завершается, не запуская компоненты
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		migrate(os.Args[2:])
+		return
+	}
+
 	// Connect to MongoDB
 	mongoClient, db, err := connection.ConnectMongoDB()
 	if err != nil {
@@ -20,25 +34,42 @@ func main() {
 	defer func() {
 		_ = mongoClient.Disconnect(nil)
 	}()
-	taskColl := db.Collection("hash_tasks")
-
-	// Connect to RabbitMQ
-	rabbitConn, rabbitCh, rabbitURI, err := connection.ConnectRabbitMQ()
-	if err != nil {
-		logger.Log("Manager", "Не удалось подключиться к RabbitMQ: "+err.Error())
+	taskColl := db.Collection(constants.TasksCollection)
+	// Индексы и изменения схемы (в том числе перенос подзадач, встроенных в задачи прежних версий)
+	// применяются до запуска компонентов, см. пакет migrations.
+	if _, err := migrations.Run(context.Background(), db); err != nil {
+		logger.Log("Manager", "Не удалось применить миграции схемы: "+err.Error())
 		log.Fatal(err)
 	}
-	defer rabbitConn.Close()
+	// Все найденные пароли сохраняются в potfile и переиспользуются без повторного перебора.
+	pot := potfile.NewStore(db.Collection(constants.PotfileCollection))
+	// Подзадачи хранятся в отдельной коллекции, по документу на подзадачу.
+	subs := subtasks.NewStore(db.Collection(constants.SubTasksCollection))
+	// Сообщения подзадач записываются в outbox в одной транзакции с изменением задачи.
+	box := outbox.NewStore(db.Collection(constants.OutboxCollection))
+
+	// Connect to RabbitMQ: сессия подключается в фоне и сама восстанавливает соединение после обрыва,
+	// а каждый компонент работает на собственном канале.
+	session := connection.ConnectRabbitMQ()
+	defer session.Close()
+
+	logger.Log("Manager", "Соединение с MongoDB установлено")
 
-	logger.Log("Manager", "Соединения с MongoDB и RabbitMQ установлены")
+	// Управляющие сообщения воркерам (отмена задачи, найденный пароль) рассылаются через обменник "control".
+	control := rabbit.NewControlPublisher(session)
 
 	// Запускаем фоновые горутины:
 	// 1. Потребитель очереди "results" для обработки результатов завершенных подзадач.
-	go rabbit.StartResultConsumer(rabbitCh, taskColl, &rabbitConn, rabbitURI)
-	// 2. Публикатор для отправки новых подзадач в очередь "tasks".
-	go rabbit.StartPublisher(taskColl, &rabbitConn, rabbitURI, rabbitCh)
-	// 3. HTTP-сервер для обработки входящих API-запросов.
-	go server.StartHTTPServer(taskColl)
+	go rabbit.StartResultConsumer(taskColl, subs, session, control, pot)
+	// 2. Публикатор, ставящий новые подзадачи в outbox по событиям change stream.
+	//    Resume token потока хранится в коллекции stream_tokens.
+	go rabbit.StartPublisher(taskColl, db.Collection(constants.StreamTokensCollection), subs, box)
+	//    Relay, отправляющий записи outbox в очередь "tasks" с подтверждениями брокера.
+	go rabbit.StartOutboxRelay(box, taskColl, subs, session)
+	// 3. Возврат в очередь подзадач, опубликованных давно, но так и не получивших результата.
+	go reaper.StartReaper(taskColl, subs, reaper.LoadConfig())
+	// 4. HTTP-сервер для обработки входящих API-запросов (включая просмотр и переотправку недоставленных сообщений).
+	go server.StartHTTPServer(taskColl, subs, pot, control, rabbit.NewDeadLetterAdmin(session))
 
 	logger.Log("Manager", "Все компоненты запущены")
 
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+
+	"common/logger"
+	"manager/internal/connection"
+	"manager/internal/migrations"
+)
+
+// migrate выполняет подкоманду "manager migrate": без аргументов применяет миграции, которые ещё не применены,
+// а "manager migrate status" выводит применённые и ожидающие миграции.
+func migrate(args []string) {
+	if len(args) > 1 || (len(args) == 1 && args[0] != "status") {
+		fmt.Fprintln(os.Stderr, "usage: manager migrate [status]")
+		os.Exit(2)
+	}
+
+	mongoClient, db, err := connection.ConnectMongoDB()
+	if err != nil {
+		logger.Log("Manager", "Не удалось подключиться к MongoDB: "+err.Error())
+		log.Fatal(err)
+	}
+	defer func() {
+		_ = mongoClient.Disconnect(context.Background())
+	}()
+	ctx := context.Background()
+
+	if len(args) == 1 {
+		done, pending, err := migrations.Status(ctx, db)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, m := range done {
+			state := "применена " + m.AppliedAt.Format("2006-01-02 15:04:05")
+			fmt.Printf("%3d  %-29s  %s\n", m.Version, state, m.Description)
+		}
+		for _, m := range pending {
+			fmt.Printf("%3d  %-29s  %s\n", m.Version, "ожидает", m.Description)
+		}
+		return
+	}
+
+	count, err := migrations.Run(ctx, db)
+	if err != nil {
+		logger.Log("Manager", "Не удалось применить миграции схемы: "+err.Error())
+		log.Fatal(err)
+	}
+	logger.Log("Manager", fmt.Sprintf("Применено миграций: %d", count))
+}
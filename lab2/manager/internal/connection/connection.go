@@ -8,7 +8,6 @@ import (
 	"common/logger"
 	"common/mongodb"
 
-	"github.com/streadway/amqp"
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
@@ -26,21 +25,12 @@ func ConnectMongoDB() (*mongo.Client, *mongo.Database, error) {
 	return client, db, nil
 }
 
-// ConnectRabbitMQ устанавливает соединение с RabbitMQ и открывает канал для очереди "tasks".
-func ConnectRabbitMQ() (*amqp.Connection, *amqp.Channel, string, error) {
+// ConnectRabbitMQ создаёт сессию RabbitMQ: соединение устанавливается и восстанавливается в фоне,
+// после каждого подключения заново объявляются очереди и обменники.
+func ConnectRabbitMQ() *amqputil.Session {
 	rabbitURI := os.Getenv("RABBITMQ_URI")
 	if rabbitURI == "" {
 		rabbitURI = constants.DefaultRabbitURI
 	}
-	conn, err := amqputil.ConnectRabbitMQ(rabbitURI)
-	if err != nil {
-		return nil, nil, rabbitURI, err
-	}
-	ch, err := amqputil.CreateChannel(conn, constants.TasksQueue, 0)
-	if err != nil {
-		conn.Close()
-		return nil, nil, rabbitURI, err
-	}
-	logger.Log("Connector", "Соединение с RabbitMQ установлено")
-	return conn, ch, rabbitURI, nil
+	return amqputil.NewSession(rabbitURI, amqputil.DeclareTopology)
 }
@@ -0,0 +1,120 @@
+package migrations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"common/constants"
+	"common/logger"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// lockId - _id документа блокировки в коллекции schema_migrations.
+const lockId = "lock"
+
+// errLockLost возвращается, если блокировку забрал другой менеджер (она не продлевалась дольше MigrationLockTTL).
+var errLockLost = errors.New("migration lock lost")
+
+// migrationLock - блокировка выполнения миграций: документ {_id: "lock", owner, expiresAt}.
+// Пока миграции выполняются, владелец продлевает expiresAt; блокировку упавшего менеджера
+// другой менеджер забирает после её истечения.
+type migrationLock struct {
+	coll  *mongo.Collection
+	owner string
+	stop  chan struct{}
+	done  chan struct{}
+
+	mu   sync.Mutex
+	lost error
+}
+
+// acquireLock ждёт, пока блокировка свободна или истекла, и забирает её.
+func acquireLock(ctx context.Context, coll *mongo.Collection) (*migrationLock, error) {
+	host, _ := os.Hostname()
+	owner := fmt.Sprintf("%s:%d:%d", host, os.Getpid(), time.Now().UnixNano())
+	waiting := false
+	for {
+		// Документ обновляется, только если блокировка истекла; если она занята, upsert пытается вставить
+		// второй документ с тем же _id и получает ошибку дубликата ключа
+		now := time.Now()
+		_, err := coll.UpdateOne(ctx,
+			bson.M{"_id": lockId, "expiresAt": bson.M{"$lt": now}},
+			bson.M{"$set": bson.M{"owner": owner, "expiresAt": now.Add(constants.MigrationLockTTL)}},
+			options.Update().SetUpsert(true),
+		)
+		if err == nil {
+			break
+		}
+		if !mongo.IsDuplicateKeyError(err) {
+			return nil, err
+		}
+		if !waiting {
+			logger.Log("Migrations", "Миграции выполняет другой экземпляр менеджера, ожидание блокировки")
+			waiting = true
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(constants.MigrationLockRetry):
+		}
+	}
+
+	lock := &migrationLock{coll: coll, owner: owner, stop: make(chan struct{}), done: make(chan struct{})}
+	go lock.keepAlive()
+	return lock, nil
+}
+
+// keepAlive продлевает блокировку, пока не вызван release.
+func (l *migrationLock) keepAlive() {
+	defer close(l.done)
+	ticker := time.NewTicker(constants.MigrationLockTTL / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), constants.ContextTimeout)
+		res, err := l.coll.UpdateOne(ctx,
+			bson.M{"_id": lockId, "owner": l.owner},
+			bson.M{"$set": bson.M{"expiresAt": time.Now().Add(constants.MigrationLockTTL)}},
+		)
+		cancel()
+		if err != nil {
+			logger.Log("Migrations", fmt.Sprintf("Ошибка продления блокировки миграций: %v", err))
+			continue
+		}
+		if res.MatchedCount == 0 {
+			l.mu.Lock()
+			l.lost = errLockLost
+			l.mu.Unlock()
+			return
+		}
+	}
+}
+
+// err возвращает errLockLost, если блокировку забрал другой менеджер.
+func (l *migrationLock) err() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.lost
+}
+
+// release прекращает продление и удаляет блокировку, если она всё ещё принадлежит этому менеджеру.
+func (l *migrationLock) release() {
+	close(l.stop)
+	<-l.done
+	ctx, cancel := context.WithTimeout(context.Background(), constants.ContextTimeout)
+	defer cancel()
+	if _, err := l.coll.DeleteOne(ctx, bson.M{"_id": lockId, "owner": l.owner}); err != nil {
+		logger.Log("Migrations", fmt.Sprintf("Ошибка освобождения блокировки миграций: %v", err))
+	}
+}
@@ -0,0 +1,93 @@
+package migrations
+
+import (
+	"context"
+	"fmt"
+
+	"common/constants"
+	"common/logger"
+	"manager/internal/subtasks"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Migration - изменение схемы базы данных. Применённые версии записываются в коллекцию schema_migrations,
+// поэтому каждая миграция выполняется один раз. Up должна быть безопасной для повторного запуска:
+// менеджер может упасть после Up, но до записи версии.
+type Migration struct {
+	Version     int
+	Description string
+	Up          func(ctx context.Context, db *mongo.Database) error
+}
+
+// All - миграции в порядке применения. Новая миграция добавляется в конец со следующей версией,
+// уже выпущенные миграции не меняются.
+var All = []Migration{
+	{Version: 1, Description: "индексы hash_tasks", Up: taskIndexes},
+	{Version: 2, Description: "уникальный индекс potfile по хешу", Up: potfileIndexes},
+	{Version: 3, Description: "индексы outbox и TTL отправленных записей", Up: outboxIndexes},
+	{Version: 4, Description: "индексы subtasks", Up: subTaskIndexes},
+	{Version: 5, Description: "перенос встроенных подзадач в коллекцию subtasks", Up: moveEmbeddedSubTasks},
+}
+
+// taskIndexes создаёт индексы коллекции задач: уникальный по requestId, по хешу (поиск существующей задачи
+// и проверенных диапазонов), по статусу (просмотр задач публикатором) и уникальный по dedupKey.
+// Задачи без dedupKey (пакетные, отменённые, созданные до появления ключа) в индекс dedupKey не попадают.
+func taskIndexes(ctx context.Context, db *mongo.Database) error {
+	return createIndexes(ctx, db.Collection(constants.TasksCollection), []mongo.IndexModel{
+		{Keys: bson.D{{Key: "requestId", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "hash", Value: 1}}},
+		{Keys: bson.D{{Key: "status", Value: 1}}},
+		{Keys: bson.D{{Key: "dedupKey", Value: 1}}, Options: options.Index().SetUnique(true).SetSparse(true)},
+	})
+}
+
+// potfileIndexes создаёт уникальный индекс potfile по хешу.
+func potfileIndexes(ctx context.Context, db *mongo.Database) error {
+	return createIndexes(ctx, db.Collection(constants.PotfileCollection), []mongo.IndexModel{
+		{Keys: bson.D{{Key: "hash", Value: 1}}, Options: options.Index().SetUnique(true)},
+	})
+}
+
+// outboxIndexes создаёт индекс, по которому relay выбирает неотправленные записи, и TTL-индекс,
+// удаляющий отправленные записи через constants.OutboxSentTTL.
+func outboxIndexes(ctx context.Context, db *mongo.Database) error {
+	return createIndexes(ctx, db.Collection(constants.OutboxCollection), []mongo.IndexModel{
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "createdAt", Value: 1}}},
+		{Keys: bson.D{{Key: "sentAt", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(int32(constants.OutboxSentTTL.Seconds()))},
+	})
+}
+
+// subTaskIndexes создаёт уникальный индекс подзадач по (requestId, subTaskNumber)
+// и индекс по (status, updatedAt) для поиска подзадач с истёкшей арендой.
+func subTaskIndexes(ctx context.Context, db *mongo.Database) error {
+	return createIndexes(ctx, db.Collection(constants.SubTasksCollection), []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "requestId", Value: 1}, {Key: "subTaskNumber", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "updatedAt", Value: 1}}},
+	})
+}
+
+// moveEmbeddedSubTasks переносит подзадачи задач, созданных прежними версиями менеджера, из документа задачи
+// в коллекцию subtasks (см. subtasks.Store.MigrateEmbedded).
+func moveEmbeddedSubTasks(ctx context.Context, db *mongo.Database) error {
+	subs := subtasks.NewStore(db.Collection(constants.SubTasksCollection))
+	migrated, err := subs.MigrateEmbedded(ctx, db.Collection(constants.TasksCollection))
+	if migrated > 0 {
+		logger.Log("Migrations", fmt.Sprintf("Подзадачи перенесены в отдельную коллекцию для задач: %d", migrated))
+	}
+	return err
+}
+
+// createIndexes создаёт индексы коллекции (и саму коллекцию, если её ещё нет).
+// Уже существующие индексы с теми же параметрами MongoDB пропускает.
+func createIndexes(ctx context.Context, coll *mongo.Collection, indexes []mongo.IndexModel) error {
+	if _, err := coll.Indexes().CreateMany(ctx, indexes); err != nil {
+		return fmt.Errorf("создание индексов %s: %w", coll.Name(), err)
+	}
+	return nil
+}
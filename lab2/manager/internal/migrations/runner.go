@@ -0,0 +1,94 @@
+package migrations
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"common/constants"
+	"common/logger"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Applied - запись о применённой миграции в коллекции schema_migrations.
+type Applied struct {
+	Version     int       `bson:"_id"`
+	Description string    `bson:"description"`
+	AppliedAt   time.Time `bson:"appliedAt"`
+}
+
+// Run применяет к базе данных миграции из All, которые ещё не применены, и возвращает их количество.
+// Миграции выполняются под блокировкой в schema_migrations, поэтому несколько менеджеров, запущенных
+// одновременно, не применяют одну миграцию дважды: остальные ждут, пока блокировка освободится.
+// Если миграция завершилась ошибкой, следующие не выполняются.
+func Run(ctx context.Context, db *mongo.Database) (int, error) {
+	coll := db.Collection(constants.MigrationsCollection)
+	lock, err := acquireLock(ctx, coll)
+	if err != nil {
+		return 0, fmt.Errorf("блокировка миграций: %w", err)
+	}
+	defer lock.release()
+
+	done, err := applied(ctx, coll)
+	if err != nil {
+		return 0, fmt.Errorf("чтение применённых миграций: %w", err)
+	}
+	count := 0
+	for _, m := range pending(done) {
+		if err := lock.err(); err != nil {
+			return count, err
+		}
+		logger.Log("Migrations", fmt.Sprintf("Применяется миграция %d: %s", m.Version, m.Description))
+		if err := m.Up(ctx, db); err != nil {
+			return count, fmt.Errorf("миграция %d (%s): %w", m.Version, m.Description, err)
+		}
+		record := Applied{Version: m.Version, Description: m.Description, AppliedAt: time.Now()}
+		if _, err := coll.InsertOne(ctx, record); err != nil {
+			return count, fmt.Errorf("запись версии %d: %w", m.Version, err)
+		}
+		count++
+	}
+	return count, nil
+}
+
+// Status возвращает применённые миграции и миграции из All, которые ещё не применены.
+func Status(ctx context.Context, db *mongo.Database) ([]Applied, []Migration, error) {
+	done, err := applied(ctx, db.Collection(constants.MigrationsCollection))
+	if err != nil {
+		return nil, nil, err
+	}
+	return done, pending(done), nil
+}
+
+// applied возвращает записи о применённых миграциях в порядке версий. У записей _id - номер версии,
+// а у блокировки - строка, поэтому она в выборку не попадает.
+func applied(ctx context.Context, coll *mongo.Collection) ([]Applied, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "_id", Value: 1}})
+	cursor, err := coll.Find(ctx, bson.M{"_id": bson.M{"$type": "number"}}, opts)
+	if err != nil {
+		return nil, err
+	}
+	var done []Applied
+	if err := cursor.All(ctx, &done); err != nil {
+		return nil, err
+	}
+	return done, nil
+}
+
+// pending возвращает миграции из All, версий которых нет среди done.
+func pending(done []Applied) []Migration {
+	seen := make(map[int]bool, len(done))
+	for _, m := range done {
+		seen[m.Version] = true
+	}
+	var rest []Migration
+	for _, m := range All {
+		if !seen[m.Version] {
+			rest = append(rest, m)
+		}
+	}
+	return rest
+}
@@ -0,0 +1,96 @@
+package outbox
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Статусы записей outbox
+const (
+	StatusPending = "PENDING"
+	StatusSent    = "SENT"
+)
+
+// Entry - сообщение подзадачи, ожидающее отправки в RabbitMQ. Запись добавляется в одной транзакции MongoDB
+// с изменением задачи, поэтому сообщение появляется тогда и только тогда, когда изменение сохранено.
+// Запись хранит только ссылку на подзадачу, а тело сообщения relay собирает из задачи и подзадачи при отправке.
+type Entry struct {
+	Key           string     `bson:"_id"` // ключ идемпотентности, он же MessageId сообщения AMQP
+	RequestId     string     `bson:"requestId"`
+	SubTaskNumber int        `bson:"subTaskNumber"`
+	Queue         string     `bson:"queue"`
+	Status        string     `bson:"status"` // StatusPending или StatusSent
+	CreatedAt     time.Time  `bson:"createdAt"`
+	SentAt        *time.Time `bson:"sentAt,omitempty"`
+}
+
+// Store - коллекция outbox: подзадачи, сообщения которых relay отправляет в RabbitMQ с подтверждениями брокера.
+// Отправленные записи хранятся constants.OutboxSentTTL и затем удаляются TTL-индексом.
+type Store struct {
+	coll   *mongo.Collection
+	notify chan struct{}
+}
+
+// Key возвращает ключ идемпотентности публикации подзадачи: номер попытки различает публикации одной
+// подзадачи после истечения аренды, а повторная доставка одного сообщения сохраняет ключ.
+func Key(requestId string, subTaskNumber, attempt int) string {
+	return fmt.Sprintf("%s:%d:%d", requestId, subTaskNumber, attempt)
+}
+
+// NewStore создаёт outbox поверх коллекции. Коллекцию и её индексы создаёт миграция схемы (см. migrations),
+// а не первая транзакция: старые версии MongoDB не создают коллекции внутри транзакций.
+func NewStore(coll *mongo.Collection) *Store {
+	return &Store{coll: coll, notify: make(chan struct{}, 1)}
+}
+
+// Add добавляет записи. ctx должен быть контекстом транзакции (mongo.SessionContext), в которой меняется задача.
+func (s *Store) Add(ctx context.Context, entries []Entry) error {
+	docs := make([]interface{}, len(entries))
+	for i := range entries {
+		docs[i] = entries[i]
+	}
+	_, err := s.coll.InsertMany(ctx, docs)
+	return err
+}
+
+// Notify будит relay после фиксации транзакции, не дожидаясь очередного опроса.
+func (s *Store) Notify() {
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+}
+
+// Wake возвращает канал, в который приходит сигнал Notify.
+func (s *Store) Wake() <-chan struct{} {
+	return s.notify
+}
+
+// Pending возвращает не более limit неотправленных записей в порядке добавления.
+func (s *Store) Pending(ctx context.Context, limit int) ([]Entry, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}}).SetLimit(int64(limit))
+	cursor, err := s.coll.Find(ctx, bson.M{"status": StatusPending}, opts)
+	if err != nil {
+		return nil, err
+	}
+	var entries []Entry
+	if err := cursor.All(ctx, &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// MarkSent отмечает запись отправленной.
+func (s *Store) MarkSent(ctx context.Context, key string) error {
+	now := time.Now()
+	_, err := s.coll.UpdateOne(ctx,
+		bson.M{"_id": key, "status": StatusPending},
+		bson.M{"$set": bson.M{"status": StatusSent, "sentAt": now}},
+	)
+	return err
+}
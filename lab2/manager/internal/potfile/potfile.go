@@ -0,0 +1,133 @@
+package potfile
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"io"
+	"time"
+
+	"common/hashlist"
+	"common/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Store - глобальный potfile: все когда-либо расшифрованные хеши и их пароли.
+// Менеджер проверяет его до постановки задачи, поэтому уже известный пароль возвращается без перебора.
+type Store struct {
+	coll *mongo.Collection
+}
+
+// ImportResult - итог импорта potfile.
+type ImportResult struct {
+	Imported int                  `json:"imported"` // новые записи
+	Existing int                  `json:"existing"` // хеши, которые уже были в potfile
+	Rejected []hashlist.LineError `json:"rejected,omitempty"`
+}
+
+// NewStore создаёт potfile поверх коллекции. Уникальный индекс по хешу создаёт миграция схемы (см. migrations).
+func NewStore(coll *mongo.Collection) *Store {
+	return &Store{coll: coll}
+}
+
+// Lookup возвращает известный пароль хеша.
+func (s *Store) Lookup(ctx context.Context, hash string) (string, bool, error) {
+	var entry models.PotEntry
+	err := s.coll.FindOne(ctx, bson.M{"hash": hash}).Decode(&entry)
+	if err == mongo.ErrNoDocuments {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return entry.Plain, true, nil
+}
+
+// LookupMany возвращает известные пароли для хешей списка (хеши без пароля в результат не попадают).
+func (s *Store) LookupMany(ctx context.Context, hashes []string) (map[string]string, error) {
+	found := make(map[string]string)
+	cursor, err := s.coll.Find(ctx, bson.M{"hash": bson.M{"$in": hashes}})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	for cursor.Next(ctx) {
+		var entry models.PotEntry
+		if err := cursor.Decode(&entry); err != nil {
+			return nil, err
+		}
+		found[entry.Hash] = entry.Plain
+	}
+	return found, cursor.Err()
+}
+
+// Save добавляет пароль хеша. Если хеш уже есть в potfile, запись не меняется.
+// Возвращает true, если запись добавлена.
+func (s *Store) Save(ctx context.Context, hash, plain, requestId string) (bool, error) {
+	entry := models.PotEntry{Hash: hash, Plain: plain, RequestId: requestId, CrackedAt: time.Now()}
+	res, err := s.coll.UpdateOne(ctx,
+		bson.M{"hash": hash},
+		bson.M{"$setOnInsert": entry},
+		options.Update().SetUpsert(true),
+	)
+	if err != nil {
+		return false, err
+	}
+	return res.UpsertedCount > 0, nil
+}
+
+// Export записывает все записи potfile в формате hashcat "hash:plain".
+func (s *Store) Export(ctx context.Context, w io.Writer) (int, error) {
+	cursor, err := s.coll.Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "crackedAt", Value: 1}}))
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+	count := 0
+	for cursor.Next(ctx) {
+		var entry models.PotEntry
+		if err := cursor.Decode(&entry); err != nil {
+			return count, err
+		}
+		if _, err := io.WriteString(w, hashlist.FormatPotLine(entry.Hash, entry.Plain)+"\n"); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, cursor.Err()
+}
+
+// Import добавляет записи potfile hashcat. Каждая пара проверяется: MD5 пароля должен совпадать с хешем,
+// иначе строка отклоняется - ошибочная запись выдавала бы неверный пароль без перебора.
+func (s *Store) Import(ctx context.Context, r io.Reader, opts hashlist.Options) (ImportResult, error) {
+	var result ImportResult
+	entries, rejected, err := hashlist.ParsePot(r, opts)
+	if err != nil {
+		return result, err
+	}
+	result.Rejected = rejected
+	for _, entry := range entries {
+		sum := md5.Sum([]byte(entry.Plain))
+		if hex.EncodeToString(sum[:]) != entry.Hash {
+			result.Rejected = append(result.Rejected, hashlist.LineError{
+				Line: entry.Line,
+				Text: hashlist.FormatPotLine(entry.Hash, entry.Plain),
+				Err:  "MD5 пароля не совпадает с хешем",
+			})
+			continue
+		}
+		added, err := s.Save(ctx, entry.Hash, entry.Plain, "")
+		if err != nil {
+			return result, err
+		}
+		if added {
+			result.Imported++
+		} else {
+			result.Existing++
+		}
+	}
+	return result, nil
+}
@@ -8,59 +8,273 @@ import (
 
 	"common/logger"
 	"common/models"
+	"common/mongodb"
+	"manager/internal/outbox"
+	"manager/internal/subtasks"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-// ProcessResult обновляет HashTask в базе данных на основе полученного результата подзадачи.
-// Отмечает подзадачу как завершенную и, если пароль найден или все подзадачи завершены,
-// обновляет общий статус задачи и результат.
-func ProcessResult(res models.ResultMessage, task models.HashTask, coll *mongo.Collection) error {
+// maxVersionRetries - сколько раз пересчитывается статус задачи, если её документ изменился между чтением и записью.
+const maxVersionRetries = 5
+
+// ErrSubTaskNotFound возвращается для результата подзадачи, которой нет в задаче.
+var ErrSubTaskNotFound = errors.New("subtask not found")
+
+// ErrVersionConflict возвращается, если статус задачи не удалось сохранить из-за постоянных конкурирующих изменений.
+var ErrVersionConflict = errors.New("task was modified concurrently")
+
+// ProcessResult применяет результат подзадачи к HashTask в базе данных. Применение идемпотентно:
+// подзадача отмечается как COMPLETE условным обновлением в одной транзакции с увеличением completedTaskCount,
+// поэтому повторная доставка результата ничего не меняет, а результаты разных подзадач не перезаписывают
+// друг друга. Затем по обновлённому документу определяется общий статус задачи (см. Settle). Когда пароль
+// найден, незавершённые подзадачи отмечаются как SKIPPED, а возвращаемое значение solved равно true:
+// воркерам нужно сообщить, что остальные подзадачи перебирать не нужно.
+func ProcessResult(res models.ResultMessage, task models.HashTask, coll *mongo.Collection, subs *subtasks.Store) (solved bool, err error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	// Отмечаем конкретную подзадачу как COMPLETE
-	subTaskFound := false
-	for i := range task.SubTasks {
-		if task.SubTasks[i].SubTaskNumber == res.SubTaskNumber {
-			task.SubTasks[i].Status = "COMPLETE"
-			task.SubTasks[i].UpdatedAt = time.Now()
-			subTaskFound = true
-			break
-		}
+	switch task.Status {
+	case "CANCELLED":
+		logger.LogTask("Processor", res.Hash, res.SubTaskNumber, task.SubTaskCount, "Задача отменена, результат проигнорирован")
+		return false, nil
+	case "DONE":
+		// Подзадача успела завершиться до того, как воркер узнал о найденном пароле
+		logger.LogTask("Processor", res.Hash, res.SubTaskNumber, task.SubTaskCount, "Пароль уже найден, результат проигнорирован")
+		return false, nil
 	}
-	if !subTaskFound {
+	subTask, err := subs.Get(ctx, task.RequestId, res.SubTaskNumber)
+	if errors.Is(err, mongo.ErrNoDocuments) {
 		logger.LogTask("Processor", res.Hash, res.SubTaskNumber, task.SubTaskCount, "Подзадача не найдена в структуре задачи")
-		return errors.New("subtask not found")
+		return false, ErrSubTaskNotFound
 	}
-
-	task.CompletedTaskCount++
-	if task.CompletedTaskCount == task.SubTaskCount {
-		logger.LogHash("Processor", task.Hash, "Все подзадачи завершены")
+	if err != nil {
+		return false, err
+	}
+	if res.IdempotencyKey != "" && subTask.ResultKey == res.IdempotencyKey {
+		// Повторная доставка уже применённого результата: подзадачу не обновляем, но статус задачи
+		// пересчитываем, если прошлая обработка не успела его сохранить
+		logger.LogTask("Processor", res.Hash, res.SubTaskNumber, task.SubTaskCount,
+			fmt.Sprintf("Результат %s уже применён, повтор проигнорирован", res.IdempotencyKey))
+		return Settle(ctx, coll, subs, task.RequestId)
 	}
 
-	if res.Result != "" {
-		task.Status = "DONE"
-		task.Result = res.Result
-		logger.LogHash("Processor", res.Hash, fmt.Sprintf("Хэш успешно расшифрован: %s", res.Result))
-	} else if task.CompletedTaskCount >= task.SubTaskCount && task.Result == "" {
-		task.Status = "FAIL"
-		logger.LogHash("Processor", res.Hash, "Хэш не расшифрован (задача отмечена как FAIL)")
-	}
-
-	update := bson.M{
-		"$set": bson.M{
-			"subTasks":           task.SubTasks,
-			"completedTaskCount": task.CompletedTaskCount,
-			"status":             task.Status,
-			"result":             task.Result,
-		},
-	}
-	_, err := coll.UpdateOne(ctx, bson.M{"hash": task.Hash}, update)
+	updated, applied, err := completeSubTask(ctx, coll, subs, task, res)
 	if err != nil {
 		logger.LogHash("Processor", task.Hash, fmt.Sprintf("Ошибка сохранения результата в БД: %v", err))
+		return false, err
+	}
+	if !applied {
+		// Повторная доставка, подзадача, опубликованная снова после истечения аренды, или задача,
+		// завершённая/отменённая после чтения. Статус задачи всё равно пересчитывается: прошлая попытка
+		// могла применить результат, но не сохранить статус
+		logger.LogTask("Processor", res.Hash, res.SubTaskNumber, task.SubTaskCount, "Подзадача уже завершена, повторный результат проигнорирован")
+		return Settle(ctx, coll, subs, task.RequestId)
+	}
+	if updated.CompletedTaskCount == updated.SubTaskCount {
+		logger.LogHash("Processor", updated.Hash, "Все подзадачи завершены")
+	}
+	for _, match := range res.Matches {
+		logger.LogHash("Processor", match.Hash, fmt.Sprintf("Хэш пакетной задачи %s расшифрован: %s", updated.RequestId, match.Result))
+	}
+
+	solved, err = settle(ctx, coll, subs, updated)
+	if err != nil {
+		logger.LogHash("Processor", task.Hash, fmt.Sprintf("Ошибка обновления статуса задачи: %v", err))
+	}
+	return solved, err
+}
+
+// ProcessHeartbeat применяет heartbeat воркера: подзадача, которую он перебирает, получает статус STARTED,
+// и её аренда отсчитывается заново (см. subtasks.Store.Heartbeat). Heartbeat подзадачи отменённой или завершённой
+// задачи и heartbeat прежней публикации подзадачи (ключ идемпотентности с другой попыткой) игнорируются.
+func ProcessHeartbeat(res models.ResultMessage, task models.HashTask, subs *subtasks.Store) error {
+	if task.Status != "IN_PROGRESS" || res.IdempotencyKey == "" {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	subTask, err := subs.Get(ctx, task.RequestId, res.SubTaskNumber)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return ErrSubTaskNotFound
+	}
+	if err != nil {
 		return err
 	}
-	return nil
+	if outbox.Key(task.RequestId, subTask.SubTaskNumber, subTask.Attempts) != res.IdempotencyKey {
+		return nil
+	}
+	err = subs.Heartbeat(ctx, task.RequestId, subTask.SubTaskNumber, subTask.Attempts, time.Now())
+	if errors.Is(err, subtasks.ErrUnchanged) {
+		return nil
+	}
+	if err == nil && subTask.Status == "PUBLISHED" {
+		logger.LogTask("Processor", res.Hash, res.SubTaskNumber, task.SubTaskCount, "Воркер начал перебор подзадачи")
+	}
+	return err
+}
+
+// completeSubTask в одной транзакции отмечает подзадачу как COMPLETE, увеличивает completedTaskCount и сохраняет
+// найденные пароли. Документы меняются, только если подзадача ещё не завершена, а задача не решена и не отменена
+// (FAIL допускается: результат мёртвой подзадачи может прийти после завершения задачи).
+// Возвращает задачу после обновления и false, если переход не произошёл.
+func completeSubTask(ctx context.Context, coll *mongo.Collection, subs *subtasks.Store, task models.HashTask, res models.ResultMessage) (models.HashTask, bool, error) {
+	set := bson.M{}
+	if len(task.Hashes) > 0 {
+		for _, match := range res.Matches {
+			set["results."+match.Hash] = match.Result
+		}
+	} else if res.Result != "" {
+		set["result"] = res.Result
+	}
+	filter := bson.M{"requestId": task.RequestId, "status": bson.M{"$in": bson.A{"IN_PROGRESS", "FAIL"}}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	// Выполняющаяся подзадача (RECEIVED - если её успели вернуть в очередь) или мёртвая:
+	// вместе с ней уменьшается соответствующий счётчик задачи
+	for _, from := range []string{"STARTED", "PUBLISHED", "RECEIVED", "DEAD"} {
+		inc := bson.M{"completedTaskCount": 1, "version": 1}
+		switch from {
+		case "RECEIVED":
+			inc["receivedTaskCount"] = -1
+		case "DEAD":
+			inc["deadTaskCount"] = -1
+		}
+		update := bson.M{"$inc": inc}
+		if len(set) > 0 {
+			update["$set"] = set
+		}
+
+		var updated models.HashTask
+		err := mongodb.WithTransaction(ctx, coll.Database().Client(), func(sc mongo.SessionContext) error {
+			if err := subs.Complete(sc, task.RequestId, res.SubTaskNumber, from, res.IdempotencyKey, time.Now()); err != nil {
+				return err
+			}
+			return coll.FindOneAndUpdate(sc, filter, update, opts).Decode(&updated)
+		})
+		switch {
+		case errors.Is(err, subtasks.ErrUnchanged):
+			continue
+		case errors.Is(err, mongo.ErrNoDocuments):
+			// Задача решена или отменена: подзадача остаётся как была
+			return models.HashTask{}, false, nil
+		case err != nil:
+			return models.HashTask{}, false, err
+		}
+		return updated, true, nil
+	}
+	return models.HashTask{}, false, nil
+}
+
+// errTaskChanged прерывает транзакцию, если задача изменилась после чтения.
+var errTaskChanged = errors.New("task changed since it was read")
+
+// Settle пересчитывает статус задачи по её документу и сохраняет его с проверкой версии: если документ
+// изменился после чтения, задача перечитывается и статус вычисляется заново. Возвращает true, если задача
+// решена досрочно (найден пароль, остальные подзадачи отмечены SKIPPED).
+func Settle(ctx context.Context, coll *mongo.Collection, subs *subtasks.Store, requestId string) (bool, error) {
+	var task models.HashTask
+	if err := coll.FindOne(ctx, bson.M{"requestId": requestId}).Decode(&task); err != nil {
+		return false, err
+	}
+	return settle(ctx, coll, subs, task)
+}
+
+// settle выполняет Settle для уже прочитанного документа задачи. Если задача решена досрочно,
+// незавершённые подзадачи отмечаются как SKIPPED в той же транзакции, что и новый статус задачи.
+func settle(ctx context.Context, coll *mongo.Collection, subs *subtasks.Store, task models.HashTask) (bool, error) {
+	requestId := task.RequestId
+	for attempt := 0; attempt < maxVersionRetries; attempt++ {
+		set, solved := nextStatus(&task)
+		if set == nil {
+			return false, nil
+		}
+		err := mongodb.WithTransaction(ctx, coll.Database().Client(), func(sc mongo.SessionContext) error {
+			if solved {
+				skipped, candidates, err := subs.SkipUnfinished(sc, requestId, time.Now())
+				if err != nil {
+					return err
+				}
+				set["receivedTaskCount"] = 0
+				set["skippedTaskCount"] = skipped
+				set["skippedCandidates"] = candidates.String()
+			}
+			res, err := coll.UpdateOne(sc,
+				bson.M{"requestId": requestId, "version": task.Version},
+				bson.M{"$set": set, "$inc": bson.M{"version": 1}},
+			)
+			if err != nil {
+				return err
+			}
+			if res.MatchedCount == 0 {
+				return errTaskChanged
+			}
+			return nil
+		})
+		if err == nil {
+			if solved {
+				logger.LogHash("Processor", task.Hash, fmt.Sprintf("Пропущено подзадач: %v из %d (кандидатов: %v)",
+					set["skippedTaskCount"], task.SubTaskCount, set["skippedCandidates"]))
+			}
+			return solved, nil
+		}
+		if !errors.Is(err, errTaskChanged) {
+			return false, err
+		}
+		task = models.HashTask{}
+		if err := coll.FindOne(ctx, bson.M{"requestId": requestId}).Decode(&task); err != nil {
+			return false, err
+		}
+	}
+	return false, ErrVersionConflict
+}
+
+// nextStatus определяет, как должен измениться статус задачи, и возвращает поля для $set
+// или nil, если менять нечего. Задача завершается досрочно (DONE, незавершённые подзадачи SKIPPED),
+// когда найден её пароль или пароли всех хешей пакетной задачи. Если выполняющихся подзадач не осталось,
+// задача получает DONE при хотя бы одном найденном пароле, иначе FAIL.
+// Возвращает true, если задача завершена досрочно.
+func nextStatus(task *models.HashTask) (bson.M, bool) {
+	if task.Status != "IN_PROGRESS" && task.Status != "FAIL" {
+		return nil, false
+	}
+	batch := len(task.Hashes) > 0
+	found := task.Result != ""
+	if batch {
+		found = len(task.Results) >= len(task.Hashes)
+	}
+
+	switch {
+	case found:
+		task.Status = "DONE"
+		if batch {
+			logger.LogHash("Processor", task.Hash, "Расшифрованы все хэши пакетной задачи")
+		} else {
+			logger.LogHash("Processor", task.Hash, fmt.Sprintf("Хэш успешно расшифрован: %s", task.Result))
+		}
+		return bson.M{"status": task.Status}, true
+	case !task.Exhausted():
+		return nil, false
+	}
+
+	status := "FAIL"
+	if batch && len(task.Results) > 0 {
+		status = "DONE"
+	}
+	if status == task.Status {
+		return nil, false
+	}
+	task.Status = status
+	switch {
+	case status == "DONE":
+		logger.LogHash("Processor", task.Hash, fmt.Sprintf("Расшифровано хэшей: %d из %d", len(task.Results), len(task.Hashes)))
+	case batch:
+		logger.LogHash("Processor", task.Hash, "Ни один хэш пакетной задачи не расшифрован (задача отмечена как FAIL)")
+	default:
+		logger.LogHash("Processor", task.Hash, "Хэш не расшифрован (задача отмечена как FAIL)")
+	}
+	return bson.M{"status": task.Status}, false
 }
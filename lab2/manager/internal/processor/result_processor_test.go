@@ -0,0 +1,383 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"common/models"
+	"common/mongodb"
+	"manager/internal/subtasks"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Тесты с базой данных запускаются, только если задан MONGODB_TEST_URI, например
+// MONGODB_TEST_URI=mongodb://localhost:27017 go test ./internal/processor/
+// Результаты применяются в транзакциях, поэтому MongoDB должна быть запущена как набор реплик.
+// Каждый тест работает в собственных коллекциях задач и подзадач и удаляет их после себя.
+func testCollection(t *testing.T) (*mongo.Collection, *subtasks.Store) {
+	t.Helper()
+	uri := os.Getenv("MONGODB_TEST_URI")
+	if uri == "" {
+		t.Skip("MONGODB_TEST_URI не задан")
+	}
+	client, db, err := mongodb.ConnectMongo(uri, "hash_cracker_test")
+	if err != nil {
+		t.Skipf("MongoDB недоступна: %v", err)
+	}
+	name := fmt.Sprintf("hash_tasks_%d", time.Now().UnixNano())
+	coll := db.Collection(name)
+	subColl := db.Collection(name + "_subtasks")
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = coll.Drop(ctx)
+		_ = subColl.Drop(ctx)
+		_ = client.Disconnect(ctx)
+	})
+	return coll, subtasks.NewStore(subColl)
+}
+
+// newTestTask возвращает задачу и её n опубликованных подзадач.
+func newTestTask(requestId string, n int) (models.HashTask, []models.SubTask) {
+	task := models.HashTask{
+		RequestId:    requestId,
+		Hash:         "098f6bcd4621d373cade4e832627b4f6",
+		MaxLength:    4,
+		Status:       "IN_PROGRESS",
+		SubTaskCount: n,
+	}
+	subTasks := make([]models.SubTask, n)
+	for i := range subTasks {
+		subTasks[i] = models.SubTask{RequestId: requestId, Hash: task.Hash, SubTaskNumber: i + 1, Status: "PUBLISHED"}
+	}
+	return task, subTasks
+}
+
+func insertTask(t *testing.T, coll *mongo.Collection, subs *subtasks.Store, task models.HashTask, subTasks []models.SubTask) {
+	t.Helper()
+	if _, err := coll.InsertOne(context.Background(), task); err != nil {
+		t.Fatal(err)
+	}
+	if err := subs.Insert(context.Background(), subTasks); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func loadTask(t *testing.T, coll *mongo.Collection, requestId string) models.HashTask {
+	t.Helper()
+	var task models.HashTask
+	if err := coll.FindOne(context.Background(), bson.M{"requestId": requestId}).Decode(&task); err != nil {
+		t.Fatal(err)
+	}
+	return task
+}
+
+func loadSubTask(t *testing.T, subs *subtasks.Store, requestId string, number int) models.SubTask {
+	t.Helper()
+	sub, err := subs.Get(context.Background(), requestId, number)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sub
+}
+
+// deliver обрабатывает результат так же, как consumer: с задачей, прочитанной перед обработкой.
+func deliver(t *testing.T, coll *mongo.Collection, subs *subtasks.Store, res models.ResultMessage) bool {
+	t.Helper()
+	solved, err := ProcessResult(res, loadTask(t, coll, res.RequestId), coll, subs)
+	if err != nil {
+		t.Fatalf("ProcessResult(%d): %v", res.SubTaskNumber, err)
+	}
+	return solved
+}
+
+func TestDuplicateResultCountedOnce(t *testing.T) {
+	coll, subs := testCollection(t)
+	task, subTasks := newTestTask("dup", 3)
+	insertTask(t, coll, subs, task, subTasks)
+
+	res := models.ResultMessage{RequestId: "dup", Hash: "098f6bcd4621d373cade4e832627b4f6", SubTaskNumber: 2}
+	for i := 0; i < 3; i++ {
+		deliver(t, coll, subs, res)
+	}
+
+	task = loadTask(t, coll, "dup")
+	if task.CompletedTaskCount != 1 {
+		t.Fatalf("completedTaskCount = %d, want 1", task.CompletedTaskCount)
+	}
+	if task.Status != "IN_PROGRESS" {
+		t.Fatalf("status = %s, want IN_PROGRESS", task.Status)
+	}
+	first, second := loadSubTask(t, subs, "dup", 1), loadSubTask(t, subs, "dup", 2)
+	if second.Status != "COMPLETE" || first.Status != "PUBLISHED" {
+		t.Fatalf("unexpected subtask statuses: %s, %s", first.Status, second.Status)
+	}
+}
+
+func TestIdempotencyKeyRecorded(t *testing.T) {
+	coll, subs := testCollection(t)
+	task, subTasks := newTestTask("key", 2)
+	insertTask(t, coll, subs, task, subTasks)
+
+	res := models.ResultMessage{IdempotencyKey: "key:1:0", RequestId: "key", Hash: "098f6bcd4621d373cade4e832627b4f6", SubTaskNumber: 1}
+	for i := 0; i < 2; i++ {
+		deliver(t, coll, subs, res)
+	}
+
+	if sub := loadSubTask(t, subs, "key", 1); sub.ResultKey != "key:1:0" {
+		t.Fatalf("resultKey = %q, want key:1:0", sub.ResultKey)
+	}
+	task = loadTask(t, coll, "key")
+	if task.CompletedTaskCount != 1 || task.Version != 1 {
+		t.Fatalf("completedTaskCount = %d, version = %d; want 1, 1", task.CompletedTaskCount, task.Version)
+	}
+}
+
+func TestStaleTaskSnapshotIsHarmless(t *testing.T) {
+	coll, subs := testCollection(t)
+	task, subTasks := newTestTask("stale", 2)
+	insertTask(t, coll, subs, task, subTasks)
+
+	// Оба сообщения прочитали задачу до того, как первое было применено
+	snapshot := loadTask(t, coll, "stale")
+	res := models.ResultMessage{RequestId: "stale", Hash: snapshot.Hash, SubTaskNumber: 1}
+	for i := 0; i < 2; i++ {
+		if _, err := ProcessResult(res, snapshot, coll, subs); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	task = loadTask(t, coll, "stale")
+	if task.CompletedTaskCount != 1 || task.Status != "IN_PROGRESS" {
+		t.Fatalf("completedTaskCount = %d, status = %s; want 1, IN_PROGRESS", task.CompletedTaskCount, task.Status)
+	}
+}
+
+func TestConcurrentResultsAllCounted(t *testing.T) {
+	coll, subs := testCollection(t)
+	const n = 20
+	task, subTasks := newTestTask("concurrent", n)
+	insertTask(t, coll, subs, task, subTasks)
+
+	snapshot := loadTask(t, coll, "concurrent")
+	var wg sync.WaitGroup
+	for i := 1; i <= n; i++ {
+		// Каждый результат доставляется дважды
+		for j := 0; j < 2; j++ {
+			wg.Add(1)
+			go func(number int) {
+				defer wg.Done()
+				res := models.ResultMessage{RequestId: "concurrent", Hash: snapshot.Hash, SubTaskNumber: number}
+				if _, err := ProcessResult(res, snapshot, coll, subs); err != nil {
+					t.Error(err)
+				}
+			}(i)
+		}
+	}
+	wg.Wait()
+
+	task = loadTask(t, coll, "concurrent")
+	if task.CompletedTaskCount != n {
+		t.Fatalf("completedTaskCount = %d, want %d", task.CompletedTaskCount, n)
+	}
+	if task.Status != "FAIL" {
+		t.Fatalf("status = %s, want FAIL", task.Status)
+	}
+	for i := 1; i <= n; i++ {
+		if sub := loadSubTask(t, subs, "concurrent", i); sub.Status != "COMPLETE" {
+			t.Fatalf("subtask %d status = %s, want COMPLETE", sub.SubTaskNumber, sub.Status)
+		}
+	}
+}
+
+func TestDuplicateSolvingResult(t *testing.T) {
+	coll, subs := testCollection(t)
+	task, subTasks := newTestTask("solved", 3)
+	insertTask(t, coll, subs, task, subTasks)
+
+	res := models.ResultMessage{RequestId: "solved", Hash: "098f6bcd4621d373cade4e832627b4f6", SubTaskNumber: 1, Result: "test"}
+	if !deliver(t, coll, subs, res) {
+		t.Fatal("first delivery should solve the task")
+	}
+	if deliver(t, coll, subs, res) {
+		t.Fatal("duplicate delivery should not report the task as solved again")
+	}
+
+	task = loadTask(t, coll, "solved")
+	if task.Status != "DONE" || task.Result != "test" {
+		t.Fatalf("status = %s, result = %q; want DONE, test", task.Status, task.Result)
+	}
+	if task.CompletedTaskCount != 1 || task.SkippedTaskCount != 2 {
+		t.Fatalf("completed = %d, skipped = %d; want 1, 2", task.CompletedTaskCount, task.SkippedTaskCount)
+	}
+}
+
+func TestLateResultOfDeadSubTask(t *testing.T) {
+	coll, subs := testCollection(t)
+	task, subTasks := newTestTask("dead", 2)
+	subTasks[0].Status = "COMPLETE"
+	subTasks[1].Status = "DEAD"
+	task.CompletedTaskCount = 1
+	task.DeadTaskCount = 1
+	task.Status = "FAIL"
+	insertTask(t, coll, subs, task, subTasks)
+
+	res := models.ResultMessage{RequestId: "dead", Hash: task.Hash, SubTaskNumber: 2, Result: "test"}
+	deliver(t, coll, subs, res)
+	deliver(t, coll, subs, res)
+
+	task = loadTask(t, coll, "dead")
+	if task.Status != "DONE" || task.Result != "test" {
+		t.Fatalf("status = %s, result = %q; want DONE, test", task.Status, task.Result)
+	}
+	if task.CompletedTaskCount != 2 || task.DeadTaskCount != 0 {
+		t.Fatalf("completed = %d, dead = %d; want 2, 0", task.CompletedTaskCount, task.DeadTaskCount)
+	}
+}
+
+func TestHeartbeatStartsLease(t *testing.T) {
+	coll, subs := testCollection(t)
+	task, subTasks := newTestTask("heartbeat", 2)
+	subTasks[1].Attempts = 1
+	insertTask(t, coll, subs, task, subTasks)
+
+	// Первая подзадача получена воркером, вторая ждёт в очереди; heartbeat прежней попытки не засчитывается
+	beats := []models.ResultMessage{
+		{IdempotencyKey: "heartbeat:1:0", RequestId: "heartbeat", Hash: task.Hash, SubTaskNumber: 1, Heartbeat: true},
+		{IdempotencyKey: "heartbeat:2:0", RequestId: "heartbeat", Hash: task.Hash, SubTaskNumber: 2, Heartbeat: true},
+	}
+	for _, res := range beats {
+		if err := ProcessHeartbeat(res, loadTask(t, coll, "heartbeat"), subs); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	first, second := loadSubTask(t, subs, "heartbeat", 1), loadSubTask(t, subs, "heartbeat", 2)
+	if first.Status != "STARTED" || second.Status != "PUBLISHED" {
+		t.Fatalf("statuses = %s, %s; want STARTED, PUBLISHED", first.Status, second.Status)
+	}
+	if task = loadTask(t, coll, "heartbeat"); task.Version != 0 {
+		t.Fatalf("version = %d, want 0: heartbeat must not change the task", task.Version)
+	}
+	stale, err := subs.Stale(context.Background(), "STARTED", time.Now().Add(time.Hour), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stale) != 1 || stale[0].SubTaskNumber != 1 {
+		t.Fatalf("stale = %v, want only subtask 1", stale)
+	}
+	// Подзадача, которую не получил ни один воркер, истекает по аренде очереди
+	queued, err := subs.Stale(context.Background(), "PUBLISHED", time.Now().Add(time.Hour), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(queued) != 1 || queued[0].SubTaskNumber != 2 {
+		t.Fatalf("queued = %v, want only subtask 2", queued)
+	}
+}
+
+func TestSettleDetectsVersionChange(t *testing.T) {
+	coll, subs := testCollection(t)
+	task, subTasks := newTestTask("version", 1)
+	subTasks[0].Status = "COMPLETE"
+	task.CompletedTaskCount = 1
+	insertTask(t, coll, subs, task, subTasks)
+
+	// Документ изменился после чтения: статус вычисляется заново по свежей версии
+	snapshot := loadTask(t, coll, "version")
+	if _, err := coll.UpdateOne(context.Background(), bson.M{"requestId": "version"},
+		bson.M{"$set": bson.M{"result": "test"}, "$inc": bson.M{"version": 1}}); err != nil {
+		t.Fatal(err)
+	}
+	solved, err := settle(context.Background(), coll, subs, snapshot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	task = loadTask(t, coll, "version")
+	if !solved || task.Status != "DONE" {
+		t.Fatalf("solved = %v, status = %s; want true, DONE", solved, task.Status)
+	}
+}
+
+func TestNextStatus(t *testing.T) {
+	tests := []struct {
+		name   string
+		task   models.HashTask
+		status string // "" - статус не меняется
+		solved bool
+	}{
+		{
+			name:   "in progress",
+			task:   models.HashTask{Status: "IN_PROGRESS", SubTaskCount: 3, CompletedTaskCount: 1},
+			status: "",
+		},
+		{
+			name:   "password found",
+			task:   models.HashTask{Status: "IN_PROGRESS", SubTaskCount: 3, CompletedTaskCount: 1, Result: "test"},
+			status: "DONE",
+			solved: true,
+		},
+		{
+			name:   "exhausted",
+			task:   models.HashTask{Status: "IN_PROGRESS", SubTaskCount: 3, CompletedTaskCount: 3},
+			status: "FAIL",
+		},
+		{
+			name:   "exhausted with dead subtasks",
+			task:   models.HashTask{Status: "IN_PROGRESS", SubTaskCount: 3, CompletedTaskCount: 2, DeadTaskCount: 1},
+			status: "FAIL",
+		},
+		{
+			name:   "already failed",
+			task:   models.HashTask{Status: "FAIL", SubTaskCount: 3, CompletedTaskCount: 3},
+			status: "",
+		},
+		{
+			name:   "cancelled",
+			task:   models.HashTask{Status: "CANCELLED", SubTaskCount: 3, CompletedTaskCount: 3, Result: "test"},
+			status: "",
+		},
+		{
+			name: "batch all found",
+			task: models.HashTask{Status: "IN_PROGRESS", SubTaskCount: 3, CompletedTaskCount: 1,
+				Hashes: []string{"a", "b"}, Results: map[string]string{"a": "1", "b": "2"}},
+			status: "DONE",
+			solved: true,
+		},
+		{
+			name: "batch exhausted with partial results",
+			task: models.HashTask{Status: "IN_PROGRESS", SubTaskCount: 3, CompletedTaskCount: 3,
+				Hashes: []string{"a", "b"}, Results: map[string]string{"a": "1"}},
+			status: "DONE",
+		},
+		{
+			name: "batch failed gets late partial result",
+			task: models.HashTask{Status: "FAIL", SubTaskCount: 3, CompletedTaskCount: 3,
+				Hashes: []string{"a", "b"}, Results: map[string]string{"a": "1"}},
+			status: "DONE",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			set, solved := nextStatus(&tt.task)
+			if solved != tt.solved {
+				t.Fatalf("solved = %v, want %v", solved, tt.solved)
+			}
+			if tt.status == "" {
+				if set != nil {
+					t.Fatalf("unexpected update %v", set)
+				}
+				return
+			}
+			if set == nil || set["status"] != tt.status {
+				t.Fatalf("update = %v, want status %s", set, tt.status)
+			}
+		})
+	}
+}
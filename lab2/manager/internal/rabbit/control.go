@@ -0,0 +1,64 @@
+package rabbit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"common/amqputil"
+	"common/constants"
+	"common/logger"
+	"common/models"
+
+	"github.com/streadway/amqp"
+)
+
+// ControlPublisher публикует управляющие сообщения в fanout-обменник "control".
+// Использует собственный канал сессии, который открывается заново после ошибки публикации.
+type ControlPublisher struct {
+	mu      sync.Mutex
+	session *amqputil.Session
+	ch      *amqp.Channel
+}
+
+// NewControlPublisher создаёт публикатор управляющих сообщений поверх сессии менеджера.
+func NewControlPublisher(session *amqputil.Session) *ControlPublisher {
+	return &ControlPublisher{session: session}
+}
+
+// Publish рассылает сообщение всем подключённым воркерам. Если соединения нет, ждёт его не дольше constants.ContextTimeout.
+// Канал, закрытый вместе с прежним соединением, заменяется новым, и публикация повторяется один раз.
+func (p *ControlPublisher) Publish(msg models.ControlMessage) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for attempt := 0; attempt < 2; attempt++ {
+		if p.ch == nil {
+			ctx, cancel := context.WithTimeout(context.Background(), constants.ContextTimeout)
+			p.ch, err = p.session.Channel(ctx)
+			cancel()
+			if err != nil {
+				return err
+			}
+		}
+		err = p.ch.Publish(constants.ControlExchange, "", false, false, amqp.Publishing{
+			ContentType: "application/json",
+			Body:        data,
+		})
+		if err == nil {
+			break
+		}
+		_ = p.ch.Close()
+		p.ch = nil
+	}
+	if err != nil {
+		return err
+	}
+	logger.LogHash("Control", msg.Hash, fmt.Sprintf("Отправлено управляющее сообщение %s (RequestId=%s)", msg.Type, msg.RequestId))
+	return nil
+}
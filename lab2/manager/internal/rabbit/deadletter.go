@@ -0,0 +1,174 @@
+package rabbit
+
+import (
+	"context"
+	"fmt"
+
+	"common/amqputil"
+	"common/constants"
+	"common/logger"
+	"common/models"
+
+	"github.com/streadway/amqp"
+)
+
+// deadLetterQueues - рабочие очереди, для которых ведутся очереди недоставленных сообщений.
+var deadLetterQueues = []string{constants.TasksQueue, constants.ResultsQueue}
+
+// DeadLetterAdmin просматривает, переотправляет и очищает очереди недоставленных сообщений.
+// Каждая операция открывает собственный канал сессии менеджера.
+type DeadLetterAdmin struct {
+	session *amqputil.Session
+}
+
+// NewDeadLetterAdmin создаёт администратора очередей недоставленных сообщений.
+func NewDeadLetterAdmin(session *amqputil.Session) *DeadLetterAdmin {
+	return &DeadLetterAdmin{session: session}
+}
+
+// Inspect возвращает количество сообщений в DLQ рабочей очереди queue и не более limit первых из них.
+// Сообщения читаются без подтверждения и возвращаются в DLQ при закрытии канала.
+func (a *DeadLetterAdmin) Inspect(queue string, limit int) (int, []models.DeadLetter, error) {
+	ch, err := a.channel(queue)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer ch.Close()
+
+	dlq := amqputil.DeadLetterQueue(queue)
+	state, err := ch.QueueInspect(dlq)
+	if err != nil {
+		return 0, nil, err
+	}
+	letters := []models.DeadLetter{}
+	for len(letters) < limit {
+		d, ok, err := ch.Get(dlq, false)
+		if err != nil {
+			return 0, nil, err
+		}
+		if !ok {
+			break
+		}
+		letters = append(letters, deadLetter(queue, d))
+	}
+	return state.Messages, letters, nil
+}
+
+// Replay переотправляет не более limit сообщений из DLQ в рабочую очередь queue со сброшенными
+// причиной и счётчиком попыток. Сообщение удаляется из DLQ только после подтверждения брокером копии.
+func (a *DeadLetterAdmin) Replay(queue string, limit int) (int, error) {
+	ch, err := a.channel(queue)
+	if err != nil {
+		return 0, err
+	}
+	defer ch.Close()
+	pub, err := amqputil.NewConfirmPublisher(ch, constants.PublishConfirmTimeout)
+	if err != nil {
+		return 0, err
+	}
+
+	dlq := amqputil.DeadLetterQueue(queue)
+	replayed := 0
+	for replayed < limit {
+		d, ok, err := ch.Get(dlq, false)
+		if err != nil {
+			return replayed, err
+		}
+		if !ok {
+			break
+		}
+		headers := amqp.Table{}
+		for k, v := range d.Headers {
+			switch k {
+			case amqputil.HeaderReason, amqputil.HeaderOriginalQueue, amqputil.HeaderRejectedAt,
+				amqputil.HeaderRejectedBy, amqputil.HeaderRetryCount, "x-death":
+				continue
+			}
+			headers[k] = v
+		}
+		err = pub.Publish("", queue, amqp.Publishing{
+			Headers:      headers,
+			ContentType:  d.ContentType,
+			DeliveryMode: amqp.Persistent,
+			MessageId:    d.MessageId,
+			Timestamp:    d.Timestamp,
+			Body:         d.Body,
+		})
+		if err != nil {
+			_ = d.Nack(false, true)
+			return replayed, err
+		}
+		if err := d.Ack(false); err != nil {
+			return replayed, err
+		}
+		replayed++
+	}
+	logger.Log("DLQ", fmt.Sprintf("Переотправлено сообщений из %s в '%s': %d", dlq, queue, replayed))
+	return replayed, nil
+}
+
+// Purge удаляет все сообщения из DLQ рабочей очереди queue и возвращает их количество.
+func (a *DeadLetterAdmin) Purge(queue string) (int, error) {
+	ch, err := a.channel(queue)
+	if err != nil {
+		return 0, err
+	}
+	defer ch.Close()
+
+	dlq := amqputil.DeadLetterQueue(queue)
+	purged, err := ch.QueuePurge(dlq, false)
+	if err != nil {
+		return 0, err
+	}
+	logger.Log("DLQ", fmt.Sprintf("Очередь %s очищена, удалено сообщений: %d", dlq, purged))
+	return purged, nil
+}
+
+// channel открывает канал (дожидаясь соединения не дольше constants.ContextTimeout) и объявляет очередь queue вместе с её DLQ.
+func (a *DeadLetterAdmin) channel(queue string) (*amqp.Channel, error) {
+	if !isDeadLetterQueue(queue) {
+		return nil, fmt.Errorf("unknown queue %q", queue)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), constants.ContextTimeout)
+	defer cancel()
+	ch, err := a.session.Channel(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := amqputil.DeclareQueue(ch, queue); err != nil {
+		_ = ch.Close()
+		return nil, err
+	}
+	return ch, nil
+}
+
+// isDeadLetterQueue сообщает, ведётся ли для очереди queue очередь недоставленных сообщений.
+func isDeadLetterQueue(queue string) bool {
+	for _, q := range deadLetterQueues {
+		if q == queue {
+			return true
+		}
+	}
+	return false
+}
+
+// deadLetter описывает сообщение из DLQ. Для сообщений, отклонённых без заголовка с причиной
+// (basic.nack с requeue=false), причина берётся из заголовка x-death, который добавляет брокер.
+func deadLetter(queue string, d amqp.Delivery) models.DeadLetter {
+	letter := models.DeadLetter{
+		Queue:      queue,
+		Reason:     amqputil.HeaderString(d.Headers, amqputil.HeaderReason),
+		RejectedBy: amqputil.HeaderString(d.Headers, amqputil.HeaderRejectedBy),
+		RejectedAt: amqputil.HeaderString(d.Headers, amqputil.HeaderRejectedAt),
+		RetryCount: amqputil.RetryCount(d.Headers),
+		Body:       string(d.Body),
+	}
+	if letter.Reason == "" {
+		if deaths, ok := d.Headers["x-death"].([]interface{}); ok && len(deaths) > 0 {
+			if death, ok := deaths[0].(amqp.Table); ok {
+				letter.Reason = fmt.Sprintf("x-death: %v", death["reason"])
+			}
+		}
+	}
+	return letter
+}
@@ -3,6 +3,7 @@ package rabbit
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"time"
 
@@ -10,163 +11,254 @@ import (
 	"common/constants"
 	"common/logger"
 	"common/models"
+	"common/mongodb"
+	"manager/internal/outbox"
+	"manager/internal/potfile"
 	"manager/internal/processor"
+	"manager/internal/subtasks"
 
 	"github.com/streadway/amqp"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
-// StartPublisher проверяет базу данных на наличие задач с подзадачами в статусе "RECEIVED" и публикует их в очередь "tasks".
-func StartPublisher(coll *mongo.Collection, connPtr **amqp.Connection, rabbitURI string, ch *amqp.Channel) {
-	publishLimit := constants.PublishLimit
+// StartPublisher ставит подзадачи в статусе "RECEIVED" в очередь "tasks" через outbox: в одной транзакции MongoDB
+// подзадачи отмечаются как PUBLISHED и в outbox добавляются ссылки на них, по которым затем отправляет сообщения relay
+// (см. StartOutboxRelay). Поэтому сбой менеджера не может ни потерять подзадачу, ни опубликовать её без отметки.
+// О новых подзадачах публикатор узнаёт из change stream коллекции задач (см. watchReceived), а полный просмотр
+// коллекции выполняется при запуске и раз в constants.PublisherScanInterval как страховка.
+// Resume token обработанного события сохраняется в tokens, поэтому перезапущенный менеджер продолжает поток с того же места.
+func StartPublisher(coll, tokens *mongo.Collection, subs *subtasks.Store, box *outbox.Store) {
+	events := make(chan taskEvent, streamBuffer)
+	go watchReceived(coll, tokens, events)
+
+	scanReceived(coll, subs, box)
+	ticker := time.NewTicker(constants.PublisherScanInterval)
+	defer ticker.Stop()
 	for {
-		ctx, cancel := context.WithTimeout(context.Background(), constants.LongContextTimeout)
-		cursor, err := coll.Find(ctx, models.BsonFilterReceived())
-		if err != nil {
-			cancel()
-			logger.Log("Publisher", fmt.Sprintf("Ошибка получения задач: %v", err))
-			time.Sleep(5 * time.Second)
-			continue
+		select {
+		case event := <-events:
+			publishEvent(coll, tokens, subs, box, event)
+		case <-ticker.C:
+			scanReceived(coll, subs, box)
 		}
-		publishedCount := 0
+	}
+}
+
+// scanReceived просматривает коллекцию и ставит в outbox не более constants.PublishLimit подзадач в статусе "RECEIVED".
+func scanReceived(coll *mongo.Collection, subs *subtasks.Store, box *outbox.Store) {
+	ctx, cancel := context.WithTimeout(context.Background(), constants.LongContextTimeout)
+	defer cancel()
+	cursor, err := coll.Find(ctx, models.BsonFilterReceived())
+	if err != nil {
+		logger.Log("Publisher", fmt.Sprintf("Ошибка получения задач: %v", err))
+		return
+	}
+	defer cursor.Close(ctx)
+
+	publishedCount := 0
+	for publishedCount < constants.PublishLimit && cursor.Next(ctx) {
+		// Новая переменная на каждую задачу: Decode не очищает поля, отсутствующие в документе
 		var task models.HashTask
-		for cursor.Next(ctx) {
-			if err := cursor.Decode(&task); err != nil {
-				logger.Log("Publisher", fmt.Sprintf("Ошибка декодирования задачи: %v", err))
-				continue
-			}
-			taskUpdated := false
-			for i := range task.SubTasks {
-				subTask := &task.SubTasks[i]
-				if subTask.Status != "RECEIVED" {
-					continue
-				}
-				if publishedCount >= publishLimit {
-					break
-				}
-
-				msg := models.TaskMessage{
-					Hash:          subTask.Hash,
-					MaxLength:     task.MaxLength,
-					SubTaskNumber: subTask.SubTaskNumber,
-					SubTaskCount:  task.SubTaskCount,
-				}
-				data, err := json.Marshal(msg)
-				if err != nil {
-					logger.LogTask("Publisher", subTask.Hash, subTask.SubTaskNumber, task.SubTaskCount,
-						fmt.Sprintf("Ошибка маршалинга: %v", err))
-					continue
-				}
-
-				err = ch.Publish(
-					"",
-					constants.TasksQueue,
-					false,
-					false,
-					amqp.Publishing{
-						ContentType:  "application/json",
-						Body:         data,
-						DeliveryMode: amqp.Persistent,
-					},
-				)
-				if err != nil {
-					logger.LogTask("Publisher", subTask.Hash, subTask.SubTaskNumber, task.SubTaskCount,
-						fmt.Sprintf("Ошибка публикации: %v", err))
-					newCh, recErr := amqputil.Reconnect(connPtr, rabbitURI, constants.TasksQueue, 0, constants.DefaultChannelRetries)
-					if recErr != nil {
-						logger.Log("Publisher", fmt.Sprintf("Не удалось восстановить соединение RabbitMQ для задачи %s: %v", task.RequestId, recErr))
-					} else {
-						ch = newCh
-					}
-					break
-				}
-				subTask.Status = "PUBLISHED"
-				subTask.UpdatedAt = time.Now()
-				publishedCount++
-				taskUpdated = true
-			}
-			if taskUpdated {
-				_, err := coll.UpdateOne(ctx,
-					bson.M{"requestId": task.RequestId},
-					bson.M{"$set": bson.M{"subTasks": task.SubTasks}},
-				)
-				if err != nil {
-					logger.Log("Publisher", fmt.Sprintf("Ошибка обновления задачи %s: %v", task.RequestId, err))
-				}
-			}
-			if publishedCount >= publishLimit {
-				break
-			}
+		if err := cursor.Decode(&task); err != nil {
+			logger.Log("Publisher", fmt.Sprintf("Ошибка декодирования задачи: %v", err))
+			continue
 		}
-		cursor.Close(ctx)
-		cancel()
-		if publishedCount > 0 {
-			logger.Log("Publisher", fmt.Sprintf("Опубликовано %d подзадач(и) в очередь", publishedCount))
+		count, err := publishTask(ctx, coll, subs, box, task, constants.PublishLimit-publishedCount)
+		if err != nil {
+			logger.Log("Publisher", fmt.Sprintf("Ошибка публикации подзадач задачи %s: %v", task.RequestId, err))
+			continue
 		}
-		time.Sleep(constants.ContextTimeout)
+		publishedCount += count
+	}
+	if publishedCount > 0 {
+		logger.Log("Publisher", fmt.Sprintf("Просмотр коллекции: в outbox поставлено %d подзадач(и)", publishedCount))
 	}
 }
 
-// StartResultConsumer слушает очередь "results" для получения результатов подзадач и обновляет базу данных соответствующим образом.
-func StartResultConsumer(ch *amqp.Channel, coll *mongo.Collection, connPtr **amqp.Connection, rabbitURI string) {
-	for {
-		// Проверяем существование очереди "results"
-		_, err := ch.QueueDeclare(constants.ResultsQueue, true, false, false, false, nil)
+// errTaskChanged прерывает транзакцию публикации, если задача изменилась после чтения.
+var errTaskChanged = errors.New("task changed since it was read")
+
+// publishTask ставит в outbox не более limit подзадач задачи task в статусе "RECEIVED" и в той же транзакции
+// отмечает их как PUBLISHED, уменьшая receivedTaskCount задачи. Транзакция выполняется, только если версия задачи
+// не изменилась с момента чтения (каждое изменение подзадач увеличивает версию их задачи); иначе ничего
+// не меняется, а подзадачи будут опубликованы по событию, которое породило изменение.
+// Возвращает количество поставленных в outbox подзадач.
+func publishTask(ctx context.Context, coll *mongo.Collection, subs *subtasks.Store, box *outbox.Store, task models.HashTask, limit int) (int, error) {
+	received, err := subs.Received(ctx, task.RequestId, limit)
+	if err != nil {
+		return 0, err
+	}
+
+	now := time.Now()
+	published := make([]int, len(received))
+	entries := make([]outbox.Entry, len(received))
+	for i, subTask := range received {
+		published[i] = subTask.SubTaskNumber
+		entries[i] = outbox.Entry{
+			Key:           outbox.Key(task.RequestId, subTask.SubTaskNumber, subTask.Attempts),
+			RequestId:     task.RequestId,
+			SubTaskNumber: subTask.SubTaskNumber,
+			Queue:         constants.TasksQueue,
+			Status:        outbox.StatusPending,
+			CreatedAt:     now,
+		}
+	}
+	if len(entries) == 0 {
+		return 0, nil
+	}
+
+	err = mongodb.WithTransaction(ctx, coll.Database().Client(), func(sc mongo.SessionContext) error {
+		res, err := coll.UpdateOne(sc,
+			bson.M{"requestId": task.RequestId, "status": "IN_PROGRESS", "version": task.Version},
+			bson.M{"$inc": bson.M{"receivedTaskCount": -len(published), "version": 1}},
+		)
 		if err != nil {
-			logger.Log("Consumer", fmt.Sprintf("Ошибка объявления очереди 'results': %v", err))
-			newCh, recErr := amqputil.Reconnect(connPtr, rabbitURI, constants.ResultsQueue, 0, 5)
-			if recErr != nil {
-				logger.Log("Consumer", fmt.Sprintf("Не удалось восстановить подключение RabbitMQ: %v", recErr))
-				time.Sleep(5 * time.Second)
-				continue
-			}
-			ch = newCh
-			continue
+			return err
+		}
+		if res.MatchedCount == 0 {
+			return errTaskChanged
 		}
+		if err := subs.MarkPublished(sc, task.RequestId, published, now); err != nil {
+			return err
+		}
+		return box.Add(sc, entries)
+	})
+	if errors.Is(err, errTaskChanged) || errors.Is(err, subtasks.ErrUnchanged) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	box.Notify()
+	return len(entries), nil
+}
 
+// StartResultConsumer слушает очередь "results" для получения результатов подзадач и обновляет базу данных соответствующим образом.
+// Когда пароль найден, через control рассылается сигнал "solved", чтобы воркеры бросили остальные подзадачи,
+// а сам пароль сохраняется в potfile. Consumer работает на собственном канале сессии и перезапускается вместе с ним.
+func StartResultConsumer(coll *mongo.Collection, subs *subtasks.Store, session *amqputil.Session, control *ControlPublisher, pot *potfile.Store) {
+	session.Run("Consumer", func(ch *amqp.Channel) error {
 		msgs, err := ch.Consume(constants.ResultsQueue, "", false, false, false, false, nil)
 		if err != nil {
-			logger.Log("Consumer", fmt.Sprintf("Ошибка регистрации consumer на очереди 'results': %v", err))
-			newCh, recErr := amqputil.Reconnect(connPtr, rabbitURI, constants.ResultsQueue, 0, 5)
-			if recErr != nil {
-				logger.Log("Consumer", fmt.Sprintf("Не удалось восстановить подключение RabbitMQ: %v", recErr))
-				time.Sleep(5 * time.Second)
-				continue
-			}
-			ch = newCh
-			continue
+			return fmt.Errorf("регистрация consumer на очереди 'results': %w", err)
+		}
+		// Через этот же канал сообщения отправляются в DLQ и повторно в очередь после временных ошибок
+		retries, err := amqputil.NewConfirmPublisher(ch, constants.PublishConfirmTimeout)
+		if err != nil {
+			return err
 		}
 		logger.Log("Consumer", "Consumer для очереди 'results' запущен")
-		processResults(msgs, coll)
-		logger.Log("Consumer", "Обработка результатов завершена, перезапуск consumer...")
-	}
+		processResults(msgs, coll, subs, control, pot, retries)
+		return nil
+	})
 }
 
 // processResults читает сообщения из канала results и обновляет задачи в базе данных для каждого результата.
-func processResults(msgs <-chan amqp.Delivery, coll *mongo.Collection) {
+// Сообщения, которые невозможно обработать (не декодируются, не содержат requestId, задача или подзадача
+// не найдены), отправляются в очередь "results.dead" с причиной; после временных ошибок (недоступна MongoDB)
+// сообщение повторяется.
+func processResults(msgs <-chan amqp.Delivery, coll *mongo.Collection, subs *subtasks.Store, control *ControlPublisher, pot *potfile.Store, retries *amqputil.ConfirmPublisher) {
 	for msg := range msgs {
 		var res models.ResultMessage
 		if err := json.Unmarshal(msg.Body, &res); err != nil {
 			logger.Log("Consumer", fmt.Sprintf("Ошибка декодирования результата: %v", err))
-			msg.Ack(false) // подтверждаем плохое сообщение для удаления из очереди
+			amqputil.Reject(retries, msg, constants.ResultsQueue, "Consumer", fmt.Sprintf("invalid JSON: %v", err))
+			continue
+		}
+
+		if res.RequestId == "" {
+			logger.LogHash("Consumer", res.Hash, "Результат без requestId отклонён")
+			amqputil.Reject(retries, msg, constants.ResultsQueue, "Consumer", "missing requestId")
 			continue
 		}
 
 		var task models.HashTask
-		err := coll.FindOne(context.Background(), bson.M{"hash": res.Hash}).Decode(&task)
-		if err != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), constants.ContextTimeout)
+		err := coll.FindOne(ctx, models.BsonFilterResult(res)).Decode(&task)
+		cancel()
+		if errors.Is(err, mongo.ErrNoDocuments) {
 			logger.LogHash("Consumer", res.Hash, "Задача для данного хэша не найдена")
+			amqputil.Reject(retries, msg, constants.ResultsQueue, "Consumer", fmt.Sprintf("task not found (requestId=%q)", res.RequestId))
+			continue
+		}
+		if err != nil {
+			amqputil.Retry(retries, msg, constants.ResultsQueue, "Consumer", fmt.Sprintf("reading task: %v", err))
+			continue
+		}
+
+		if res.Heartbeat {
+			// Потерянный heartbeat не страшен: воркер пришлёт следующий, поэтому сообщение не повторяется
+			if err := processor.ProcessHeartbeat(res, task, subs); err != nil {
+				logger.LogTask("Consumer", res.Hash, res.SubTaskNumber, task.SubTaskCount, fmt.Sprintf("Ошибка продления аренды: %v", err))
+			}
 			msg.Ack(false)
 			continue
 		}
 
 		logger.LogTask("Consumer", res.Hash, res.SubTaskNumber, task.SubTaskCount, fmt.Sprintf("Получен результат: %s", res.Result))
 
-		if err := processor.ProcessResult(res, task, coll); err != nil {
+		// Пароль сохраняется даже для отменённой или уже решённой задачи: он верен и пригодится следующим запросам
+		savePasswords(res, task, pot)
+
+		solved, err := processor.ProcessResult(res, task, coll, subs)
+		if errors.Is(err, processor.ErrSubTaskNotFound) {
+			amqputil.Reject(retries, msg, constants.ResultsQueue, "Consumer", fmt.Sprintf("subtask %d not found in task %s", res.SubTaskNumber, task.RequestId))
+			continue
+		}
+		if err != nil {
 			logger.LogTask("Consumer", res.Hash, res.SubTaskNumber, task.SubTaskCount, fmt.Sprintf("Ошибка обновления задачи: %v", err))
+			// Применённый результат при повторе не учитывается второй раз, а статус задачи пересчитывается
+			amqputil.Retry(retries, msg, constants.ResultsQueue, "Consumer", fmt.Sprintf("updating task: %v", err))
+			continue
+		}
+		if solved {
+			signal := models.ControlMessage{Type: constants.ControlSolved, RequestId: task.RequestId, Hash: task.Hash}
+			if err := control.Publish(signal); err != nil {
+				logger.LogHash("Consumer", task.Hash, fmt.Sprintf("Не удалось разослать сигнал о найденном пароле: %v", err))
+			}
 		}
 		msg.Ack(false)
 	}
 	logger.Log("Consumer", "Канал результатов закрыт")
 }
+
+// savePasswords добавляет в potfile пароли, найденные подзадачей.
+func savePasswords(res models.ResultMessage, task models.HashTask, pot *potfile.Store) {
+	matches := res.Matches
+	if len(task.Hashes) == 0 && res.Result != "" {
+		matches = []models.HashMatch{{Hash: task.Hash, Result: res.Result}}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), constants.ContextTimeout)
+	defer cancel()
+	for _, match := range matches {
+		if _, err := pot.Save(ctx, match.Hash, match.Result, task.RequestId); err != nil {
+			logger.LogHash("Consumer", match.Hash, fmt.Sprintf("Ошибка сохранения пароля в potfile: %v", err))
+		}
+	}
+}
+
+// taskMessage собирает сообщение подзадачи subTask задачи task с ключом идемпотентности key.
+func taskMessage(task models.HashTask, subTask models.SubTask, key string) models.TaskMessage {
+	return models.TaskMessage{
+		IdempotencyKey: key,
+		RequestId:      task.RequestId,
+		Hash:           subTask.Hash,
+		Batch:          len(task.Hashes) > 0,
+		Mode:           task.Mode,
+		Alphabet:       task.Alphabet,
+		MinLength:      task.MinLength,
+		MaxLength:      task.MaxLength,
+		SubTaskNumber:  subTask.SubTaskNumber,
+		SubTaskCount:   task.SubTaskCount,
+		Wordlist:       task.Wordlist,
+		Rules:          task.Rules,
+		Mask:           task.Mask,
+		Charsets:       task.Charsets,
+		RangeStart:     subTask.RangeStart,
+		RangeEnd:       subTask.RangeEnd,
+		WordOffset:     subTask.WordOffset,
+		StartLine:      subTask.StartLine,
+		LineCount:      subTask.LineCount,
+	}
+}
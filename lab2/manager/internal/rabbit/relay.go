@@ -0,0 +1,138 @@
+package rabbit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"common/amqputil"
+	"common/constants"
+	"common/logger"
+	"common/models"
+	"manager/internal/outbox"
+	"manager/internal/subtasks"
+
+	"github.com/streadway/amqp"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// StartOutboxRelay отправляет записи outbox в RabbitMQ через собственный канал сессии в режиме подтверждений.
+// Тело сообщения собирается при отправке из задачи и подзадачи, на которую ссылается запись (см. buildBody).
+// Запись отмечается отправленной только после подтверждения брокера; если менеджер упадёт между подтверждением
+// и отметкой, сообщение будет отправлено повторно с тем же ключом идемпотентности (MessageId), и получатели
+// отбросят повтор. Relay просыпается по сигналу публикатора и раз в constants.OutboxPollInterval.
+func StartOutboxRelay(box *outbox.Store, coll *mongo.Collection, subs *subtasks.Store, session *amqputil.Session) {
+	session.Run("Outbox Relay", func(ch *amqp.Channel) error {
+		publisher, err := amqputil.NewConfirmPublisher(ch, constants.PublishConfirmTimeout)
+		if err != nil {
+			return err
+		}
+		ticker := time.NewTicker(constants.OutboxPollInterval)
+		defer ticker.Stop()
+		for {
+			if err := relayPending(box, coll, subs, publisher); err != nil {
+				return err
+			}
+			select {
+			case <-box.Wake():
+			case <-ticker.C:
+			}
+		}
+	})
+}
+
+// relayPending отправляет неотправленные записи пачками по constants.PublishLimit, пока они не кончатся.
+// Ошибка возвращается только при сбое публикации: канал после него непригоден. Ошибки MongoDB записываются в журнал.
+func relayPending(box *outbox.Store, coll *mongo.Collection, subs *subtasks.Store, publisher *amqputil.ConfirmPublisher) error {
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), constants.LongContextTimeout)
+		sent, full, err := relayBatch(ctx, box, coll, subs, publisher)
+		cancel()
+		if sent > 0 {
+			logger.Log("Outbox Relay", fmt.Sprintf("Отправлено %d сообщений(я) в RabbitMQ", sent))
+		}
+		if err != nil || !full {
+			return err
+		}
+	}
+}
+
+// relayBatch отправляет одну пачку записей. full сообщает, что пачка отправлена целиком и могут быть ещё записи.
+func relayBatch(ctx context.Context, box *outbox.Store, coll *mongo.Collection, subs *subtasks.Store, publisher *amqputil.ConfirmPublisher) (sent int, full bool, err error) {
+	entries, err := box.Pending(ctx, constants.PublishLimit)
+	if err != nil {
+		logger.Log("Outbox Relay", fmt.Sprintf("Ошибка чтения outbox: %v", err))
+		return 0, false, nil
+	}
+	tasks := make(map[string]*models.HashTask) // задачи пачки по requestId, nil - задача не найдена
+	for _, entry := range entries {
+		body, err := buildBody(ctx, coll, subs, tasks, entry)
+		if err != nil {
+			logger.Log("Outbox Relay", fmt.Sprintf("Ошибка чтения подзадачи %s: %v", entry.Key, err))
+			return sent, false, nil
+		}
+		if body != nil {
+			err = publisher.Publish("", entry.Queue, amqp.Publishing{
+				ContentType:  "application/json",
+				Body:         body,
+				DeliveryMode: amqp.Persistent,
+				MessageId:    entry.Key,
+			})
+			if err != nil {
+				// Запись остаётся неотправленной и будет отправлена на новом канале
+				logger.Log("Outbox Relay", fmt.Sprintf("Ошибка публикации %s: %v", entry.Key, err))
+				return sent, false, err
+			}
+		}
+		if err := box.MarkSent(ctx, entry.Key); err != nil {
+			// Сообщение уже в очереди: повторная отправка безопасна, но пачку лучше повторить позже
+			logger.Log("Outbox Relay", fmt.Sprintf("Ошибка отметки %s: %v", entry.Key, err))
+			return sent + 1, false, nil
+		}
+		sent++
+	}
+	return sent, len(entries) == constants.PublishLimit, nil
+}
+
+// buildBody собирает тело сообщения записи entry из её задачи и подзадачи; задачи пачки кешируются в tasks.
+// Возвращает nil без ошибки, если отправлять нечего: задачи нет, подзадачу отменили или после истечения аренды
+// она ждёт новой публикации (её ключ идемпотентности уже другой).
+func buildBody(ctx context.Context, coll *mongo.Collection, subs *subtasks.Store, tasks map[string]*models.HashTask, entry outbox.Entry) ([]byte, error) {
+	task, ok := tasks[entry.RequestId]
+	if !ok {
+		// Из списка хешей пакетной задачи нужен только признак пакетной задачи
+		var doc models.HashTask
+		opts := options.FindOne().SetProjection(bson.M{"hashes": bson.M{"$slice": 1}, "results": 0, "users": 0})
+		err := coll.FindOne(ctx, bson.M{"requestId": entry.RequestId}, opts).Decode(&doc)
+		if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, err
+		}
+		if err == nil {
+			task = &doc
+		}
+		tasks[entry.RequestId] = task
+	}
+	if task == nil {
+		logger.Log("Outbox Relay", fmt.Sprintf("Задача %s не найдена, запись %s пропущена", entry.RequestId, entry.Key))
+		return nil, nil
+	}
+
+	subTask, err := subs.Get(ctx, entry.RequestId, entry.SubTaskNumber)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		logger.Log("Outbox Relay", fmt.Sprintf("Подзадача записи %s не найдена, запись пропущена", entry.Key))
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if subTask.Status != "PUBLISHED" || outbox.Key(entry.RequestId, subTask.SubTaskNumber, subTask.Attempts) != entry.Key {
+		logger.LogTask("Outbox Relay", subTask.Hash, subTask.SubTaskNumber, task.SubTaskCount,
+			fmt.Sprintf("Подзадача уже в статусе %s (попытка %d), запись %s пропущена", subTask.Status, subTask.Attempts, entry.Key))
+		return nil, nil
+	}
+	return json.Marshal(taskMessage(*task, subTask, entry.Key))
+}
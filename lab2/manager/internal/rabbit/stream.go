@@ -0,0 +1,187 @@
+package rabbit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"common/constants"
+	"common/logger"
+	"common/models"
+	"manager/internal/outbox"
+	"manager/internal/subtasks"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// publisherStream - имя, под которым в коллекции токенов хранится resume token публикатора
+	publisherStream = "publisher"
+	// streamBuffer - сколько событий change stream может ждать публикатора
+	streamBuffer = 64
+)
+
+// Коды ошибок MongoDB, после которых поток нельзя возобновить с сохранённого токена:
+// событие уже вытеснено из oplog или токен не подходит к потоку.
+const (
+	codeInvalidResumeToken      = 260
+	codeChangeStreamFatal       = 280
+	codeChangeStreamHistoryLost = 286
+)
+
+// taskEvent - событие change stream: в задаче requestId есть подзадачи для публикации.
+type taskEvent struct {
+	requestId string
+	token     bson.Raw // resume token события
+}
+
+// receivedPipeline отбирает события, после которых у задачи в работе остаются подзадачи "RECEIVED":
+// создание задачи, возврат подзадачи в очередь reaper'ом, публикация не всех подзадач за один проход.
+// Из документа в поток попадает только requestId, чтобы менеджер не получал задачи целиком на каждое изменение.
+func receivedPipeline() mongo.Pipeline {
+	return mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{
+			"operationType":                  bson.M{"$in": bson.A{"insert", "update", "replace"}},
+			"fullDocument.status":            "IN_PROGRESS",
+			"fullDocument.receivedTaskCount": bson.M{"$gt": 0},
+		}}},
+		{{Key: "$project", Value: bson.M{"fullDocument.requestId": 1}}},
+	}
+}
+
+// watchReceived читает change stream коллекции задач и передаёт в events задачи с подзадачами "RECEIVED".
+// Поток продолжается с сохранённого resume token; после ошибки он открывается заново.
+func watchReceived(coll, tokens *mongo.Collection, events chan<- taskEvent) {
+	for {
+		err := streamReceived(coll, tokens, events)
+		logger.Log("Publisher", fmt.Sprintf("Change stream прерван: %v. Повтор через %s", err, constants.ContextTimeout))
+		time.Sleep(constants.ContextTimeout)
+	}
+}
+
+// streamReceived открывает change stream и читает его до ошибки. Если сохранённый токен устарел
+// (oplog уже перезаписан), поток начинается с текущего момента, а пропущенные подзадачи подберёт просмотр коллекции.
+// Сервер может отвергнуть токен не при открытии потока, а при чтении следующей пачки событий; тогда сохранённый
+// токен сбрасывается, чтобы повторно открытый поток не возобновлялся с него снова.
+func streamReceived(coll, tokens *mongo.Collection, events chan<- taskEvent) error {
+	ctx := context.Background()
+	token, err := loadResumeToken(tokens, publisherStream)
+	if err != nil {
+		return fmt.Errorf("чтение resume token: %w", err)
+	}
+
+	opts := options.ChangeStream().SetFullDocument(options.UpdateLookup)
+	if token != nil {
+		opts.SetStartAfter(token)
+	}
+	stream, err := coll.Watch(ctx, receivedPipeline(), opts)
+	if token != nil && streamHistoryLost(err) {
+		logger.Log("Publisher", "Сохранённый resume token устарел, change stream начинается с текущего момента")
+		if err := clearResumeToken(tokens, publisherStream); err != nil {
+			return fmt.Errorf("сброс resume token: %w", err)
+		}
+		stream, err = coll.Watch(ctx, receivedPipeline(), options.ChangeStream().SetFullDocument(options.UpdateLookup))
+	}
+	if err != nil {
+		return err
+	}
+	defer stream.Close(ctx)
+	logger.Log("Publisher", "Change stream коллекции задач открыт")
+
+	for stream.Next(ctx) {
+		var event struct {
+			FullDocument struct {
+				RequestId string `bson:"requestId"`
+			} `bson:"fullDocument"`
+		}
+		if err := stream.Decode(&event); err != nil {
+			logger.Log("Publisher", fmt.Sprintf("Ошибка декодирования события change stream: %v", err))
+			continue
+		}
+		events <- taskEvent{requestId: event.FullDocument.RequestId, token: stream.ResumeToken()}
+	}
+	err = stream.Err()
+	if streamHistoryLost(err) {
+		logger.Log("Publisher", "Resume token устарел при чтении change stream, сохранённый токен сброшен")
+		if clearErr := clearResumeToken(tokens, publisherStream); clearErr != nil {
+			return fmt.Errorf("сброс resume token: %w", clearErr)
+		}
+	}
+	return err
+}
+
+// publishEvent ставит в outbox подзадачи задачи из события и сохраняет его resume token.
+// Если подзадачи поставить не удалось, токен не сохраняется: после перезапуска менеджера событие
+// будет прочитано снова, а до того подзадачи подберёт просмотр коллекции.
+func publishEvent(coll, tokens *mongo.Collection, subs *subtasks.Store, box *outbox.Store, event taskEvent) {
+	ctx, cancel := context.WithTimeout(context.Background(), constants.LongContextTimeout)
+	defer cancel()
+
+	filter := models.BsonFilterReceived()
+	filter["requestId"] = event.requestId
+	var task models.HashTask
+	err := coll.FindOne(ctx, filter).Decode(&task)
+	switch {
+	case errors.Is(err, mongo.ErrNoDocuments):
+		// Подзадачи уже поставлены в outbox по предыдущему событию или просмотром, либо задача отменена
+	case err != nil:
+		logger.Log("Publisher", fmt.Sprintf("Ошибка получения задачи %s: %v", event.requestId, err))
+		return
+	default:
+		publishedCount, err := publishTask(ctx, coll, subs, box, task, constants.PublishLimit)
+		if err != nil {
+			logger.LogHash("Publisher", task.Hash, fmt.Sprintf("Ошибка публикации подзадач: %v", err))
+			return
+		}
+		if publishedCount > 0 {
+			logger.LogHash("Publisher", task.Hash, fmt.Sprintf("В outbox поставлено %d подзадач(и)", publishedCount))
+		}
+	}
+
+	if err := saveResumeToken(ctx, tokens, publisherStream, event.token); err != nil {
+		logger.Log("Publisher", fmt.Sprintf("Ошибка сохранения resume token: %v", err))
+	}
+}
+
+// loadResumeToken возвращает сохранённый resume token потока name или nil, если токена нет.
+func loadResumeToken(tokens *mongo.Collection, name string) (bson.Raw, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), constants.ContextTimeout)
+	defer cancel()
+	var doc struct {
+		Token bson.Raw `bson:"token"`
+	}
+	err := tokens.FindOne(ctx, bson.M{"_id": name}).Decode(&doc)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	return doc.Token, err
+}
+
+// saveResumeToken сохраняет resume token потока name.
+func saveResumeToken(ctx context.Context, tokens *mongo.Collection, name string, token bson.Raw) error {
+	_, err := tokens.UpdateOne(ctx,
+		bson.M{"_id": name},
+		bson.M{"$set": bson.M{"token": token, "updatedAt": time.Now()}},
+		options.Update().SetUpsert(true),
+	)
+	return err
+}
+
+// clearResumeToken удаляет сохранённый resume token потока name.
+func clearResumeToken(tokens *mongo.Collection, name string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), constants.ContextTimeout)
+	defer cancel()
+	_, err := tokens.DeleteOne(ctx, bson.M{"_id": name})
+	return err
+}
+
+// streamHistoryLost сообщает, что change stream нельзя возобновить с сохранённого токена.
+func streamHistoryLost(err error) bool {
+	var serverErr mongo.ServerError
+	return errors.As(err, &serverErr) &&
+		(serverErr.HasErrorCode(codeChangeStreamHistoryLost) || serverErr.HasErrorCode(codeChangeStreamFatal) ||
+			serverErr.HasErrorCode(codeInvalidResumeToken))
+}
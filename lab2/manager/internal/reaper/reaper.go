@@ -0,0 +1,167 @@
+package reaper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"common/constants"
+	"common/logger"
+	"common/mongodb"
+	"manager/internal/processor"
+	"manager/internal/subtasks"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Config - параметры возврата подзадач, задаваемые переменными окружения.
+type Config struct {
+	Lease       time.Duration // сколько начатая подзадача может оставаться без heartbeat и результата (SUBTASK_LEASE)
+	QueueLease  time.Duration // сколько опубликованная подзадача может ждать, пока её получит воркер (SUBTASK_QUEUE_LEASE)
+	MaxAttempts int           // после стольких истёкших аренд подзадача получает DEAD (SUBTASK_MAX_ATTEMPTS)
+}
+
+// LoadConfig читает конфигурацию из окружения, некорректные значения заменяются значениями по умолчанию.
+func LoadConfig() Config {
+	cfg := Config{
+		Lease:       constants.DefaultSubTaskLease,
+		QueueLease:  constants.DefaultSubTaskQueueLease,
+		MaxAttempts: constants.DefaultSubTaskMaxAttempts,
+	}
+	if val := os.Getenv("SUBTASK_LEASE"); val != "" {
+		lease, err := time.ParseDuration(val)
+		if err != nil || lease <= 0 {
+			logger.Log("Reaper", fmt.Sprintf("Некорректное значение SUBTASK_LEASE=%q, используется %s", val, cfg.Lease))
+		} else {
+			cfg.Lease = lease
+		}
+	}
+	if val := os.Getenv("SUBTASK_QUEUE_LEASE"); val != "" {
+		lease, err := time.ParseDuration(val)
+		if err != nil || lease <= 0 {
+			logger.Log("Reaper", fmt.Sprintf("Некорректное значение SUBTASK_QUEUE_LEASE=%q, используется %s", val, cfg.QueueLease))
+		} else {
+			cfg.QueueLease = lease
+		}
+	}
+	if val := os.Getenv("SUBTASK_MAX_ATTEMPTS"); val != "" {
+		attempts, err := strconv.Atoi(val)
+		if err != nil || attempts < 1 {
+			logger.Log("Reaper", fmt.Sprintf("Некорректное значение SUBTASK_MAX_ATTEMPTS=%q, используется %d", val, cfg.MaxAttempts))
+		} else {
+			cfg.MaxAttempts = attempts
+		}
+	}
+	logger.Log("Reaper", fmt.Sprintf("Аренда подзадачи: %s, в очереди: %s, попыток: %d", cfg.Lease, cfg.QueueLease, cfg.MaxAttempts))
+	return cfg
+}
+
+// reaperBatch - сколько подзадач с истёкшей арендой обрабатывается за один проход.
+const reaperBatch = 1000
+
+// StartReaper периодически ищет подзадачи с истёкшей арендой. Подзадача, которую воркер получил (STARTED),
+// арендуется на cfg.Lease от последнего heartbeat (SubTask.UpdatedAt): если за это время нет ни heartbeat,
+// ни результата, воркер упал или потерял соединение. Опубликованная подзадача (PUBLISHED) арендуется на более
+// долгий cfg.QueueLease от публикации: если её так и не получил ни один воркер, сообщение пропало из очереди
+// (очередь очищена или данные брокера потеряны). Такие подзадачи возвращаются в RECEIVED, и публикатор отправляет
+// их снова. Подзадача, аренда которой истекла cfg.MaxAttempts раз, получает DEAD; задача, у которой не осталось
+// выполняющихся подзадач, завершается (FAIL или DONE для пакетной задачи с найденными паролями).
+func StartReaper(coll *mongo.Collection, subs *subtasks.Store, cfg Config) {
+	for {
+		time.Sleep(constants.ReaperInterval)
+		ctx, cancel := context.WithTimeout(context.Background(), constants.LongContextTimeout)
+		requeued, dead, err := reapStale(ctx, coll, subs, cfg, time.Now())
+		cancel()
+		if err != nil {
+			logger.Log("Reaper", fmt.Sprintf("Ошибка поиска зависших подзадач: %v", err))
+			continue
+		}
+		if requeued > 0 || dead > 0 {
+			logger.Log("Reaper", fmt.Sprintf("Возвращено в очередь подзадач: %d, признано мёртвыми: %d", requeued, dead))
+		}
+	}
+}
+
+// reapStale обрабатывает подзадачи, аренда которых истекла к моменту now.
+func reapStale(ctx context.Context, coll *mongo.Collection, subs *subtasks.Store, cfg Config, now time.Time) (requeued, dead int, err error) {
+	settled := make(map[string]string) // requestId -> хеш задачи, в которой появились мёртвые подзадачи
+	leases := []struct {
+		status string
+		lease  time.Duration
+	}{
+		{"STARTED", cfg.Lease},
+		{"PUBLISHED", cfg.QueueLease},
+	}
+	for _, l := range leases {
+		var r, d int
+		r, d, err = expire(ctx, coll, subs, cfg, l.status, now.Add(-l.lease), now, settled)
+		requeued += r
+		dead += d
+		if err != nil {
+			break
+		}
+	}
+	// Задача, у которой не осталось выполняющихся подзадач, завершается
+	for requestId, hash := range settled {
+		if _, err := processor.Settle(ctx, coll, subs, requestId); err != nil {
+			logger.LogHash("Reaper", hash, fmt.Sprintf("Ошибка завершения задачи %s: %v", requestId, err))
+		}
+	}
+	return requeued, dead, err
+}
+
+// expire возвращает в очередь или отмечает как DEAD подзадачи в статусе from, не менявшиеся с cutoff.
+// Задачи, в которых появились мёртвые подзадачи, добавляются в settled.
+func expire(ctx context.Context, coll *mongo.Collection, subs *subtasks.Store, cfg Config, from string, cutoff, now time.Time, settled map[string]string) (requeued, dead int, err error) {
+	stale, err := subs.Stale(ctx, from, cutoff, reaperBatch)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	for _, sub := range stale {
+		status := "RECEIVED"
+		update := bson.M{"$inc": bson.M{"receivedTaskCount": 1, "version": 1}}
+		if sub.Attempts+1 >= cfg.MaxAttempts {
+			// Задачу с мёртвыми подзадачами повторный запрос не переиспользует (см. dedupKey в server)
+			status = "DEAD"
+			update = bson.M{"$inc": bson.M{"deadTaskCount": 1, "version": 1}, "$unset": bson.M{"dedupKey": ""}}
+		}
+		// Подзадача меняется, только если она всё ещё в том же состоянии (результат, пришедший во время обхода,
+		// не перезаписывается), и в одной транзакции со счётчиками выполняющейся задачи
+		err := mongodb.WithTransaction(ctx, coll.Database().Client(), func(sc mongo.SessionContext) error {
+			if err := subs.Expire(sc, sub.RequestId, sub.SubTaskNumber, from, cutoff, status, now); err != nil {
+				return err
+			}
+			res, err := coll.UpdateOne(sc, bson.M{"requestId": sub.RequestId, "status": "IN_PROGRESS"}, update)
+			if err != nil {
+				return err
+			}
+			if res.MatchedCount == 0 {
+				return subtasks.ErrUnchanged
+			}
+			return nil
+		})
+		if errors.Is(err, subtasks.ErrUnchanged) {
+			continue
+		}
+		if err != nil {
+			logger.LogHash("Reaper", sub.Hash, fmt.Sprintf("Ошибка обновления подзадачи %d задачи %s: %v", sub.SubTaskNumber, sub.RequestId, err))
+			continue
+		}
+		if status == "DEAD" {
+			dead++
+			settled[sub.RequestId] = sub.Hash
+			logger.LogHash("Reaper", sub.Hash,
+				fmt.Sprintf("Подзадача %d: результат не получен после %d попыток, подзадача отмечена как DEAD", sub.SubTaskNumber, sub.Attempts+1))
+		} else {
+			requeued++
+			logger.LogHash("Reaper", sub.Hash,
+				fmt.Sprintf("Подзадача %d (%s): аренда истекла (попытка %d из %d), подзадача будет опубликована снова", sub.SubTaskNumber, from, sub.Attempts+1, cfg.MaxAttempts))
+		}
+	}
+	return requeued, dead, nil
+}
@@ -0,0 +1,103 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"common/constants"
+	"common/logger"
+	"common/models"
+)
+
+// defaultDeadLetterLimit - сколько сообщений DLQ показывается или переотправляется, если limit не задан.
+const defaultDeadLetterLimit = 20
+
+// DeadLetterQueues управляет очередями недоставленных сообщений (реализуется rabbit.DeadLetterAdmin).
+type DeadLetterQueues interface {
+	Inspect(queue string, limit int) (int, []models.DeadLetter, error)
+	Replay(queue string, limit int) (int, error)
+	Purge(queue string) (int, error)
+}
+
+// DeadLetterResponse - содержимое очереди недоставленных сообщений.
+type DeadLetterResponse struct {
+	Queue    string              `json:"queue"`
+	Count    int                 `json:"count"` // всего сообщений в DLQ
+	Messages []models.DeadLetter `json:"messages"`
+}
+
+// handleDeadLetters обрабатывает /api/admin/dlq?queue=tasks|results: GET показывает первые limit сообщений
+// очереди недоставленных, DELETE очищает её.
+func handleDeadLetters(w http.ResponseWriter, r *http.Request, dlq DeadLetterQueues) {
+	queue, limit, err := deadLetterParams(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var resp interface{}
+	switch r.Method {
+	case http.MethodGet:
+		count, messages, err := dlq.Inspect(queue, limit)
+		if err != nil {
+			logger.Log("API", fmt.Sprintf("Ошибка чтения DLQ очереди '%s': %v", queue, err))
+			http.Error(w, "Cannot read dead-letter queue", http.StatusBadGateway)
+			return
+		}
+		resp = DeadLetterResponse{Queue: queue, Count: count, Messages: messages}
+	case http.MethodDelete:
+		purged, err := dlq.Purge(queue)
+		if err != nil {
+			logger.Log("API", fmt.Sprintf("Ошибка очистки DLQ очереди '%s': %v", queue, err))
+			http.Error(w, "Cannot purge dead-letter queue", http.StatusBadGateway)
+			return
+		}
+		resp = map[string]int{"purged": purged}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// handleDeadLetterReplay переотправляет первые limit сообщений очереди недоставленных в рабочую очередь.
+func handleDeadLetterReplay(w http.ResponseWriter, r *http.Request, dlq DeadLetterQueues) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	queue, limit, err := deadLetterParams(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	replayed, err := dlq.Replay(queue, limit)
+	if err != nil {
+		// Часть сообщений могла быть переотправлена до ошибки
+		logger.Log("API", fmt.Sprintf("Ошибка переотправки DLQ очереди '%s' после %d сообщений: %v", queue, replayed, err))
+		http.Error(w, fmt.Sprintf("Replay stopped after %d messages", replayed), http.StatusBadGateway)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{"replayed": replayed})
+}
+
+// deadLetterParams разбирает параметры queue и limit запроса к DLQ.
+func deadLetterParams(r *http.Request) (string, int, error) {
+	queue := r.URL.Query().Get("queue")
+	if queue != constants.TasksQueue && queue != constants.ResultsQueue {
+		return "", 0, fmt.Errorf("queue parameter must be \"tasks\" or \"results\"")
+	}
+	limit := defaultDeadLetterLimit
+	if val := r.URL.Query().Get("limit"); val != "" {
+		parsed, err := strconv.Atoi(val)
+		if err != nil || parsed < 1 {
+			return "", 0, fmt.Errorf("limit must be a positive integer")
+		}
+		limit = parsed
+	}
+	return queue, limit, nil
+}
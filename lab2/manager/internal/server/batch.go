@@ -0,0 +1,229 @@
+package server
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"time"
+
+	"common/constants"
+	"common/hashlist"
+	"common/logger"
+	"common/models"
+	"manager/internal/potfile"
+	"manager/internal/subtasks"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// hashOptions - формат хешей, принимаемых менеджером: воркеры перебирают только MD5.
+var hashOptions = hashlist.Options{Algorithm: "md5", HexLength: 2 * md5.Size}
+
+// BatchResponse - ответ на создание пакетной задачи.
+type BatchResponse struct {
+	RequestId string               `json:"requestId"`
+	Hashes    int                  `json:"hashes"`             // количество различных хешей в задаче
+	Rejected  []hashlist.LineError `json:"rejected,omitempty"` // строки списка, которые не удалось разобрать
+}
+
+// BatchHashesResponse - список хешей пакетной задачи, который воркеры запрашивают один раз на задачу.
+type BatchHashesResponse struct {
+	RequestId string   `json:"requestId"`
+	Hashes    []string `json:"hashes"` // хеши, пароли для которых ещё не известны
+}
+
+// HashStatus - статус одного хеша пакетной задачи в ответе на запрос статуса.
+type HashStatus struct {
+	Hash   string   `json:"hash"`
+	Users  []string `json:"users,omitempty"` // учётные записи с этим хешем (из списка user:hash или pwdump)
+	Status string   `json:"status"`          // "FOUND", "PENDING" (задача выполняется), "NOT_FOUND" или "CANCELLED"
+	Result string   `json:"result,omitempty"`
+}
+
+// handleBatch создаёт одну задачу для списка хешей: пространство поиска перебирается один раз,
+// а каждый кандидат сверяется со всеми хешами списка. Повторное использование задач, как в handleCrack,
+// не выполняется - каждый пакетный запрос создаёт новую задачу. Пароли, уже известные из potfile,
+// сразу попадают в результаты задачи, а воркерам отправляются только остальные хеши.
+func handleBatch(w http.ResponseWriter, r *http.Request, coll *mongo.Collection, subs *subtasks.Store, pot *potfile.Store) {
+	req, entries, rejected, err := readBatchRequest(w, r)
+	if err != nil {
+		logger.Log("API", "Ошибка чтения пакетного запроса: "+err.Error())
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := validateCrackRequest(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	req.Hash = fmt.Sprintf("batch(%d)", len(req.Hashes))
+
+	requestId := uuid.New().String()
+	now := time.Now()
+
+	ctx, cancel := context.WithTimeout(context.Background(), constants.ContextTimeout)
+	defer cancel()
+
+	known, err := pot.LookupMany(ctx, req.Hashes)
+	if err != nil {
+		logger.LogHash("API", req.Hash, fmt.Sprintf("Ошибка чтения potfile: %v", err))
+	}
+
+	var taskDoc models.HashTask
+	var subTasks []models.SubTask
+	if len(known) == len(req.Hashes) {
+		taskDoc = newCrackedTask(req, requestId, "", now)
+	} else {
+		subTasks, err = buildSubTasks(req, nil, now)
+		if err != nil {
+			logger.LogHash("API", req.Hash, fmt.Sprintf("Ошибка подготовки подзадач: %v", err))
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		taskDoc = newHashTask(req, requestId, subTasks, now)
+	}
+	if len(known) > 0 {
+		taskDoc.Results = known
+	}
+	if users := hashlist.Users(entries); len(users) > 0 {
+		taskDoc.Users = users
+	}
+	if err := insertTask(ctx, coll, subs, taskDoc, subTasks); err != nil {
+		logger.Log("API", fmt.Sprintf("Ошибка вставки пакетной задачи %s: %v", req.Hash, err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	logger.LogHash("API", req.Hash, fmt.Sprintf("Новая пакетная задача создана (RequestId=%s, подзадач: %d, известно из potfile: %d, отклонено строк: %d)",
+		requestId, taskDoc.SubTaskCount, len(known), len(rejected)))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(BatchResponse{RequestId: requestId, Hashes: len(req.Hashes), Rejected: rejected})
+}
+
+// readBatchRequest читает пакетный запрос. Поддерживается JSON с полем "hashes" и multipart/form-data,
+// где часть "hashes" - файл со списком хешей, а необязательная часть "request" - JSON с параметрами атаки
+// (в нём тоже можно передать "hashes", списки объединяются). Строки списка могут быть в любом формате,
+// который понимает hashlist (hash, user:hash, pwdump); строки, которые не удалось разобрать, возвращаются отдельно.
+func readBatchRequest(w http.ResponseWriter, r *http.Request) (CrackRequest, []hashlist.Entry, []hashlist.LineError, error) {
+	var req CrackRequest
+	var entries []hashlist.Entry
+	var rejected []hashlist.LineError
+	r.Body = http.MaxBytesReader(w, r.Body, constants.MaxBatchUploadSize)
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "multipart/form-data" {
+		if err := r.ParseMultipartForm(constants.MaxBatchUploadSize); err != nil {
+			return req, nil, nil, fmt.Errorf("Bad request: invalid multipart form: %v", err)
+		}
+		if params := r.FormValue("request"); params != "" {
+			if err := json.Unmarshal([]byte(params), &req); err != nil {
+				return req, nil, nil, fmt.Errorf("Bad request: invalid JSON in part \"request\"")
+			}
+		}
+		file, _, err := r.FormFile("hashes")
+		if err != nil {
+			return req, nil, nil, fmt.Errorf("Bad request: file part \"hashes\" is required")
+		}
+		defer file.Close()
+		entries, rejected, err = hashlist.Parse(file, hashOptions)
+		if err != nil {
+			return req, nil, nil, fmt.Errorf("Bad request: cannot read hash list: %v", err)
+		}
+	} else if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return req, nil, nil, fmt.Errorf("Bad request: invalid JSON")
+	}
+
+	// Элементы JSON-массива нумеруются как строки списка, начиная с 1
+	for i, line := range req.Hashes {
+		entry, err := hashlist.ParseLine(line, hashOptions)
+		if err != nil {
+			rejected = append(rejected, hashlist.LineError{Line: i + 1, Text: line, Err: err.Error()})
+			continue
+		}
+		entry.Line = i + 1
+		entries = append(entries, entry)
+	}
+
+	req.Hashes = hashlist.Hashes(entries)
+	if len(req.Hashes) == 0 {
+		if len(rejected) > 0 {
+			return req, nil, rejected, fmt.Errorf("No valid hashes: %d lines rejected, first: %v", len(rejected), rejected[0])
+		}
+		return req, nil, nil, fmt.Errorf("Hash list is empty")
+	}
+	if len(req.Hashes) > constants.MaxBatchHashes {
+		return req, nil, nil, fmt.Errorf("Too many hashes: %d (at most %d)", len(req.Hashes), constants.MaxBatchHashes)
+	}
+	return req, entries, rejected, nil
+}
+
+// batchHashStatuses возвращает статус каждого хеша пакетной задачи в порядке запроса.
+func batchHashStatuses(task models.HashTask) []HashStatus {
+	pending := "NOT_FOUND"
+	switch task.Status {
+	case "IN_PROGRESS":
+		pending = "PENDING"
+	case "CANCELLED":
+		pending = "CANCELLED"
+	}
+	statuses := make([]HashStatus, len(task.Hashes))
+	for i, hash := range task.Hashes {
+		if result, ok := task.Results[hash]; ok {
+			statuses[i] = HashStatus{Hash: hash, Users: task.Users[hash], Status: "FOUND", Result: result}
+		} else {
+			statuses[i] = HashStatus{Hash: hash, Users: task.Users[hash], Status: pending}
+		}
+	}
+	return statuses
+}
+
+// handleBatchHashes возвращает воркеру хеши пакетной задачи, пароли для которых ещё не известны.
+// Сообщения подзадач несут только признак пакетной задачи, а не сам список (до constants.MaxBatchHashes хешей
+// в каждом сообщении): воркер запрашивает список один раз на задачу и хранит его у себя.
+func handleBatchHashes(w http.ResponseWriter, r *http.Request, coll *mongo.Collection) {
+	requestId := r.URL.Query().Get("requestId")
+	if requestId == "" {
+		http.Error(w, "requestId parameter is required", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), constants.ContextTimeout)
+	defer cancel()
+
+	var task models.HashTask
+	opts := options.FindOne().SetProjection(bson.M{"hashes": 1, "results": 1})
+	err := coll.FindOne(ctx, bson.M{"requestId": requestId}, opts).Decode(&task)
+	if errors.Is(err, mongo.ErrNoDocuments) || (err == nil && len(task.Hashes) == 0) {
+		http.Error(w, "Batch task not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logger.Log("API", fmt.Sprintf("Ошибка чтения пакетной задачи %s: %v", requestId, err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(BatchHashesResponse{RequestId: requestId, Hashes: pendingHashes(task)})
+}
+
+// pendingHashes возвращает хеши пакетной задачи, пароли для которых ещё не известны
+// (часть паролей могла быть взята из potfile при создании задачи или найдена другими подзадачами).
+func pendingHashes(task models.HashTask) []string {
+	if len(task.Results) == 0 {
+		return task.Hashes
+	}
+	pending := make([]string, 0, len(task.Hashes)-len(task.Results))
+	for _, hash := range task.Hashes {
+		if _, ok := task.Results[hash]; !ok {
+			pending = append(pending, hash)
+		}
+	}
+	return pending
+}
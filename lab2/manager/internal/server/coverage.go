@@ -0,0 +1,139 @@
+package server
+
+import (
+	"context"
+	"math/big"
+
+	"common/constants"
+	"common/keyspace"
+	"common/models"
+	"manager/internal/subtasks"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// coveredRanges возвращает диапазоны, которые для хеша запроса уже проверены без результата или будут проверены:
+// завершённые (COMPLETE) подзадачи задач с тем же пространством поиска - алфавитом при переборе или маской
+// с наборами символов, а у выполняющихся задач ещё и подзадачи, ждущие публикации, в очереди или у воркера
+// (RECEIVED, PUBLISHED, STARTED). Поэтому одновременные пересекающиеся запросы не перебирают общие диапазоны
+// дважды; если выполняющуюся задачу отменят, её непроверенные диапазоны переберёт следующий запрос.
+// Диапазоны перебора по алфавиту приводятся к нумерации с длины 1 (keyspace.Space.Offset), поэтому задача
+// с большим maxLength получает только недостающие длины. Для словаря учёт не ведётся.
+func coveredRanges(ctx context.Context, coll *mongo.Collection, subs *subtasks.Store, req CrackRequest) ([]keyspace.Range, error) {
+	filter := coverageFilter(req)
+	if filter == nil {
+		return nil, nil
+	}
+	// Подзадачи решённой задачи учитывать незачем: её пароль отдаёт potfile
+	filter["$or"] = bson.A{
+		bson.M{"status": "IN_PROGRESS"},
+		bson.M{"status": bson.M{"$in": bson.A{"FAIL", "CANCELLED"}}, "completedTaskCount": bson.M{"$gt": 0}},
+	}
+	opts := options.Find().SetProjection(bson.M{
+		"requestId": 1,
+		"mode":      1,
+		"alphabet":  1,
+		"minLength": 1,
+		"maxLength": 1,
+		"status":    1,
+	})
+	cursor, err := coll.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var covered []keyspace.Range
+	for cursor.Next(ctx) {
+		var task models.HashTask
+		if err := cursor.Decode(&task); err != nil {
+			return nil, err
+		}
+		statuses := []string{"COMPLETE"}
+		if task.Status == "IN_PROGRESS" {
+			statuses = append(statuses, "RECEIVED", "PUBLISHED", "STARTED")
+		}
+		planned, err := subs.WithStatus(ctx, task.RequestId, statuses...)
+		if err != nil {
+			return nil, err
+		}
+		offset := taskOffset(task)
+		for _, sub := range planned {
+			if sub.RangeEnd == "" {
+				continue
+			}
+			r, err := keyspace.ParseRange(sub.RangeStart, sub.RangeEnd)
+			if err != nil {
+				continue
+			}
+			covered = append(covered, r.Shift(offset))
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+	return keyspace.Merge(covered), nil
+}
+
+// coverageFilter возвращает фильтр задач с тем же хешем и пространством поиска или nil для словаря.
+func coverageFilter(req CrackRequest) bson.M {
+	switch req.Mode {
+	case constants.ModeMask:
+		return bson.M{"hash": req.Hash, "mode": constants.ModeMask, "mask": req.Mask, "charsets": charsetsFilter(req.Charsets)}
+	case constants.ModeBruteForce:
+		// Задачи, созданные до появления режимов и алфавита, перебирали алфавит по умолчанию
+		alphabets := bson.A{req.Alphabet}
+		if req.Alphabet == constants.Alphabet {
+			alphabets = append(alphabets, "", nil)
+		}
+		return bson.M{
+			"hash":     req.Hash,
+			"mode":     bson.M{"$in": bson.A{constants.ModeBruteForce, nil}},
+			"alphabet": bson.M{"$in": alphabets},
+		}
+	default:
+		return nil
+	}
+}
+
+// taskOffset возвращает сдвиг номеров кандидатов задачи в нумерацию coveredRanges (для маски - 0).
+func taskOffset(task models.HashTask) *big.Int {
+	if task.Mode == constants.ModeMask {
+		return new(big.Int)
+	}
+	alphabet := task.Alphabet
+	if alphabet == "" {
+		alphabet = constants.Alphabet
+	}
+	minLength := task.MinLength
+	if minLength == 0 {
+		minLength = task.MaxLength
+	}
+	return keyspace.Space{Alphabet: alphabet, MinLength: minLength, MaxLength: task.MaxLength}.Offset()
+}
+
+// uncoveredRanges возвращает непроверенные части пространства из total кандидатов, разбитые на диапазоны подзадач
+// в нумерации самого пространства; offset - номер его первого кандидата в нумерации covered.
+// Если пространство больше MaxSubTaskCount*MaxCandidatesPerSubTask, диапазоны увеличиваются.
+func uncoveredRanges(total, offset *big.Int, covered []keyspace.Range) []keyspace.Range {
+	full := keyspace.Range{Start: new(big.Int), End: total}.Shift(offset)
+	rest := keyspace.Subtract(full, covered)
+	back := new(big.Int).Neg(offset)
+	for i, r := range rest {
+		rest[i] = r.Shift(back)
+	}
+	return keyspace.PartitionRanges(rest, constants.MaxCandidatesPerSubTask, constants.MaxSubTaskCount)
+}
+
+// subTasksSize возвращает количество кандидатов в диапазонах подзадач (десятичное число).
+func subTasksSize(subTasks []models.SubTask) string {
+	total := new(big.Int)
+	for _, sub := range subTasks {
+		if r, err := keyspace.ParseRange(sub.RangeStart, sub.RangeEnd); err == nil {
+			total.Add(total, r.Len())
+		}
+	}
+	return total.String()
+}
@@ -0,0 +1,57 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"common/constants"
+	"common/logger"
+	"common/models"
+	"manager/internal/potfile"
+)
+
+// handlePotfileExport выгружает potfile в формате hashcat "hash:plain" (по строке на хеш).
+func handlePotfileExport(w http.ResponseWriter, pot *potfile.Store) {
+	ctx, cancel := context.WithTimeout(context.Background(), constants.LongContextTimeout)
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	count, err := pot.Export(ctx, w)
+	if err != nil {
+		// Часть строк могла уже уйти клиенту, поэтому статус ответа не меняется
+		logger.Log("API", fmt.Sprintf("Ошибка выгрузки potfile после %d записей: %v", count, err))
+		return
+	}
+	logger.Log("API", fmt.Sprintf("Выгружено записей potfile: %d", count))
+}
+
+// handlePotfileImport добавляет в potfile пары "hash:plain" из тела запроса (potfile hashcat).
+func handlePotfileImport(w http.ResponseWriter, r *http.Request, pot *potfile.Store) {
+	r.Body = http.MaxBytesReader(w, r.Body, constants.MaxBatchUploadSize)
+
+	ctx, cancel := context.WithTimeout(context.Background(), constants.LongContextTimeout)
+	defer cancel()
+
+	result, err := pot.Import(ctx, r.Body, hashOptions)
+	if err != nil {
+		logger.Log("API", "Ошибка импорта potfile: "+err.Error())
+		http.Error(w, fmt.Sprintf("Cannot import potfile: %v", err), http.StatusBadRequest)
+		return
+	}
+	logger.Log("API", fmt.Sprintf("Импорт potfile: добавлено %d, уже известно %d, отклонено строк %d",
+		result.Imported, result.Existing, len(result.Rejected)))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// newCrackedTask создаёт задачу, пароль которой уже известен из potfile: она сразу получает статус "DONE"
+// и не содержит подзадач, поэтому публикатор её не видит.
+func newCrackedTask(req CrackRequest, requestId, plain string, now time.Time) models.HashTask {
+	task := newHashTask(req, requestId, []models.SubTask{}, now)
+	task.Status = "DONE"
+	task.Result = plain
+	return task
+}
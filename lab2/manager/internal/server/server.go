@@ -3,25 +3,43 @@ package server
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"math"
+	"math/big"
 	"net/http"
 	"os"
 	"time"
 
 	"common/constants"
+	"common/hashlist"
+	"common/keyspace"
 	"common/logger"
+	"common/mask"
 	"common/models"
+	"common/mongodb"
+	"common/rules"
+	"common/wordlist"
+	"manager/internal/potfile"
+	"manager/internal/subtasks"
 
 	"github.com/google/uuid"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 // CrackRequest представляет ожидаемое JSON-тело для запроса "crack".
 type CrackRequest struct {
-	Hash      string `json:"hash"`
-	MaxLength int    `json:"maxLength"`
+	Hash      string   `json:"hash"`
+	Hashes    []string `json:"hashes,omitempty"`    // список хешей пакетной задачи (/api/hash/crack/batch)
+	Alphabet  string   `json:"alphabet,omitempty"`  // алфавит перебора (по умолчанию constants.Alphabet)
+	MinLength int      `json:"minLength,omitempty"` // минимальная длина кандидата (по умолчанию 1)
+	MaxLength int      `json:"maxLength"`
+	Mode      string   `json:"mode,omitempty"`     // "bruteforce" (по умолчанию), "dictionary" или "mask"
+	Wordlist  string   `json:"wordlist,omitempty"` // идентификатор словаря для режима "dictionary"
+	Rules     string   `json:"rules,omitempty"`    // идентификатор набора правил, применяемых к словам словаря
+	Mask      string   `json:"mask,omitempty"`     // маска для режима "mask"
+	Charsets  []string `json:"charsets,omitempty"` // пользовательские наборы символов ?1..?4
 }
 
 // CrackResponse представляет JSON-ответ на успешный запрос crack (возвращает ID для отслеживания запроса).
@@ -31,18 +49,38 @@ type CrackResponse struct {
 
 // StatusResponse представляет JSON-ответ на запрос о статусе.
 type StatusResponse struct {
-	Status string      `json:"status"`
-	Data   interface{} `json:"data"`
+	Status string       `json:"status"`
+	Data   interface{}  `json:"data"`
+	Hashes []HashStatus `json:"hashes,omitempty"` // статусы отдельных хешей пакетной задачи
+}
+
+// MetricsResponse - сводка по задачам и перебору, сэкономленному досрочным завершением.
+type MetricsResponse struct {
+	Tasks             map[string]int `json:"tasks"`             // количество задач по статусам
+	SolvedEarly       int            `json:"solvedEarly"`       // задачи, решённые до завершения всех подзадач
+	SubTasks          int            `json:"subTasks"`          // подзадачи всех задач
+	SkippedSubTasks   int            `json:"skippedSubTasks"`   // подзадачи, отмеченные SKIPPED
+	SkippedCandidates string         `json:"skippedCandidates"` // кандидаты в пропущенных подзадачах (десятичное число)
+	DeadSubTasks      int            `json:"deadSubTasks"`      // подзадачи, отмеченные DEAD после истечения всех попыток
+	SavedPercent      float64        `json:"savedPercent"`      // доля пропущенных подзадач
+}
+
+// ControlPublisher рассылает управляющие сообщения воркерам (реализуется rabbit.ControlPublisher).
+type ControlPublisher interface {
+	Publish(msg models.ControlMessage) error
 }
 
 // RegisterHandlers устанавливает HTTP обработчики для API взлома хешей.
-func RegisterHandlers(mux *http.ServeMux, coll *mongo.Collection) {
+func RegisterHandlers(mux *http.ServeMux, coll *mongo.Collection, subs *subtasks.Store, pot *potfile.Store, control ControlPublisher, dlq DeadLetterQueues) {
 	mux.HandleFunc("/api/hash/crack", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodPost {
+		switch r.Method {
+		case http.MethodPost:
+			handleCrack(w, r, coll, subs, pot)
+		case http.MethodDelete:
+			handleCancel(w, r, coll, subs, control)
+		default:
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-			return
 		}
-		handleCrack(w, r, coll)
 	})
 	mux.HandleFunc("/api/hash/status", func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodGet {
@@ -51,74 +89,408 @@ func RegisterHandlers(mux *http.ServeMux, coll *mongo.Collection) {
 		}
 		handleStatus(w, r, coll)
 	})
+	mux.HandleFunc("/api/hash/crack/batch", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		handleBatch(w, r, coll, subs, pot)
+	})
+	mux.HandleFunc(constants.BatchHashesPath, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		handleBatchHashes(w, r, coll)
+	})
+	mux.HandleFunc("/api/metrics", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		handleMetrics(w, coll)
+	})
+	mux.HandleFunc("/api/potfile", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			handlePotfileExport(w, pot)
+		case http.MethodPost:
+			handlePotfileImport(w, r, pot)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+	mux.HandleFunc("/api/admin/dlq", func(w http.ResponseWriter, r *http.Request) {
+		handleDeadLetters(w, r, dlq)
+	})
+	mux.HandleFunc("/api/admin/dlq/replay", func(w http.ResponseWriter, r *http.Request) {
+		handleDeadLetterReplay(w, r, dlq)
+	})
 }
 
 // handleCrack обрабатывает запрос на взлом заданного хеша.
-func handleCrack(w http.ResponseWriter, r *http.Request, coll *mongo.Collection) {
+// Если пароль уже есть в potfile, задача создаётся сразу выполненной и перебор не запускается.
+func handleCrack(w http.ResponseWriter, r *http.Request, coll *mongo.Collection, subs *subtasks.Store, pot *potfile.Store) {
 	var req CrackRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		logger.Log("API", "Ошибка декодирования запроса: "+err.Error())
 		http.Error(w, "Bad request: invalid JSON", http.StatusBadRequest)
 		return
 	}
-	if req.MaxLength < constants.MinMaxLength || req.MaxLength > constants.MaxMaxLength {
-		http.Error(w, fmt.Sprintf("MaxLength must be between %d and %d", constants.MinMaxLength, constants.MaxMaxLength), http.StatusBadRequest)
+	if err := validateCrackRequest(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// Хеш можно передать строкой из дампа (user:hash, pwdump) - оставляем только сам хеш
+	entry, err := hashlist.ParseLine(req.Hash, hashOptions)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid hash: %v", err), http.StatusBadRequest)
 		return
 	}
+	req.Hash = entry.Hash
 
 	ctx, cancel := context.WithTimeout(context.Background(), constants.ContextTimeout)
 	defer cancel()
 
-	// Если задача для этого хеша уже существует, возвращаем её requestId
+	// Если задача для этого хеша с теми же параметрами поиска уже существует, возвращаем её requestId
+	// (в том числе FAIL: то же пространство проверено полностью). Отменённые задачи и задачи с мёртвыми
+	// подзадачами не переиспользуются: повторный запрос перебирает то, что они не проверили.
+	existingFilter := existingTaskFilter(req)
+	existingFilter["status"] = bson.M{"$ne": "CANCELLED"}
+	existingFilter["deadTaskCount"] = bson.M{"$not": bson.M{"$gt": 0}}
 	var existing models.HashTask
-	err := coll.FindOne(ctx, bson.M{"hash": req.Hash}).Decode(&existing)
+	err = coll.FindOne(ctx, existingFilter).Decode(&existing)
 	if err == nil {
+		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(CrackResponse{RequestId: existing.RequestId})
 		return
 	}
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		logger.LogHash("API", req.Hash, fmt.Sprintf("Ошибка поиска существующей задачи: %v", err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
 
 	requestId := uuid.New().String()
 	now := time.Now()
 
-	totalCandidates := math.Pow(float64(constants.AlphabetSize), float64(req.MaxLength))
-	numSubTasks := int(math.Ceil(totalCandidates / constants.MaxCandidatesPerSubTask))
-	if numSubTasks < 1 {
-		numSubTasks = 1
+	// Ошибка чтения potfile не мешает поставить задачу: пароль просто будет найден перебором
+	plain, known, err := pot.Lookup(ctx, req.Hash)
+	if err != nil {
+		logger.LogHash("API", req.Hash, fmt.Sprintf("Ошибка чтения potfile: %v", err))
+	}
+	key := dedupKey(req)
+	if known {
+		taskDoc := newCrackedTask(req, requestId, plain, now)
+		taskDoc.DedupKey = key
+		if _, err := coll.InsertOne(ctx, taskDoc); err != nil {
+			if existingId, ok := concurrentTask(ctx, coll, key, err); ok {
+				w.Header().Set("Content-Type", "application/json")
+				json.NewEncoder(w).Encode(CrackResponse{RequestId: existingId})
+				return
+			}
+			logger.Log("API", fmt.Sprintf("Ошибка вставки задачи для хэша %s: %v", req.Hash, err))
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		logger.LogHash("API", req.Hash, fmt.Sprintf("Пароль найден в potfile, перебор не нужен (RequestId=%s)", requestId))
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(CrackResponse{RequestId: requestId})
+		return
 	}
 
-	subTasks := make([]models.SubTask, numSubTasks)
-	for i := 0; i < numSubTasks; i++ {
-		subTasks[i] = models.SubTask{
-			Hash:          req.Hash,
-			SubTaskNumber: i + 1,
-			Status:        "RECEIVED",
-			CreatedAt:     now,
-			UpdatedAt:     now,
+	// Диапазоны, уже проверенные другими задачами этого хеша, не перебираются повторно.
+	// Если их не удалось прочитать, пространство перебирается целиком
+	covered, err := coveredRanges(ctx, coll, subs, req)
+	if err != nil {
+		logger.LogHash("API", req.Hash, fmt.Sprintf("Ошибка чтения проверенных диапазонов: %v", err))
+	}
+
+	subTasks, err := buildSubTasks(req, covered, now)
+	if err != nil {
+		logger.LogHash("API", req.Hash, fmt.Sprintf("Ошибка подготовки подзадач: %v", err))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	numSubTasks := len(subTasks)
+
+	taskDoc := newHashTask(req, requestId, subTasks, now)
+	taskDoc.DedupKey = key
+	if numSubTasks == 0 {
+		// Всё пространство запроса уже проверено без результата
+		taskDoc.Status = "FAIL"
+		logger.LogHash("API", req.Hash, "Пространство поиска уже проверено полностью, задача сразу отмечена как FAIL")
+	} else if len(covered) > 0 {
+		logger.LogHash("API", req.Hash, fmt.Sprintf("Проверенные ранее диапазоны пропущены, осталось кандидатов: %s",
+			subTasksSize(subTasks)))
+	}
+	if err := insertTask(ctx, coll, subs, taskDoc, subTasks); err != nil {
+		if existingId, ok := concurrentTask(ctx, coll, key, err); ok {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(CrackResponse{RequestId: existingId})
+			return
+		}
+		logger.Log("API", fmt.Sprintf("Ошибка вставки задачи для хэша %s: %v", req.Hash, err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	logger.LogHash("API", req.Hash, fmt.Sprintf("Новая задача создана (RequestId=%s, подзадач: %d)", requestId, numSubTasks))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(CrackResponse{RequestId: requestId})
+}
+
+// validateCrackRequest проверяет параметры режима атаки и заполняет значения по умолчанию.
+// Текст ошибки предназначен для ответа клиенту.
+func validateCrackRequest(req *CrackRequest) error {
+	if req.Mode == "" {
+		req.Mode = constants.ModeBruteForce
+	}
+
+	switch req.Mode {
+	case constants.ModeBruteForce:
+		if req.MaxLength < constants.MinMaxLength || req.MaxLength > constants.MaxMaxLength {
+			return fmt.Errorf("MaxLength must be between %d and %d", constants.MinMaxLength, constants.MaxMaxLength)
+		}
+		if req.MinLength == 0 {
+			req.MinLength = constants.MinMaxLength
+		}
+		if req.MinLength < constants.MinMaxLength || req.MinLength > req.MaxLength {
+			return fmt.Errorf("MinLength must be between %d and maxLength", constants.MinMaxLength)
+		}
+		if req.Alphabet == "" {
+			req.Alphabet = constants.Alphabet
+		}
+		if err := validateAlphabet(req.Alphabet); err != nil {
+			return fmt.Errorf("Invalid alphabet: %v", err)
+		}
+		if req.Rules != "" {
+			return fmt.Errorf("rules are supported only in dictionary mode")
+		}
+	case constants.ModeDictionary:
+		if req.Wordlist == "" {
+			return fmt.Errorf("wordlist is required for dictionary mode")
+		}
+	case constants.ModeMask:
+		if _, err := mask.Parse(req.Mask, req.Charsets); err != nil {
+			return fmt.Errorf("Invalid mask: %v", err)
+		}
+		// Отсутствующее поле и "charsets": [] задают одно и то же: задача сохраняется и ищется с пустым списком
+		if req.Charsets == nil {
+			req.Charsets = []string{}
+		}
+	default:
+		return fmt.Errorf("Unknown mode %q", req.Mode)
+	}
+	return nil
+}
+
+// existingTaskFilter возвращает фильтр задачи с тем же хешем и параметрами атаки.
+func existingTaskFilter(req CrackRequest) bson.M {
+	switch req.Mode {
+	case constants.ModeDictionary:
+		filter := bson.M{"hash": req.Hash, "mode": constants.ModeDictionary, "wordlist": req.Wordlist}
+		if req.Rules != "" {
+			filter["rules"] = req.Rules
+		} else {
+			filter["rules"] = bson.M{"$exists": false}
+		}
+		return filter
+	case constants.ModeMask:
+		return bson.M{"hash": req.Hash, "mode": constants.ModeMask, "mask": req.Mask, "charsets": charsetsFilter(req.Charsets)}
+	default:
+		// Задачи, созданные до появления режимов, не имеют поля mode
+		return bson.M{
+			"hash":      req.Hash,
+			"mode":      bson.M{"$in": bson.A{constants.ModeBruteForce, nil}},
+			"alphabet":  req.Alphabet,
+			"minLength": req.MinLength,
+			"maxLength": req.MaxLength,
 		}
 	}
+}
+
+// charsetsFilter возвращает условие на наборы символов задачи по маске. Задачи без наборов, созданные
+// до нормализации, хранятся без поля charsets, поэтому пустой список совпадает и с отсутствующим полем.
+func charsetsFilter(charsets []string) interface{} {
+	if len(charsets) == 0 {
+		return bson.M{"$in": bson.A{nil, bson.A{}}}
+	}
+	return charsets
+}
+
+// dedupKey возвращает ключ задачи по хешу и тем же параметрам атаки, что сравнивает existingTaskFilter.
+// Уникальный индекс по ключу не даёт одновременным одинаковым запросам создать две задачи.
+func dedupKey(req CrackRequest) string {
+	switch req.Mode {
+	case constants.ModeDictionary:
+		return fmt.Sprintf("%s:%s:%q:%q", req.Hash, constants.ModeDictionary, req.Wordlist, req.Rules)
+	case constants.ModeMask:
+		return fmt.Sprintf("%s:%s:%q:%q", req.Hash, constants.ModeMask, req.Mask, req.Charsets)
+	default:
+		return fmt.Sprintf("%s:%s:%q:%d:%d", req.Hash, constants.ModeBruteForce, req.Alphabet, req.MinLength, req.MaxLength)
+	}
+}
 
-	taskDoc := models.HashTask{
+// concurrentTask возвращает requestId задачи с ключом key, если вставка новой задачи не удалась из-за того,
+// что одновременный одинаковый запрос успел создать свою (ошибка дубликата ключа dedupKey).
+func concurrentTask(ctx context.Context, coll *mongo.Collection, key string, err error) (string, bool) {
+	if !mongo.IsDuplicateKeyError(err) {
+		return "", false
+	}
+	var existing models.HashTask
+	if err := coll.FindOne(ctx, bson.M{"dedupKey": key}).Decode(&existing); err != nil {
+		return "", false
+	}
+	return existing.RequestId, true
+}
+
+// buildSubTasks делит пространство поиска проверенного запроса на подзадачи.
+// В режимах перебора и маски диапазоны covered (в нумерации coveredRanges) пропускаются;
+// если всё пространство уже проверено, подзадач нет. Текст ошибки предназначен для ответа клиенту.
+func buildSubTasks(req CrackRequest, covered []keyspace.Range, now time.Time) ([]models.SubTask, error) {
+	switch req.Mode {
+	case constants.ModeDictionary:
+		subTasks, err := dictionarySubTasks(req, now)
+		if err != nil {
+			return nil, fmt.Errorf("Dictionary attack cannot be scheduled: %v", err)
+		}
+		return subTasks, nil
+	case constants.ModeMask:
+		subTasks, err := maskSubTasks(req, covered, now)
+		if err != nil {
+			return nil, fmt.Errorf("Mask attack cannot be scheduled: %v", err)
+		}
+		return subTasks, nil
+	default:
+		return bruteForceSubTasks(req, covered, now), nil
+	}
+}
+
+// newHashTask создаёт документ новой задачи в статусе "IN_PROGRESS" и назначает ей подзадачи subTasks.
+func newHashTask(req CrackRequest, requestId string, subTasks []models.SubTask, now time.Time) models.HashTask {
+	for i := range subTasks {
+		subTasks[i].RequestId = requestId
+	}
+	return models.HashTask{
 		RequestId:          requestId,
 		Hash:               req.Hash,
+		Hashes:             req.Hashes,
+		Mode:               req.Mode,
+		Wordlist:           req.Wordlist,
+		Rules:              req.Rules,
+		Mask:               req.Mask,
+		Charsets:           req.Charsets,
+		Alphabet:           req.Alphabet,
+		MinLength:          req.MinLength,
 		MaxLength:          req.MaxLength,
 		Status:             "IN_PROGRESS",
-		SubTaskCount:       numSubTasks,
+		SubTaskCount:       len(subTasks),
 		CompletedTaskCount: 0,
+		ReceivedTaskCount:  len(subTasks),
 		Result:             "",
-		SubTasks:           subTasks,
 		CreatedAt:          now,
 	}
+}
+
+// insertTask добавляет задачу и её подзадачи в одной транзакции: публикатор не увидит задачу без подзадач.
+func insertTask(ctx context.Context, coll *mongo.Collection, subs *subtasks.Store, task models.HashTask, subTasks []models.SubTask) error {
+	return mongodb.WithTransaction(ctx, coll.Database().Client(), func(sc mongo.SessionContext) error {
+		if _, err := coll.InsertOne(sc, task); err != nil {
+			return err
+		}
+		return subs.Insert(sc, subTasks)
+	})
+}
+
+// bruteForceSubTasks делит непроверенную часть пространства перебора по алфавиту на непрерывные диапазоны.
+// Пространство - конкатенация всех длин от MinLength до MaxLength, подзадачи делят его общую нумерацию.
+func bruteForceSubTasks(req CrackRequest, covered []keyspace.Range, now time.Time) []models.SubTask {
+	space := keyspace.Space{Alphabet: req.Alphabet, MinLength: req.MinLength, MaxLength: req.MaxLength}
+	return rangeSubTasks(req.Hash, uncoveredRanges(space.SizeBig(), space.Offset(), covered), now)
+}
 
-	_, err = coll.InsertOne(ctx, taskDoc)
+// maskSubTasks делит непроверенную часть пространства маски на непрерывные диапазоны.
+func maskSubTasks(req CrackRequest, covered []keyspace.Range, now time.Time) ([]models.SubTask, error) {
+	m, err := mask.Parse(req.Mask, req.Charsets)
 	if err != nil {
-		logger.Log("API", fmt.Sprintf("Ошибка вставки задачи для хэша %s: %v", req.Hash, err))
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
-		return
+		return nil, err
 	}
+	return rangeSubTasks(req.Hash, uncoveredRanges(m.SizeBig(), new(big.Int), covered), now), nil
+}
 
-	logger.LogHash("API", req.Hash, fmt.Sprintf("Новая задача создана (RequestId=%s, подзадач: %d)", requestId, numSubTasks))
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(CrackResponse{RequestId: requestId})
+// rangeSubTasks создаёт подзадачи в статусе "RECEIVED", каждой из которых назначен диапазон [start, end).
+func rangeSubTasks(hash string, ranges []keyspace.Range, now time.Time) []models.SubTask {
+	subTasks := make([]models.SubTask, len(ranges))
+	for i, r := range ranges {
+		subTasks[i] = models.SubTask{
+			Hash:          hash,
+			SubTaskNumber: i + 1,
+			Status:        "RECEIVED",
+			RangeStart:    r.Start.String(),
+			RangeEnd:      r.End.String(),
+			CreatedAt:     now,
+			UpdatedAt:     now,
+		}
+	}
+	return subTasks
+}
+
+// validateAlphabet проверяет, что алфавит не пуст и не содержит повторяющихся символов.
+func validateAlphabet(alphabet string) error {
+	if alphabet == "" {
+		return fmt.Errorf("алфавит пуст")
+	}
+	if len(alphabet) > constants.MaxAlphabetSize {
+		return fmt.Errorf("алфавит длиннее %d символов", constants.MaxAlphabetSize)
+	}
+	seen := [256]bool{}
+	for i := 0; i < len(alphabet); i++ {
+		if seen[alphabet[i]] {
+			return fmt.Errorf("символ %q повторяется", alphabet[i])
+		}
+		seen[alphabet[i]] = true
+	}
+	return nil
+}
+
+// dictionarySubTasks делит словарь на диапазоны строк, каждый из которых становится подзадачей.
+// При использовании правил каждое слово порождает несколько кандидатов, поэтому диапазоны уменьшаются.
+func dictionarySubTasks(req CrackRequest, now time.Time) ([]models.SubTask, error) {
+	path, err := wordlist.Path(wordlist.Dir(), req.Wordlist)
+	if err != nil {
+		return nil, err
+	}
+	linesPerSubTask := constants.MaxWordsPerSubTask
+	if req.Rules != "" {
+		ruleSet, err := rules.Load(req.Rules)
+		if err != nil {
+			return nil, fmt.Errorf("набор правил %q: %v", req.Rules, err)
+		}
+		linesPerSubTask = max(1, linesPerSubTask/len(ruleSet.Rules))
+	}
+	chunks, lines, err := wordlist.Split(path, linesPerSubTask)
+	if err != nil {
+		return nil, err
+	}
+	if lines == 0 {
+		return nil, fmt.Errorf("словарь пуст")
+	}
+
+	subTasks := make([]models.SubTask, len(chunks))
+	for i, chunk := range chunks {
+		subTasks[i] = models.SubTask{
+			Hash:          req.Hash,
+			SubTaskNumber: i + 1,
+			Status:        "RECEIVED",
+			WordOffset:    chunk.Offset,
+			StartLine:     chunk.StartLine,
+			LineCount:     chunk.LineCount,
+			CreatedAt:     now,
+			UpdatedAt:     now,
+		}
+	}
+	return subTasks, nil
 }
 
 // handleStatus возвращает статус задачи взлома по её requestId.
@@ -147,20 +519,148 @@ func handleStatus(w http.ResponseWriter, r *http.Request, coll *mongo.Collection
 		resp = StatusResponse{Status: "IN_PROGRESS", Data: percent}
 	case "DONE":
 		resp = StatusResponse{Status: "DONE", Data: task.Result}
+		if len(task.Hashes) > 0 {
+			resp.Data = fmt.Sprintf("Найдено паролей: %d из %d", len(task.Results), len(task.Hashes))
+		}
 	case "FAIL":
 		resp = StatusResponse{Status: "FAIL", Data: "Хэш не был расшифрован"}
+		if task.DeadTaskCount > 0 {
+			resp.Data = fmt.Sprintf("Хэш не был расшифрован, подзадач без результата: %d из %d", task.DeadTaskCount, task.SubTaskCount)
+		}
+	case "CANCELLED":
+		resp = StatusResponse{Status: "CANCELLED", Data: "Задача отменена"}
 	default:
 		resp = StatusResponse{Status: "IN_PROGRESS", Data: 0.0}
 	}
+	if len(task.Hashes) > 0 {
+		resp.Hashes = batchHashStatuses(task)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// handleCancel отменяет задачу по её requestId: задача и её незавершённые подзадачи получают статус "CANCELLED",
+// поэтому публикатор перестаёт отправлять их в очередь, а воркерам рассылается сигнал прервать перебор.
+func handleCancel(w http.ResponseWriter, r *http.Request, coll *mongo.Collection, subs *subtasks.Store, control ControlPublisher) {
+	requestId := r.URL.Query().Get("requestId")
+	if requestId == "" {
+		http.Error(w, "requestId parameter is required", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), constants.ContextTimeout)
+	defer cancel()
+
+	// Задача и её подзадачи отменяются в одной транзакции
+	cancelled := false
+	err := mongodb.WithTransaction(ctx, coll.Database().Client(), func(sc mongo.SessionContext) error {
+		res, err := coll.UpdateOne(sc,
+			bson.M{"requestId": requestId, "status": "IN_PROGRESS"},
+			bson.M{
+				"$set":   bson.M{"status": "CANCELLED", "receivedTaskCount": 0},
+				"$unset": bson.M{"dedupKey": ""},
+				"$inc":   bson.M{"version": 1},
+			},
+		)
+		if err != nil {
+			return err
+		}
+		cancelled = res.ModifiedCount > 0
+		if !cancelled {
+			return nil
+		}
+		return subs.Cancel(sc, requestId, time.Now())
+	})
+	if err != nil {
+		logger.Log("API", fmt.Sprintf("Ошибка отмены задачи %s: %v", requestId, err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	var task models.HashTask
+	if err := coll.FindOne(ctx, bson.M{"requestId": requestId}).Decode(&task); err != nil {
+		logger.Log("API", "Задача с requestId "+requestId+" не найдена")
+		http.Error(w, "Task not found", http.StatusNotFound)
+		return
+	}
+	if task.Status != "CANCELLED" {
+		http.Error(w, fmt.Sprintf("Task is already finished with status %s", task.Status), http.StatusConflict)
+		return
+	}
+
+	if cancelled {
+		logger.LogHash("API", task.Hash, fmt.Sprintf("Задача отменена (RequestId=%s)", requestId))
+		// Подзадачи, уже попавшие к воркерам, прерываются по сигналу; если он не дошёл,
+		// их результаты всё равно будут проигнорированы
+		msg := models.ControlMessage{Type: constants.ControlCancel, RequestId: requestId, Hash: task.Hash}
+		if err := control.Publish(msg); err != nil {
+			logger.LogHash("API", task.Hash, fmt.Sprintf("Не удалось разослать сигнал отмены: %v", err))
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(StatusResponse{Status: "CANCELLED", Data: "Задача отменена"})
+}
+
+// handleMetrics считает сводку по всем задачам: сколько из них решено досрочно
+// и сколько подзадач и кандидатов благодаря этому не пришлось перебирать.
+func handleMetrics(w http.ResponseWriter, coll *mongo.Collection) {
+	ctx, cancel := context.WithTimeout(context.Background(), constants.LongContextTimeout)
+	defer cancel()
+
+	opts := options.Find().SetProjection(bson.M{
+		"status":            1,
+		"subTaskCount":      1,
+		"skippedTaskCount":  1,
+		"skippedCandidates": 1,
+		"deadTaskCount":     1,
+	})
+	cursor, err := coll.Find(ctx, bson.M{}, opts)
+	if err != nil {
+		logger.Log("API", fmt.Sprintf("Ошибка чтения задач для метрик: %v", err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer cursor.Close(ctx)
+
+	resp := MetricsResponse{Tasks: make(map[string]int)}
+	skippedCandidates := new(big.Int)
+	for cursor.Next(ctx) {
+		var task models.HashTask
+		if err := cursor.Decode(&task); err != nil {
+			logger.Log("API", fmt.Sprintf("Ошибка декодирования задачи для метрик: %v", err))
+			continue
+		}
+		resp.Tasks[task.Status]++
+		resp.SubTasks += task.SubTaskCount
+		resp.DeadSubTasks += task.DeadTaskCount
+		if task.SkippedTaskCount > 0 {
+			resp.SolvedEarly++
+			resp.SkippedSubTasks += task.SkippedTaskCount
+		}
+		if candidates, ok := new(big.Int).SetString(task.SkippedCandidates, 10); ok {
+			skippedCandidates.Add(skippedCandidates, candidates)
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		logger.Log("API", fmt.Sprintf("Ошибка чтения задач для метрик: %v", err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	resp.SkippedCandidates = skippedCandidates.String()
+	if resp.SubTasks > 0 {
+		resp.SavedPercent = float64(resp.SkippedSubTasks) / float64(resp.SubTasks) * 100
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(resp)
 }
 
 // StartHTTPServer инициализирует и запускает HTTP-сервер для обработки API-запросов.
-func StartHTTPServer(coll *mongo.Collection) {
+func StartHTTPServer(coll *mongo.Collection, subs *subtasks.Store, pot *potfile.Store, control ControlPublisher, dlq DeadLetterQueues) {
 	mux := http.NewServeMux()
-	RegisterHandlers(mux, coll)
+	RegisterHandlers(mux, coll, subs, pot, control, dlq)
 
 	port := os.Getenv("PORT")
 	if port == "" {
@@ -0,0 +1,66 @@
+package subtasks
+
+import (
+	"context"
+	"fmt"
+
+	"common/models"
+	"common/mongodb"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// legacyTask - задача в прежнем формате, где подзадачи хранились массивом subTasks в её документе.
+type legacyTask struct {
+	RequestId string           `bson:"requestId"`
+	SubTasks  []models.SubTask `bson:"subTasks"`
+}
+
+// MigrateEmbedded переносит подзадачи, встроенные в документы задач коллекции tasks, в коллекцию подзадач
+// и возвращает количество перенесённых задач. Каждая задача переносится в своей транзакции: подзадачи
+// вставляются, массив subTasks удаляется, а receivedTaskCount вычисляется по статусам подзадач.
+// Поэтому прерванный перенос безопасно запустить снова: он продолжится с задач, которые ещё не перенесены.
+func (s *Store) MigrateEmbedded(ctx context.Context, tasks *mongo.Collection) (int, error) {
+	opts := options.Find().SetProjection(bson.M{"requestId": 1, "subTasks": 1})
+	cursor, err := tasks.Find(ctx, bson.M{"subTasks": bson.M{"$exists": true}}, opts)
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	migrated := 0
+	for cursor.Next(ctx) {
+		var task legacyTask
+		if err := cursor.Decode(&task); err != nil {
+			return migrated, err
+		}
+		received := 0
+		for i := range task.SubTasks {
+			task.SubTasks[i].RequestId = task.RequestId
+			if task.SubTasks[i].Status == "RECEIVED" {
+				received++
+			}
+		}
+		err := mongodb.WithTransaction(ctx, tasks.Database().Client(), func(sc mongo.SessionContext) error {
+			if err := s.Insert(sc, task.SubTasks); err != nil {
+				return err
+			}
+			_, err := tasks.UpdateOne(sc,
+				bson.M{"requestId": task.RequestId, "subTasks": bson.M{"$exists": true}},
+				bson.M{
+					"$unset": bson.M{"subTasks": ""},
+					"$set":   bson.M{"receivedTaskCount": received},
+					"$inc":   bson.M{"version": 1},
+				},
+			)
+			return err
+		})
+		if err != nil {
+			return migrated, fmt.Errorf("перенос подзадач задачи %s: %w", task.RequestId, err)
+		}
+		migrated++
+	}
+	return migrated, cursor.Err()
+}
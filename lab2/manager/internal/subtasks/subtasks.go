@@ -0,0 +1,196 @@
+package subtasks
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"time"
+
+	"common/keyspace"
+	"common/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrUnchanged возвращается, если подзадача уже не в том состоянии, из которого её меняют
+// (её успел изменить результат, reaper или отмена). Внутри транзакции такая ошибка прерывает её.
+var ErrUnchanged = errors.New("subtask is not in the expected state")
+
+// Store - коллекция subtasks: по документу на подзадачу, ключ - (requestId, subTaskNumber).
+// Счётчики подзадач по статусам хранятся в задаче, поэтому каждое изменение статуса подзадачи выполняется
+// в одной транзакции с изменением счётчиков и версии задачи.
+type Store struct {
+	coll *mongo.Collection
+}
+
+// NewStore создаёт хранилище подзадач поверх коллекции. Индексы коллекции создаёт миграция схемы (см. migrations).
+func NewStore(coll *mongo.Collection) *Store {
+	return &Store{coll: coll}
+}
+
+// Insert добавляет подзадачи новой задачи.
+func (s *Store) Insert(ctx context.Context, subTasks []models.SubTask) error {
+	if len(subTasks) == 0 {
+		return nil
+	}
+	docs := make([]interface{}, len(subTasks))
+	for i := range subTasks {
+		docs[i] = subTasks[i]
+	}
+	_, err := s.coll.InsertMany(ctx, docs)
+	return err
+}
+
+// Get возвращает подзадачу или mongo.ErrNoDocuments, если её нет.
+func (s *Store) Get(ctx context.Context, requestId string, number int) (models.SubTask, error) {
+	var sub models.SubTask
+	err := s.coll.FindOne(ctx, key(requestId, number)).Decode(&sub)
+	return sub, err
+}
+
+// Received возвращает не более limit подзадач задачи в статусе "RECEIVED" в порядке номеров.
+func (s *Store) Received(ctx context.Context, requestId string, limit int) ([]models.SubTask, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "subTaskNumber", Value: 1}}).SetLimit(int64(limit))
+	return s.find(ctx, bson.M{"requestId": requestId, "status": "RECEIVED"}, opts)
+}
+
+// WithStatus возвращает подзадачи задачи в статусах statuses.
+func (s *Store) WithStatus(ctx context.Context, requestId string, statuses ...string) ([]models.SubTask, error) {
+	in := make(bson.A, len(statuses))
+	for i, status := range statuses {
+		in[i] = status
+	}
+	opts := options.Find().SetProjection(bson.M{"rangeStart": 1, "rangeEnd": 1})
+	return s.find(ctx, bson.M{"requestId": requestId, "status": bson.M{"$in": in}}, opts)
+}
+
+// Stale возвращает не более limit подзадач в статусе status (STARTED или PUBLISHED), не менявшихся с cutoff:
+// для STARTED это время последнего heartbeat, для PUBLISHED - время публикации.
+func (s *Store) Stale(ctx context.Context, status string, cutoff time.Time, limit int) ([]models.SubTask, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "updatedAt", Value: 1}}).SetLimit(int64(limit))
+	return s.find(ctx, bson.M{"status": status, "updatedAt": bson.M{"$lt": cutoff}}, opts)
+}
+
+// MarkPublished отмечает подзадачи numbers в статусе "RECEIVED" как PUBLISHED.
+// Если хотя бы одна из них уже не RECEIVED, возвращает ErrUnchanged.
+func (s *Store) MarkPublished(ctx context.Context, requestId string, numbers []int, now time.Time) error {
+	res, err := s.coll.UpdateMany(ctx,
+		bson.M{"requestId": requestId, "subTaskNumber": bson.M{"$in": numbers}, "status": "RECEIVED"},
+		bson.M{"$set": bson.M{"status": "PUBLISHED", "updatedAt": now}},
+	)
+	if err != nil {
+		return err
+	}
+	if res.ModifiedCount != int64(len(numbers)) {
+		return ErrUnchanged
+	}
+	return nil
+}
+
+// Heartbeat отмечает подзадачу, которую воркер получил и перебирает, как STARTED и продлевает её аренду
+// с момента now. Подзадача меняется, только если она PUBLISHED или STARTED с той же попыткой attempts
+// (heartbeat публикации, аренда которой уже истекла, ничего не меняет); иначе возвращает ErrUnchanged.
+// STARTED не учитывается в счётчиках задачи, поэтому heartbeat не меняет документ задачи.
+func (s *Store) Heartbeat(ctx context.Context, requestId string, number, attempts int, now time.Time) error {
+	filter := key(requestId, number)
+	filter["status"] = bson.M{"$in": bson.A{"PUBLISHED", "STARTED"}}
+	if attempts == 0 {
+		filter["attempts"] = bson.M{"$in": bson.A{0, nil}}
+	} else {
+		filter["attempts"] = attempts
+	}
+	return s.updateOne(ctx, filter, bson.M{"$set": bson.M{"status": "STARTED", "updatedAt": now}})
+}
+
+// Complete отмечает подзадачу в статусе from как COMPLETE и сохраняет ключ идемпотентности результата resultKey.
+// Если подзадача не в статусе from, возвращает ErrUnchanged.
+func (s *Store) Complete(ctx context.Context, requestId string, number int, from, resultKey string, now time.Time) error {
+	set := bson.M{"status": "COMPLETE", "updatedAt": now}
+	if resultKey != "" {
+		set["resultKey"] = resultKey
+	}
+	filter := key(requestId, number)
+	filter["status"] = from
+	return s.updateOne(ctx, filter, bson.M{"$set": set})
+}
+
+// Expire переводит подзадачу с истёкшей арендой (в статусе from, не менявшуюся с cutoff) в статус status
+// (RECEIVED или DEAD) и увеличивает счётчик попыток. Если подзадачу успели изменить, возвращает ErrUnchanged.
+func (s *Store) Expire(ctx context.Context, requestId string, number int, from string, cutoff time.Time, status string, now time.Time) error {
+	filter := key(requestId, number)
+	filter["status"] = from
+	filter["updatedAt"] = bson.M{"$lt": cutoff}
+	return s.updateOne(ctx, filter, bson.M{
+		"$set": bson.M{"status": status, "updatedAt": now},
+		"$inc": bson.M{"attempts": 1},
+	})
+}
+
+// Cancel отмечает неотправленные и выполняющиеся подзадачи задачи как CANCELLED.
+func (s *Store) Cancel(ctx context.Context, requestId string, now time.Time) error {
+	_, err := s.coll.UpdateMany(ctx,
+		bson.M{"requestId": requestId, "status": bson.M{"$in": bson.A{"RECEIVED", "PUBLISHED", "STARTED"}}},
+		bson.M{"$set": bson.M{"status": "CANCELLED", "updatedAt": now}},
+	)
+	return err
+}
+
+// SkipUnfinished отмечает подзадачи задачи, которые ещё не отправлены или перебираются воркерами, как SKIPPED
+// и возвращает их количество и сколько кандидатов в них не понадобилось проверять.
+// Подзадачи, которые воркеры уже начали, учитываются целиком: воркер прерывает их по сигналу "solved".
+func (s *Store) SkipUnfinished(ctx context.Context, requestId string, now time.Time) (int, *big.Int, error) {
+	filter := bson.M{"requestId": requestId, "status": bson.M{"$in": bson.A{"RECEIVED", "PUBLISHED", "STARTED"}}}
+	opts := options.Find().SetProjection(bson.M{"rangeStart": 1, "rangeEnd": 1, "lineCount": 1})
+	unfinished, err := s.find(ctx, filter, opts)
+	if err != nil {
+		return 0, nil, err
+	}
+	candidates := new(big.Int)
+	for _, sub := range unfinished {
+		if sub.RangeEnd == "" {
+			candidates.Add(candidates, big.NewInt(int64(sub.LineCount)))
+			continue
+		}
+		if r, err := keyspace.ParseRange(sub.RangeStart, sub.RangeEnd); err == nil {
+			candidates.Add(candidates, r.Len())
+		}
+	}
+	if len(unfinished) > 0 {
+		if _, err := s.coll.UpdateMany(ctx, filter, bson.M{"$set": bson.M{"status": "SKIPPED", "updatedAt": now}}); err != nil {
+			return 0, nil, err
+		}
+	}
+	return len(unfinished), candidates, nil
+}
+
+// find возвращает подзадачи, подходящие под filter.
+func (s *Store) find(ctx context.Context, filter bson.M, opts ...*options.FindOptions) ([]models.SubTask, error) {
+	cursor, err := s.coll.Find(ctx, filter, opts...)
+	if err != nil {
+		return nil, err
+	}
+	var subTasks []models.SubTask
+	if err := cursor.All(ctx, &subTasks); err != nil {
+		return nil, err
+	}
+	return subTasks, nil
+}
+
+// updateOne обновляет одну подзадачу и возвращает ErrUnchanged, если под filter ничего не подошло.
+func (s *Store) updateOne(ctx context.Context, filter, update bson.M) error {
+	res, err := s.coll.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if res.ModifiedCount == 0 {
+		return ErrUnchanged
+	}
+	return nil
+}
+
+// key возвращает фильтр подзадачи по её ключу.
+func key(requestId string, number int) bson.M {
+	return bson.M{"requestId": requestId, "subTaskNumber": number}
+}
@@ -0,0 +1,13 @@
+#!/bin/sh
+# Подключает к рабочим очередям "tasks" и "results" очереди недоставленных сообщений политиками RabbitMQ.
+# Политика, в отличие от аргументов x-dead-letter-* при объявлении очереди, применяется и к уже
+# существующим очередям, поэтому обновление не требует удалять очереди вместе с сообщениями.
+# Запускается вместе с брокером (см. docker-compose.yml); повторный запуск безопасен.
+set -e
+
+rabbitmqctl await_startup --timeout 300
+
+for queue in tasks results; do
+	rabbitmqctl set_policy --apply-to queues "$queue-dead-letter" "^$queue\$" \
+		"{\"dead-letter-exchange\":\"dead-letter\",\"dead-letter-routing-key\":\"$queue.dead\"}"
+done
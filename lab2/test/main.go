@@ -7,34 +7,71 @@ import (
 	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
+	"mime/multipart"
 	"net/http"
 	"os"
 	"time"
 )
 
 const (
-	baseURL = "http://localhost:8080/api/hash"
+	baseURL    = "http://localhost:8080/api/hash"
+	metricsURL = "http://localhost:8080/api/metrics"
+	potfileURL = "http://localhost:8080/api/potfile"
 )
 
 type CrackRequest struct {
-	Hash      string `json:"hash"`
-	MaxLength int    `json:"maxLength"`
+	Hash      string   `json:"hash"`
+	Alphabet  string   `json:"alphabet,omitempty"`
+	MinLength int      `json:"minLength,omitempty"`
+	MaxLength int      `json:"maxLength"`
+	Mode      string   `json:"mode,omitempty"`
+	Wordlist  string   `json:"wordlist,omitempty"`
+	Rules     string   `json:"rules,omitempty"`
+	Mask      string   `json:"mask,omitempty"`
+	Charsets  []string `json:"charsets,omitempty"`
 }
 
 type CrackResponse struct {
 	RequestId string `json:"requestId"`
+	Hashes    int    `json:"hashes"`
+	Rejected  []struct {
+		Line int    `json:"line"`
+		Text string `json:"text"`
+		Err  string `json:"error"`
+	} `json:"rejected"`
 }
 
 type StatusResponse struct {
 	Status string      `json:"status"`
 	Data   interface{} `json:"data"`
+	Hashes []struct {
+		Hash   string   `json:"hash"`
+		Users  []string `json:"users"`
+		Status string   `json:"status"`
+		Result string   `json:"result"`
+	} `json:"hashes"`
 }
 
 func main() {
 	md5Command := flag.String("md5", "", "Строка для хэширования в MD5")
 	crackCommand := flag.String("crack", "", "MD5 хэш для расшифровки")
+	batchCommand := flag.String("batch", "", "Файл со списком MD5 хэшей (hash, user:hash, pwdump) для пакетной задачи")
 	statusCommand := flag.String("status", "", "ID запроса для проверки статуса")
+	cancelCommand := flag.String("cancel", "", "ID запроса для отмены задачи")
+	metricsCommand := flag.Bool("metrics", false, "Показать метрики задач (сэкономленный перебор)")
+	exportCommand := flag.Bool("potfile", false, "Выгрузить potfile (hash:plain)")
+	importCommand := flag.String("import-potfile", "", "Файл potfile hashcat (hash:plain) для импорта")
 	autoFlag := flag.Bool("auto", false, "Автоматический переход между командами")
+	wordlistFlag := flag.String("wordlist", "", "Словарь для атаки по словарю (вместо перебора)")
+	rulesFlag := flag.String("rules", "", "Набор правил для мутации слов словаря")
+	alphabetFlag := flag.String("alphabet", "", "Алфавит перебора (по умолчанию a-z0-9)")
+	minLengthFlag := flag.Int("min", 0, "Минимальная длина кандидата")
+	maskFlag := flag.String("mask", "", "Маска для атаки по маске, например Company?d?d?d?d")
+	var charsetFlags [4]*string
+	for i := range charsetFlags {
+		charsetFlags[i] = flag.String(fmt.Sprint(i+1), "", fmt.Sprintf("Пользовательский набор символов ?%d", i+1))
+	}
 
 	flag.Parse()
 
@@ -77,20 +114,36 @@ func main() {
 			checkStatus(crackResp.RequestId)
 		}
 
-	case *crackCommand != "":
-		if len(args) != 1 {
-			fmt.Println("Использование: -crack <hash> <length>")
-			os.Exit(1)
-		}
-		maxLength := 0
-		if _, err := fmt.Sscanf(args[0], "%d", &maxLength); err != nil {
-			fmt.Println("Ошибка: длина должна быть числом")
-			os.Exit(1)
-		}
-
-		req := CrackRequest{
-			Hash:      *crackCommand,
-			MaxLength: maxLength,
+	case *crackCommand != "" || *batchCommand != "":
+		req := CrackRequest{Hash: *crackCommand}
+		if *maskFlag != "" {
+			req.Mode = "mask"
+			req.Mask = *maskFlag
+			// Наборы передаются позиционно: ?N соответствует N-му элементу
+			last := 0
+			for i, charset := range charsetFlags {
+				if *charset != "" {
+					last = i + 1
+				}
+			}
+			for _, charset := range charsetFlags[:last] {
+				req.Charsets = append(req.Charsets, *charset)
+			}
+		} else if *wordlistFlag != "" {
+			req.Mode = "dictionary"
+			req.Wordlist = *wordlistFlag
+			req.Rules = *rulesFlag
+		} else {
+			if len(args) != 1 {
+				fmt.Println("Использование: -crack <hash> <length> или -batch <file> <length>")
+				os.Exit(1)
+			}
+			if _, err := fmt.Sscanf(args[0], "%d", &req.MaxLength); err != nil {
+				fmt.Println("Ошибка: длина должна быть числом")
+				os.Exit(1)
+			}
+			req.Alphabet = *alphabetFlag
+			req.MinLength = *minLengthFlag
 		}
 		data, err := json.Marshal(req)
 		if err != nil {
@@ -98,12 +151,22 @@ func main() {
 			os.Exit(1)
 		}
 
-		resp, err := http.Post(baseURL+"/crack", "application/json", bytes.NewBuffer(data))
+		var resp *http.Response
+		if *batchCommand != "" {
+			resp, err = postBatch(*batchCommand, data)
+		} else {
+			resp, err = http.Post(baseURL+"/crack", "application/json", bytes.NewBuffer(data))
+		}
 		if err != nil {
 			fmt.Printf("Ошибка: %v\n", err)
 			os.Exit(1)
 		}
 		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			body, _ := io.ReadAll(resp.Body)
+			fmt.Printf("Задача не создана (%s): %s", resp.Status, body)
+			os.Exit(1)
+		}
 
 		var crackResp CrackResponse
 		if err := json.NewDecoder(resp.Body).Decode(&crackResp); err != nil {
@@ -112,6 +175,12 @@ func main() {
 		}
 
 		fmt.Printf("%s\n", crackResp.RequestId)
+		if *batchCommand != "" {
+			fmt.Printf("Хэшей в задаче: %d\n", crackResp.Hashes)
+			for _, rejected := range crackResp.Rejected {
+				fmt.Printf("Строка %d отклонена (%s): %s\n", rejected.Line, rejected.Err, rejected.Text)
+			}
+		}
 
 		if *autoFlag {
 			// Автоматически проверяем статус
@@ -121,11 +190,31 @@ func main() {
 	case *statusCommand != "":
 		checkStatus(*statusCommand)
 
+	case *cancelCommand != "":
+		cancelTask(*cancelCommand)
+
+	case *metricsCommand:
+		printMetrics()
+
+	case *exportCommand:
+		exportPotfile()
+
+	case *importCommand != "":
+		importPotfile(*importCommand)
+
 	default:
 		fmt.Println("Использование:")
 		fmt.Println("  -md5 <string>         Хэширование строки в MD5")
 		fmt.Println("  -crack <hash> <length> Расшифровка MD5 хэша")
+		fmt.Println("  -alphabet <chars> -min <n> -crack <hash> <length> Перебор со своим алфавитом и длинами")
+		fmt.Println("  -batch <file> <length> Пакетная задача: все хэши файла за один проход (также с -mask, -wordlist)")
 		fmt.Println("  -status <id>          Проверка статуса расшифровки")
+		fmt.Println("  -cancel <id>          Отмена задачи")
+		fmt.Println("  -metrics              Метрики задач и сэкономленного перебора")
+		fmt.Println("  -potfile              Выгрузка всех найденных паролей (hash:plain)")
+		fmt.Println("  -import-potfile <file> Импорт potfile hashcat")
+		fmt.Println("  -wordlist <id> [-rules <id>] -crack <hash> Атака по словарю")
+		fmt.Println("  -mask <mask> [-1 <charset> ... -4 <charset>] -crack <hash> Атака по маске")
 		fmt.Println("  -auto                 Автоматический переход между командами")
 	}
 }
@@ -149,10 +238,16 @@ func checkStatus(requestId string) {
 		switch statusResp.Status {
 		case "DONE":
 			fmt.Printf("Результат: %v\n", statusResp.Data)
+			for _, hash := range statusResp.Hashes {
+				fmt.Printf("  %s %v %s %s\n", hash.Hash, hash.Users, hash.Status, hash.Result)
+			}
 			return
 		case "ERROR":
 			fmt.Printf("Ошибка: %v\n", statusResp.Data)
 			return
+		case "CANCELLED":
+			fmt.Printf("Задача отменена\n")
+			return
 		case "IN_PROGRESS":
 			progress, ok := statusResp.Data.(float64)
 			if !ok {
@@ -167,3 +262,130 @@ func checkStatus(requestId string) {
 		}
 	}
 }
+
+// postBatch загружает файл со списком хэшей вместе с параметрами атаки (JSON) на /crack/batch.
+func postBatch(path string, params []byte) (*http.Response, error) {
+	hashes, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	if err := form.WriteField("request", string(params)); err != nil {
+		return nil, err
+	}
+	part, err := form.CreateFormFile("hashes", path)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := part.Write(hashes); err != nil {
+		return nil, err
+	}
+	if err := form.Close(); err != nil {
+		return nil, err
+	}
+	return http.Post(baseURL+"/crack/batch", form.FormDataContentType(), &body)
+}
+
+func cancelTask(requestId string) {
+	req, err := http.NewRequest(http.MethodDelete, fmt.Sprintf("%s/crack?requestId=%s", baseURL, requestId), nil)
+	if err != nil {
+		fmt.Printf("Ошибка: %v\n", err)
+		os.Exit(1)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		fmt.Printf("Ошибка: %v\n", err)
+		os.Exit(1)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		fmt.Printf("Задача не отменена (%s): %s", resp.Status, body)
+		os.Exit(1)
+	}
+	fmt.Println("Задача отменена")
+}
+
+func printMetrics() {
+	resp, err := http.Get(metricsURL)
+	if err != nil {
+		fmt.Printf("Ошибка: %v\n", err)
+		os.Exit(1)
+	}
+	defer resp.Body.Close()
+
+	var metrics struct {
+		Tasks             map[string]int `json:"tasks"`
+		SolvedEarly       int            `json:"solvedEarly"`
+		SubTasks          int            `json:"subTasks"`
+		SkippedSubTasks   int            `json:"skippedSubTasks"`
+		SkippedCandidates string         `json:"skippedCandidates"`
+		SavedPercent      float64        `json:"savedPercent"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&metrics); err != nil {
+		fmt.Printf("Ошибка: %v\n", err)
+		os.Exit(1)
+	}
+	for status, count := range metrics.Tasks {
+		fmt.Printf("%s: %d\n", status, count)
+	}
+	fmt.Printf("Решено досрочно: %d\n", metrics.SolvedEarly)
+	fmt.Printf("Пропущено подзадач: %d из %d (%.1f%%)\n", metrics.SkippedSubTasks, metrics.SubTasks, metrics.SavedPercent)
+	fmt.Printf("Не проверено кандидатов: %s\n", metrics.SkippedCandidates)
+}
+
+func exportPotfile() {
+	resp, err := http.Get(potfileURL)
+	if err != nil {
+		fmt.Printf("Ошибка: %v\n", err)
+		os.Exit(1)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		fmt.Printf("Ошибка (%s): %s", resp.Status, body)
+		os.Exit(1)
+	}
+	io.Copy(os.Stdout, resp.Body)
+}
+
+func importPotfile(path string) {
+	file, err := os.Open(path)
+	if err != nil {
+		fmt.Printf("Ошибка: %v\n", err)
+		os.Exit(1)
+	}
+	defer file.Close()
+
+	resp, err := http.Post(potfileURL, "text/plain", file)
+	if err != nil {
+		fmt.Printf("Ошибка: %v\n", err)
+		os.Exit(1)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		fmt.Printf("Ошибка (%s): %s", resp.Status, body)
+		os.Exit(1)
+	}
+
+	var result struct {
+		Imported int `json:"imported"`
+		Existing int `json:"existing"`
+		Rejected []struct {
+			Line int    `json:"line"`
+			Text string `json:"text"`
+			Err  string `json:"error"`
+		} `json:"rejected"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		fmt.Printf("Ошибка: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Добавлено: %d, уже известно: %d\n", result.Imported, result.Existing)
+	for _, line := range result.Rejected {
+		fmt.Printf("Строка %d отклонена (%s): %s\n", line.Line, line.Err, line.Text)
+	}
+}
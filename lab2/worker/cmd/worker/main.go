@@ -1,45 +1,44 @@
 package main
 
 import (
-	"log"
-	"os"
-	"time"
+	"fmt"
+	"sync"
 
 	"common/amqputil"
-	"common/constants"
 	"common/logger"
+	"worker/internal/batch"
+	"worker/internal/config"
 	"worker/internal/consumer"
+	"worker/internal/control"
+
+	"github.com/streadway/amqp"
 )
 
 func main() {
 	logger.Log("Worker", "Запуск Worker...")
 
-	rabbitURI := os.Getenv("RABBITMQ_URI")
-	if rabbitURI == "" {
-		rabbitURI = constants.DefaultRabbitURI
-	}
-	conn, err := amqputil.ConnectRabbitMQ(rabbitURI)
-	if err != nil {
-		log.Fatalf("Не удалось подключиться к RabbitMQ: %v", err)
-	}
-	defer conn.Close()
-
-	for {
-		err = consumer.Consume(&conn, rabbitURI)
-		if err != nil {
-			logger.Log("Worker", "Ошибка в Consumer: "+err.Error())
+	cfg := config.Load()
+	registry := control.NewRegistry()
+	batchHashes := batch.NewHashes(cfg.ManagerURL)
+	// Сессия сама восстанавливает соединение и объявляет очереди, а Run перезапускает функцию
+	// на новом канале после каждого его закрытия. Каждый consumer и подписка на управляющие сообщения
+	// работают на собственном канале
+	session := amqputil.NewSession(cfg.RabbitURI, amqputil.DeclareTopology)
+	defer session.Close()
 
-			if conn.IsClosed() {
-				newConn, connErr := amqputil.ConnectRabbitMQ(rabbitURI)
-				if connErr != nil {
-					logger.Log("Worker", "Не удалось восстановить соединение: "+connErr.Error())
-				} else {
-					conn = newConn
-				}
-			}
-		}
+	go session.Run("Worker Control", func(ch *amqp.Channel) error {
+		return consumer.ListenControl(ch, registry)
+	})
 
-		logger.Log("Worker", "Перезапуск consumer через 5 секунд...")
-		time.Sleep(5 * time.Second)
+	var wg sync.WaitGroup
+	for i := 1; i <= cfg.Concurrency; i++ {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			session.Run(name, func(ch *amqp.Channel) error {
+				return consumer.Consume(ch, cfg, registry, batchHashes)
+			})
+		}(fmt.Sprintf("Worker Consumer %d", i))
 	}
+	wg.Wait()
 }
@@ -0,0 +1,115 @@
+package batch
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"common/constants"
+	"common/logger"
+)
+
+// ErrNotFound - менеджер не знает пакетной задачи с таким requestId.
+var ErrNotFound = errors.New("batch task not found")
+
+// Hashes хранит списки хешей пакетных задач. Сообщения подзадач пакетной задачи несут только признак Batch,
+// а список воркер получает у менеджера при первой подзадаче задачи и использует для всех следующих.
+// Подзадачи одной задачи, пришедшие одновременно, ждут один запрос. Список, к которому не обращались
+// дольше constants.BatchHashesTTL, забывается. Пароли, найденные после получения списка, остаются в нём:
+// воркер лишь проверяет лишние хеши, а менеджер повторно найденные пароли не учитывает.
+type Hashes struct {
+	managerURL string
+	client     *http.Client
+
+	mu    sync.Mutex
+	lists map[string]*hashList // requestId -> список хешей
+}
+
+// hashList - список хешей одной задачи; ready закрывается, когда запрос к менеджеру завершён.
+type hashList struct {
+	ready  chan struct{}
+	hashes []string
+	err    error
+	used   time.Time
+}
+
+// NewHashes создаёт хранилище списков, которые запрашиваются у менеджера по адресу managerURL.
+func NewHashes(managerURL string) *Hashes {
+	return &Hashes{
+		managerURL: managerURL,
+		client:     &http.Client{Timeout: constants.LongContextTimeout},
+		lists:      make(map[string]*hashList),
+	}
+}
+
+// Get возвращает хеши пакетной задачи requestId, пароли для которых не были известны при запросе списка.
+// Неудачный запрос не запоминается: следующая подзадача запросит список снова.
+func (h *Hashes) Get(ctx context.Context, requestId string) ([]string, error) {
+	h.mu.Lock()
+	now := time.Now()
+	for id, list := range h.lists {
+		if now.Sub(list.used) > constants.BatchHashesTTL {
+			delete(h.lists, id)
+		}
+	}
+	list, ok := h.lists[requestId]
+	if ok {
+		list.used = now
+		h.mu.Unlock()
+	} else {
+		list = &hashList{ready: make(chan struct{}), used: now}
+		h.lists[requestId] = list
+		h.mu.Unlock()
+
+		list.hashes, list.err = h.fetch(ctx, requestId)
+		if list.err != nil {
+			h.mu.Lock()
+			if h.lists[requestId] == list {
+				delete(h.lists, requestId)
+			}
+			h.mu.Unlock()
+		}
+		close(list.ready)
+	}
+
+	select {
+	case <-list.ready:
+		return list.hashes, list.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// fetch запрашивает список хешей задачи у менеджера.
+func (h *Hashes) fetch(ctx context.Context, requestId string) ([]string, error) {
+	endpoint := h.managerURL + constants.BatchHashesPath + "?requestId=" + url.QueryEscape(requestId)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, requestId)
+	case resp.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("менеджер вернул %s", resp.Status)
+	}
+
+	var body struct {
+		Hashes []string `json:"hashes"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("декодирование списка хешей: %w", err)
+	}
+	logger.Log("Worker Batch", fmt.Sprintf("Получен список хешей пакетной задачи %s: %d", requestId, len(body.Hashes)))
+	return body.Hashes, nil
+}
@@ -0,0 +1,60 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+
+	"common/constants"
+	"common/logger"
+)
+
+// Config - параметры воркера, задаваемые переменными окружения.
+type Config struct {
+	RabbitURI   string
+	ManagerURL  string // адрес менеджера, у которого запрашиваются списки хешей пакетных задач (MANAGER_URL)
+	Threads     int    // горутин на одну подзадачу (WORKER_THREADS, по умолчанию GOMAXPROCS)
+	Concurrency int    // подзадач, обрабатываемых одновременно (WORKER_CONCURRENCY, по умолчанию 1, если Threads > 1)
+	Prefetch    int    // неподтверждённых сообщений на воркер, делятся между consumer'ами (WORKER_PREFETCH)
+}
+
+// Load читает конфигурацию из окружения, некорректные значения заменяются значениями по умолчанию.
+func Load() *Config {
+	threads := positiveEnv("WORKER_THREADS", runtime.GOMAXPROCS(0))
+	// Каждая подзадача и так занимает threads горутин, поэтому по умолчанию воркер перебирает одну подзадачу за раз
+	concurrency := constants.DefaultMaxConcurrency
+	if threads > 1 {
+		concurrency = 1
+	}
+	cfg := &Config{
+		RabbitURI:   os.Getenv("RABBITMQ_URI"),
+		ManagerURL:  os.Getenv("MANAGER_URL"),
+		Threads:     threads,
+		Concurrency: positiveEnv("WORKER_CONCURRENCY", concurrency),
+		Prefetch:    positiveEnv("WORKER_PREFETCH", constants.DefaultPrefetchCount),
+	}
+	if cfg.RabbitURI == "" {
+		cfg.RabbitURI = constants.DefaultRabbitURI
+	}
+	if cfg.ManagerURL == "" {
+		cfg.ManagerURL = constants.DefaultManagerURL
+	}
+	logger.Log("Worker Config", fmt.Sprintf("Потоков на подзадачу: %d, одновременных подзадач: %d, prefetch: %d",
+		cfg.Threads, cfg.Concurrency, cfg.Prefetch))
+	return cfg
+}
+
+// positiveEnv возвращает положительное целое из переменной окружения name или def.
+func positiveEnv(name string, def int) int {
+	val := os.Getenv(name)
+	if val == "" {
+		return def
+	}
+	parsed, err := strconv.Atoi(val)
+	if err != nil || parsed < 1 {
+		logger.Log("Worker Config", fmt.Sprintf("Некорректное значение %s=%q, используется %d", name, val, def))
+		return def
+	}
+	return parsed
+}
@@ -2,34 +2,43 @@ package consumer
 
 import (
 	"encoding/json"
-	"sync"
+	"errors"
+	"fmt"
 
 	"common/amqputil"
 	"common/constants"
 	"common/logger"
 	"common/models"
+	"worker/internal/batch"
+	"worker/internal/config"
+	"worker/internal/control"
 	"worker/internal/processor"
 
 	"github.com/streadway/amqp"
 )
 
-// Consume подключается к очереди "tasks", потребляет сообщения и обрабатывает их.
-func Consume(connPtr **amqp.Connection, rabbitURI string) error {
-	ch, err := amqputil.CreateChannel(*connPtr, constants.TasksQueue, constants.DefaultPrefetchCount)
+// Consume потребляет сообщения очереди "tasks" на канале ch, выданном сессией RabbitMQ, и обрабатывает их по одной.
+// Воркер запускает cfg.Concurrency таких consumer'ов, каждый на собственном канале (см. Session.Run): подзадача
+// подтверждается и её результат публикуется на канале, через который она получена, поэтому горутины не делят канал.
+// Каждая подзадача перебирается в cfg.Threads горутинах и прерывается сигналом отмены через registry.
+// Подзадача подтверждается только после того, как брокер подтвердил получение её результата; если результат
+// доставить не удалось, подзадача возвращается в очередь, а Consume завершается, и сессия перезапускает его
+// на новом канале. Подзадачи, которые невозможно обработать, отправляются в очередь "tasks.dead" с причиной,
+// а после временных ошибок возвращаются в очередь "tasks" со счётчиком попыток. Повторная доставка подзадачи,
+// результат которой уже отправлен (тот же ключ идемпотентности), подтверждается без перебора.
+// Списки хешей пакетных задач consumer'ы берут из общего batchHashes.
+func Consume(ch *amqp.Channel, cfg *config.Config, registry *control.Registry, batchHashes *batch.Hashes) error {
+	// WORKER_PREFETCH - общий prefetch воркера, он делится между его consumer'ами
+	prefetch := (cfg.Prefetch + cfg.Concurrency - 1) / cfg.Concurrency
+	if err := ch.Qos(prefetch, 0, false); err != nil {
+		return fmt.Errorf("установка prefetch: %w", err)
+	}
+
+	// Результаты публикуются через тот же канал: подзадача и её результат подтверждаются вместе
+	results, err := amqputil.NewConfirmPublisher(ch, constants.PublishConfirmTimeout)
 	if err != nil {
-		if *connPtr != nil && (*connPtr).IsClosed() {
-			newCh, recErr := amqputil.Reconnect(connPtr, rabbitURI, constants.TasksQueue, constants.DefaultPrefetchCount, 5)
-			if recErr != nil {
-				logger.Log("Worker Consumer", "Не удалось восстановить канал: "+recErr.Error())
-				return recErr
-			}
-			ch = newCh
-		} else {
-			logger.Log("Worker Consumer", "Ошибка создания канала: "+err.Error())
-			return err
-		}
+		return fmt.Errorf("включение подтверждений публикации: %w", err)
 	}
-	defer ch.Close()
 
 	msgs, err := ch.Consume(constants.TasksQueue, "", false, false, false, false, nil)
 	if err != nil {
@@ -38,29 +47,56 @@ func Consume(connPtr **amqp.Connection, rabbitURI string) error {
 	}
 	logger.Log("Worker Consumer", "Consumer для очереди 'tasks' зарегистрирован")
 
-	var wg sync.WaitGroup
-	maxConcurrent := constants.DefaultMaxConcurrency
-	sem := make(chan struct{}, maxConcurrent)
-
-	for d := range msgs {
-		sem <- struct{}{}
-		wg.Add(1)
-		go func(delivery amqp.Delivery) {
-			defer wg.Done()
-			defer func() { <-sem }()
+	for delivery := range msgs {
+		if !handle(delivery, results, cfg, registry, batchHashes) {
+			// Неподтверждённые подзадачи канала вернутся в очередь вместе с его закрытием
+			return errors.New("результат подзадачи не доставлен, consumer перезапускается")
+		}
+	}
+	logger.Log("Worker Consumer", "Канал 'tasks' закрыт")
+	return nil
+}
 
-			var taskMsg models.TaskMessage
-			if err := json.Unmarshal(delivery.Body, &taskMsg); err != nil {
-				logger.Log("Worker Consumer", "Ошибка декодирования сообщения: "+err.Error())
-				delivery.Ack(false)
-				return
-			}
-			processor.ProcessTask(ch, taskMsg)
-			delivery.Ack(false)
-		}(d)
+// handle обрабатывает одну подзадачу и возвращает false, если её результат не удалось доставить.
+func handle(delivery amqp.Delivery, results *amqputil.ConfirmPublisher, cfg *config.Config, registry *control.Registry, batchHashes *batch.Hashes) bool {
+	var taskMsg models.TaskMessage
+	if err := json.Unmarshal(delivery.Body, &taskMsg); err != nil {
+		logger.Log("Worker Consumer", "Ошибка декодирования сообщения: "+err.Error())
+		amqputil.Reject(results, delivery, constants.TasksQueue, "Worker Consumer", "invalid JSON: "+err.Error())
+		return true
+	}
+	if processed.seen(taskMsg.IdempotencyKey) {
+		logger.LogTask("Worker Consumer", taskMsg.Hash, taskMsg.SubTaskNumber, taskMsg.SubTaskCount,
+			"Результат подзадачи уже отправлен, повтор "+taskMsg.IdempotencyKey+" пропущен")
+		delivery.Ack(false)
+		return true
 	}
+	ctx, done := registry.Start(taskMsg.RequestId)
+	err := processor.ProcessTask(ctx, results, batchHashes, taskMsg, cfg.Threads)
+	done()
+	switch {
+	case err == nil:
+		processed.add(taskMsg.IdempotencyKey)
+		delivery.Ack(false)
+	case errors.Is(err, processor.ErrInvalidTask):
+		amqputil.Reject(results, delivery, constants.TasksQueue, "Worker Consumer", err.Error())
+	case errors.Is(err, processor.ErrTransient):
+		amqputil.Retry(results, delivery, constants.TasksQueue, "Worker Consumer", err.Error())
+	default:
+		delivery.Nack(false, true)
+		return false
+	}
+	return true
+}
 
-	wg.Wait()
-	logger.Log("Worker Consumer", "Канал 'tasks' закрыт")
+// ListenControl подписывается на обменник "control" на канале ch и передаёт сигналы отмены в registry,
+// пока канал не закроется.
+func ListenControl(ch *amqp.Channel, registry *control.Registry) error {
+	controlMsgs, err := amqputil.ConsumeControl(ch)
+	if err != nil {
+		logger.Log("Worker Consumer", "Ошибка подписки на управляющие сообщения: "+err.Error())
+		return err
+	}
+	registry.Listen(controlMsgs)
 	return nil
 }
@@ -0,0 +1,50 @@
+package consumer
+
+import (
+	"sync"
+	"time"
+
+	"common/constants"
+)
+
+// processedKeys помнит ключи идемпотентности подзадач, результат которых уже подтверждён брокером.
+// Повторно доставленное сообщение с таким ключом (менеджер отправил его снова после сбоя) подтверждается
+// без повторного перебора. Ключи хранятся constants.ProcessedKeyTTL и только в памяти воркера.
+type processedKeys struct {
+	mu   sync.Mutex
+	keys map[string]time.Time // ключ -> момент подтверждения результата
+}
+
+// processed живёт дольше одного вызова Consume: повторы чаще всего приходят после переподключения.
+var processed = newProcessedKeys()
+
+func newProcessedKeys() *processedKeys {
+	return &processedKeys{keys: make(map[string]time.Time)}
+}
+
+// seen сообщает, что результат подзадачи с ключом key уже отправлен. Пустой ключ (старый менеджер) не запоминается.
+func (p *processedKeys) seen(key string) bool {
+	if key == "" {
+		return false
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	at, ok := p.keys[key]
+	return ok && time.Since(at) <= constants.ProcessedKeyTTL
+}
+
+// add запоминает ключ подзадачи, результат которой подтверждён, и забывает устаревшие ключи.
+func (p *processedKeys) add(key string) {
+	if key == "" {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := time.Now()
+	for k, at := range p.keys {
+		if now.Sub(at) > constants.ProcessedKeyTTL {
+			delete(p.keys, k)
+		}
+	}
+	p.keys[key] = now
+}
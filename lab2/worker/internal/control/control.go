@@ -0,0 +1,103 @@
+package control
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"common/constants"
+	"common/logger"
+	"common/models"
+
+	"github.com/streadway/amqp"
+)
+
+// Registry хранит функции отмены подзадач, которые воркер перебирает сейчас,
+// и помнит недавно отменённые и решённые задачи, чтобы не начинать их подзадачи, оставшиеся в очереди.
+type Registry struct {
+	mu        sync.Mutex
+	nextID    uint64
+	running   map[string]map[uint64]context.CancelFunc // requestId -> подзадачи в работе
+	cancelled map[string]time.Time                     // requestId -> момент отмены или нахождения пароля
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		running:   make(map[string]map[uint64]context.CancelFunc),
+		cancelled: make(map[string]time.Time),
+	}
+}
+
+// Start регистрирует подзадачу задачи requestId и возвращает контекст, который отменяется вместе с задачей.
+// Если задача уже отменена, контекст возвращается отменённым. done нужно вызвать по окончании подзадачи.
+func (r *Registry) Start(requestId string) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.cancelled[requestId]; ok {
+		cancel()
+		return ctx, func() {}
+	}
+	r.nextID++
+	id := r.nextID
+	if r.running[requestId] == nil {
+		r.running[requestId] = make(map[uint64]context.CancelFunc)
+	}
+	r.running[requestId][id] = cancel
+
+	return ctx, func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		delete(r.running[requestId], id)
+		if len(r.running[requestId]) == 0 {
+			delete(r.running, requestId)
+		}
+		cancel()
+	}
+}
+
+// Cancel прерывает все подзадачи задачи requestId и возвращает их количество.
+// Вызывается и при отмене задачи, и когда пароль найден: в обоих случаях остальные подзадачи не нужны.
+func (r *Registry) Cancel(requestId string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	for id, at := range r.cancelled {
+		if now.Sub(at) > constants.CancelledTaskTTL {
+			delete(r.cancelled, id)
+		}
+	}
+	r.cancelled[requestId] = now
+
+	for _, cancel := range r.running[requestId] {
+		cancel()
+	}
+	return len(r.running[requestId])
+}
+
+// Listen обрабатывает управляющие сообщения из обменника "control", пока канал доставки не закроется.
+func (r *Registry) Listen(msgs <-chan amqp.Delivery) {
+	for d := range msgs {
+		var msg models.ControlMessage
+		if err := json.Unmarshal(d.Body, &msg); err != nil {
+			logger.Log("Worker Control", "Ошибка декодирования управляющего сообщения: "+err.Error())
+			continue
+		}
+		switch msg.Type {
+		case constants.ControlCancel:
+			count := r.Cancel(msg.RequestId)
+			logger.LogHash("Worker Control", msg.Hash,
+				fmt.Sprintf("Задача %s отменена, прервано подзадач: %d", msg.RequestId, count))
+		case constants.ControlSolved:
+			count := r.Cancel(msg.RequestId)
+			logger.LogHash("Worker Control", msg.Hash,
+				fmt.Sprintf("Пароль задачи %s уже найден, прервано подзадач: %d", msg.RequestId, count))
+		default:
+			logger.Log("Worker Control", "Неизвестное управляющее сообщение: "+msg.Type)
+		}
+	}
+}
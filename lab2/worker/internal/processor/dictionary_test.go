@@ -0,0 +1,72 @@
+package processor
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"common/models"
+)
+
+func md5Hex(word string) string {
+	sum := md5.Sum([]byte(word))
+	return hex.EncodeToString(sum[:])
+}
+
+// TestSearchDictionary проверяет, что слова, разданные нескольким горутинам, проверяются все и только из диапазона подзадачи.
+func TestSearchDictionary(t *testing.T) {
+	dir := t.TempDir()
+	var words strings.Builder
+	for i := 0; i < 5000; i++ {
+		fmt.Fprintf(&words, "w%d\n", i)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "words.txt"), []byte(words.String()), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "caps.rule"), []byte(":\nc $!\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("WORDLIST_DIR", dir)
+	t.Setenv("RULES_DIR", dir)
+
+	tests := []struct {
+		name      string
+		hashes    []string
+		lineCount int
+		rules     string
+		threads   int
+		want      []string
+	}{
+		{name: "single thread", hashes: []string{md5Hex("w4999")}, lineCount: 5000, threads: 1, want: []string{"w4999"}},
+		{name: "last word", hashes: []string{md5Hex("w4999")}, lineCount: 5000, threads: 4, want: []string{"w4999"}},
+		{name: "outside range", hashes: []string{md5Hex("w4999")}, lineCount: 4999, threads: 4, want: []string{""}},
+		{name: "batch", hashes: []string{md5Hex("w1"), md5Hex("w3000"), md5Hex("missing")}, lineCount: 5000, threads: 3, want: []string{"w1", "w3000", ""}},
+		{name: "rules", hashes: []string{md5Hex("W2048!")}, lineCount: 5000, rules: "caps.rule", threads: 4, want: []string{"W2048!"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			targets, err := newTargetSet(tt.hashes)
+			if err != nil {
+				t.Fatal(err)
+			}
+			msg := models.TaskMessage{Wordlist: "words.txt", Rules: tt.rules, LineCount: tt.lineCount}
+			if err := searchDictionary(context.Background(), msg, targets, tt.threads); err != nil {
+				t.Fatal(err)
+			}
+			found := make(map[string]string)
+			for _, match := range targets.matches() {
+				found[match.Hash] = match.Result
+			}
+			for i, hash := range tt.hashes {
+				if found[hash] != tt.want[i] {
+					t.Fatalf("password for %s = %q, want %q", hash, found[hash], tt.want[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package processor
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"common/amqputil"
+	"common/constants"
+	"common/logger"
+	"common/models"
+
+	"github.com/streadway/amqp"
+)
+
+// startHeartbeat сообщает менеджеру, что воркер получил подзадачу msg и перебирает её, и повторяет сообщение
+// каждые constants.HeartbeatInterval, пока не вызвана возвращённая функция остановки. Аренда подзадачи
+// в менеджере отсчитывается от последнего heartbeat. Ошибка отправки только записывается в журнал:
+// следующий heartbeat продлит аренду, а сообщения старых менеджеров без ключа идемпотентности heartbeat не получают.
+func startHeartbeat(results *amqputil.ConfirmPublisher, msg models.TaskMessage) (stop func()) {
+	if msg.IdempotencyKey == "" {
+		return func() {}
+	}
+	sendHeartbeat(results, msg)
+
+	quit := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(constants.HeartbeatInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-quit:
+				return
+			case <-ticker.C:
+				sendHeartbeat(results, msg)
+			}
+		}
+	}()
+	return func() {
+		close(quit)
+		<-done
+	}
+}
+
+// sendHeartbeat публикует heartbeat подзадачи msg в очередь "results".
+func sendHeartbeat(results *amqputil.ConfirmPublisher, msg models.TaskMessage) {
+	data, err := json.Marshal(models.ResultMessage{
+		IdempotencyKey: msg.IdempotencyKey,
+		RequestId:      msg.RequestId,
+		Hash:           msg.Hash,
+		SubTaskNumber:  msg.SubTaskNumber,
+		Heartbeat:      true,
+	})
+	if err == nil {
+		err = results.Publish("", constants.ResultsQueue, amqp.Publishing{
+			ContentType:  "application/json",
+			Body:         data,
+			DeliveryMode: amqp.Persistent,
+		})
+	}
+	if err != nil {
+		logger.LogTask("Processor", msg.Hash, msg.SubTaskNumber, msg.SubTaskCount,
+			fmt.Sprintf("Ошибка отправки heartbeat: %v", err))
+	}
+}
@@ -1,84 +1,282 @@
 package processor
 
 import (
-	"crypto/md5"
-	"encoding/hex"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"math"
-	"strings"
+	"sync"
 
+	"common/amqputil"
 	"common/constants"
+	"common/keyspace"
 	"common/logger"
+	"common/mask"
 	"common/models"
+	"common/rules"
+	"common/wordlist"
+	"worker/internal/batch"
 
 	"github.com/streadway/amqp"
 )
 
-// NumberToCandidate преобразует число в строку в системе счисления с основанием constants.AlphabetSize.
-func NumberToCandidate(n int, length int) string {
-	base := constants.AlphabetSize
-	var candidateBuilder strings.Builder
-	for i := 0; i < length; i++ {
-		candidateBuilder.WriteByte(constants.Alphabet[n%base])
-		n /= base
+// dictionaryBatch - сколько слов словаря горутина перебора получает за раз; между пакетами проверяется отмена задачи.
+const dictionaryBatch = 1024
+
+var (
+	// ErrInvalidTask - подзадачу невозможно обработать ни на одном воркере (некорректные хеши, маска или диапазон).
+	ErrInvalidTask = errors.New("invalid subtask")
+	// ErrTransient - подзадачу не удалось обработать сейчас, но может получиться позже или на другом воркере
+	// (например, словарь не читается).
+	ErrTransient = errors.New("transient failure")
+)
+
+// ProcessTask перебирает пространство поиска для данной подзадачи, проверяет каждого кандидата на соответствие хешу
+// (для пакетной задачи - всем хешам списка, который batchHashes получает у менеджера) и публикует результат.
+// Диапазон перебора по алфавиту и по маске и слова диапазона словаря делятся между threads горутинами.
+// При отмене ctx (задачу отменили или пароль уже найден другой подзадачей) перебор прерывается, а результат не публикуется.
+// Пока подзадача перебирается, в очередь "results" отправляются heartbeat (см. startHeartbeat).
+// Результат публикуется персистентным сообщением с ожиданием подтверждения брокера. Ошибка означает, что результат
+// не отправлен: ErrInvalidTask - подзадачу нужно отклонить, ErrTransient - повторить, иначе результат не удалось
+// доставить, и подзадачу нужно вернуть в очередь, а не подтверждать.
+func ProcessTask(ctx context.Context, results *amqputil.ConfirmPublisher, batchHashes *batch.Hashes, msg models.TaskMessage, threads int) error {
+	if ctx.Err() != nil {
+		logger.LogTask("Processor", msg.Hash, msg.SubTaskNumber, msg.SubTaskCount, "Задача отменена или уже решена, подзадача пропущена")
+		return nil
 	}
-	// Переворачиваем строку
-	runes := []rune(candidateBuilder.String())
-	for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
-		runes[i], runes[j] = runes[j], runes[i]
+	logger.LogTask("Processor", msg.Hash, msg.SubTaskNumber, msg.SubTaskCount, "Начало обработки задачи")
+
+	// Обычная задача передаёт один хеш, список хешей пакетной задачи запрашивается у менеджера
+	hashes := []string{msg.Hash}
+	if msg.Batch {
+		var err error
+		if hashes, err = batchTargets(ctx, batchHashes, msg); err != nil {
+			if ctx.Err() != nil {
+				logger.LogTask("Processor", msg.Hash, msg.SubTaskNumber, msg.SubTaskCount, "Задача отменена или уже решена, подзадача пропущена")
+				return nil
+			}
+			return err
+		}
+		if len(hashes) == 0 {
+			logger.LogTask("Processor", msg.Hash, msg.SubTaskNumber, msg.SubTaskCount, "Пароли всех хешей задачи уже найдены, подзадача пропущена")
+			return nil
+		}
+	}
+	targets, err := newTargetSet(hashes)
+	if err != nil {
+		logger.LogTask("Processor", msg.Hash, msg.SubTaskNumber, msg.SubTaskCount,
+			fmt.Sprintf("Некорректные хеши подзадачи: %v", err))
+		return fmt.Errorf("%w: hashes: %v", ErrInvalidTask, err)
 	}
-	return string(runes)
-}
 
-// ProcessTask перебирает пространство поиска для данной подзадачи, проверяет каждого кандидата на соответствие хешу и публикует результат.
-func ProcessTask(ch *amqp.Channel, msg models.TaskMessage) {
-	logger.LogTask("Processor", msg.Hash, msg.SubTaskNumber, msg.SubTaskCount, "Начало обработки задачи")
-	found := ""
-	totalCandidates := int(math.Pow(float64(constants.AlphabetSize), float64(msg.MaxLength)))
-
-	// Перебираем часть пространства поиска, назначенную этой подзадаче
-	for i := msg.SubTaskNumber - 1; i < totalCandidates; i += msg.SubTaskCount {
-		candidate := NumberToCandidate(i, msg.MaxLength)
-		sum := md5.Sum([]byte(candidate))
-		if hex.EncodeToString(sum[:]) == msg.Hash {
-			found = candidate
-			break
+	// Аренда подзадачи в менеджере начинается с получения подзадачи воркером и продлевается, пока идёт перебор
+	stopHeartbeat := startHeartbeat(results, msg)
+	defer stopHeartbeat()
+
+	switch msg.Mode {
+	case constants.ModeDictionary:
+		err = searchDictionary(ctx, msg, targets, threads)
+		if err != nil {
+			// Результат не отправляем: непрочитанный диапазон не должен считаться проверенным
+			logger.LogTask("Processor", msg.Hash, msg.SubTaskNumber, msg.SubTaskCount,
+				fmt.Sprintf("Ошибка чтения словаря %s: %v", msg.Wordlist, err))
+			return fmt.Errorf("%w: wordlist %s: %v", ErrTransient, msg.Wordlist, err)
+		}
+	case constants.ModeMask:
+		err = searchMask(ctx, msg, targets, threads)
+		if err != nil {
+			logger.LogTask("Processor", msg.Hash, msg.SubTaskNumber, msg.SubTaskCount,
+				fmt.Sprintf("Некорректная подзадача по маске %s: %v", msg.Mask, err))
+			return fmt.Errorf("%w: mask %s: %v", ErrInvalidTask, msg.Mask, err)
+		}
+	default:
+		err = searchBruteForce(ctx, msg, targets, threads)
+		if err != nil {
+			logger.LogTask("Processor", msg.Hash, msg.SubTaskNumber, msg.SubTaskCount,
+				fmt.Sprintf("Некорректная подзадача перебора: %v", err))
+			return fmt.Errorf("%w: %v", ErrInvalidTask, err)
 		}
 	}
 
-	if found != "" {
-		logger.LogTask("Processor", msg.Hash, msg.SubTaskNumber, msg.SubTaskCount, "Найден пароль: "+found)
-	} else {
-		logger.LogTask("Processor", msg.Hash, msg.SubTaskNumber, msg.SubTaskCount, "Пароль не найден в данной подзадаче")
+	if !targets.complete() && ctx.Err() != nil {
+		// Диапазон проверен не полностью, поэтому результат не отправляем
+		logger.LogTask("Processor", msg.Hash, msg.SubTaskNumber, msg.SubTaskCount, "Подзадача прервана: задача отменена или уже решена")
+		return nil
 	}
 
 	resMsg := models.ResultMessage{
-		Hash:          msg.Hash,
-		SubTaskNumber: msg.SubTaskNumber,
-		Result:        found,
+		IdempotencyKey: msg.IdempotencyKey,
+		RequestId:      msg.RequestId,
+		Hash:           msg.Hash,
+		SubTaskNumber:  msg.SubTaskNumber,
 	}
+	if msg.Batch {
+		resMsg.Matches = targets.matches()
+		logger.LogTask("Processor", msg.Hash, msg.SubTaskNumber, msg.SubTaskCount,
+			fmt.Sprintf("Найдено паролей: %d из %d", len(resMsg.Matches), len(hashes)))
+	} else if resMsg.Result = targets.password(); resMsg.Result != "" {
+		logger.LogTask("Processor", msg.Hash, msg.SubTaskNumber, msg.SubTaskCount, "Найден пароль: "+resMsg.Result)
+	} else {
+		logger.LogTask("Processor", msg.Hash, msg.SubTaskNumber, msg.SubTaskCount, "Пароль не найден в данной подзадаче")
+	}
+
 	data, err := json.Marshal(resMsg)
 	if err != nil {
 		logger.LogTask("Processor", msg.Hash, msg.SubTaskNumber, msg.SubTaskCount,
 			fmt.Sprintf("Ошибка маршалинга результата: %v", err))
-		return
-	}
-
-	err = ch.Publish(
-		"",
-		constants.ResultsQueue,
-		false,
-		false,
-		amqp.Publishing{
-			ContentType: "application/json",
-			Body:        data,
-		},
-	)
+		return nil
+	}
+
+	err = results.Publish("", constants.ResultsQueue, amqp.Publishing{
+		ContentType:  "application/json",
+		Body:         data,
+		DeliveryMode: amqp.Persistent,
+		MessageId:    msg.IdempotencyKey,
+	})
 	if err != nil {
 		logger.LogTask("Processor", msg.Hash, msg.SubTaskNumber, msg.SubTaskCount,
 			fmt.Sprintf("Ошибка публикации результата: %v", err))
-		return
+		return err
 	}
 	logger.LogTask("Processor", msg.Hash, msg.SubTaskNumber, msg.SubTaskCount, "Результат отправлен в очередь 'results'")
+	return nil
+}
+
+// batchTargets получает хеши пакетной задачи у менеджера через batchHashes.
+// Задача, которую менеджер не знает, отклоняется, остальные ошибки запроса временные.
+func batchTargets(ctx context.Context, batchHashes *batch.Hashes, msg models.TaskMessage) ([]string, error) {
+	hashes, err := batchHashes.Get(ctx, msg.RequestId)
+	if err == nil {
+		return hashes, nil
+	}
+	logger.LogTask("Processor", msg.Hash, msg.SubTaskNumber, msg.SubTaskCount,
+		fmt.Sprintf("Не удалось получить список хешей задачи: %v", err))
+	if errors.Is(err, batch.ErrNotFound) {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidTask, err)
+	}
+	return nil, fmt.Errorf("%w: batch hashes: %v", ErrTransient, err)
+}
+
+// searchBruteForce перебирает диапазон номеров кандидатов [RangeStart, RangeEnd), назначенный этой подзадаче.
+// Пространство - конкатенация всех длин от MinLength до MaxLength, глобальный номер кандидата
+// переводится в пару (длина, номер внутри длины).
+func searchBruteForce(ctx context.Context, msg models.TaskMessage, targets *targetSet, threads int) error {
+	space := keyspace.Space{
+		Alphabet:  msg.Alphabet,
+		MinLength: msg.MinLength,
+		MaxLength: msg.MaxLength,
+	}
+	if space.Alphabet == "" {
+		space.Alphabet = constants.Alphabet
+	}
+	// Задачи, созданные до появления minLength, перебирали только длину MaxLength
+	if space.MinLength == 0 {
+		space.MinLength = msg.MaxLength
+	}
+	r, err := keyspace.ParseRange(msg.RangeStart, msg.RangeEnd)
+	if err != nil {
+		return err
+	}
+	if err := keyspace.CheckBounds(space, r); err != nil {
+		return err
+	}
+	searchRange(ctx, space, r, targets, threads)
+	return nil
+}
+
+// searchMask перебирает диапазон номеров кандидатов маски, назначенный этой подзадаче.
+// Номер кандидата переводится в строку через смешанную систему счисления маски.
+func searchMask(ctx context.Context, msg models.TaskMessage, targets *targetSet, threads int) error {
+	m, err := mask.Parse(msg.Mask, msg.Charsets)
+	if err != nil {
+		return err
+	}
+	r, err := keyspace.ParseRange(msg.RangeStart, msg.RangeEnd)
+	if err != nil {
+		return err
+	}
+	if err := keyspace.CheckBounds(m, r); err != nil {
+		return err
+	}
+	searchRange(ctx, m, r, targets, threads)
+	return nil
+}
+
+// searchRange проверяет кандидатов диапазона r в threads горутинах и записывает совпавшие с targets.
+// Кандидаты получаются инкрементом итератора в переиспользуемом буфере, строка создаётся только для найденных.
+// Перебор прекращается, когда найдены все хеши набора, или при отмене ctx.
+func searchRange(ctx context.Context, space keyspace.Enumerable, r keyspace.Range, targets *targetSet, threads int) {
+	keyspace.Search(ctx, space, r, threads, targets.matcher)
+}
+
+// searchDictionary проверяет слова из назначенного подзадаче диапазона строк словаря в threads горутинах:
+// словарь читается последовательно, и пакеты слов раздаются горутинам, у каждой из которых свой хешер.
+// Если задан набор правил, проверяются все мутации каждого слова. Чтение прекращается, когда найдены все хеши
+// набора, или при отмене ctx.
+func searchDictionary(ctx context.Context, msg models.TaskMessage, targets *targetSet, threads int) error {
+	path, err := wordlist.Path(wordlist.Dir(), msg.Wordlist)
+	if err != nil {
+		return err
+	}
+	var ruleSet *rules.Set
+	if msg.Rules != "" {
+		if ruleSet, err = rules.Load(msg.Rules); err != nil {
+			return fmt.Errorf("набор правил %s: %w", msg.Rules, err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	batches := make(chan []string, threads)
+	var wg sync.WaitGroup
+	for i := 0; i < max(threads, 1); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			match := targets.matcher()
+			check := func(candidate string) bool {
+				if match([]byte(candidate)) {
+					cancel()
+					return false
+				}
+				return true
+			}
+			// После остановки пакеты только вычитываются, чтобы чтение словаря не блокировалось
+			for batch := range batches {
+				for _, word := range batch {
+					if ctx.Err() != nil {
+						break
+					}
+					if ruleSet != nil {
+						ruleSet.Expand(word, check)
+					} else {
+						check(word)
+					}
+				}
+			}
+		}()
+	}
+
+	batch := make([]string, 0, dictionaryBatch)
+	send := func() bool {
+		select {
+		case batches <- batch:
+			batch = make([]string, 0, dictionaryBatch)
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+	err = wordlist.ReadChunk(path, msg.WordOffset, msg.LineCount, func(word string) bool {
+		if batch = append(batch, word); len(batch) < dictionaryBatch {
+			return true
+		}
+		return send()
+	})
+	if err == nil && len(batch) > 0 {
+		send()
+	}
+	close(batches)
+	wg.Wait()
+	return err
 }
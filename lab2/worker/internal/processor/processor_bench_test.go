@@ -0,0 +1,141 @@
+package processor
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"math/big"
+	"runtime"
+	"testing"
+
+	"common/constants"
+	"common/keyspace"
+	"common/mask"
+)
+
+// Хеш, которого нет в перебираемых диапазонах: бенчмарки проходят диапазон целиком.
+const benchHash = "ffffffffffffffffffffffffffffffff"
+
+type benchSpace struct {
+	name  string
+	space keyspace.Enumerable
+}
+
+// benchSpaces - пространства, на которых сравниваются генераторы кандидатов.
+func benchSpaces(b *testing.B) []benchSpace {
+	m, err := mask.Parse("?u?l?l?l?l?d?d?s", nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+	return []benchSpace{
+		{"alphabet", keyspace.Space{Alphabet: constants.Alphabet, MinLength: 1, MaxLength: 7}},
+		{"mask", m},
+	}
+}
+
+// benchRange возвращает диапазон из n кандидатов в середине пространства.
+func benchRange(space keyspace.Enumerable, n int) keyspace.Range {
+	start := new(big.Int).Rsh(space.SizeBig(), 1)
+	return keyspace.Range{Start: start, End: new(big.Int).Add(start, big.NewInt(int64(n)))}
+}
+
+func reportHashRate(b *testing.B) {
+	b.ReportMetric(float64(b.N)/b.Elapsed().Seconds(), "hashes/s")
+}
+
+// BenchmarkLegacyDecode - прежняя схема: каждый кандидат заново вычисляется делением из номера,
+// превращается в строку, а дайджест кодируется в hex перед сравнением строк.
+func BenchmarkLegacyDecode(b *testing.B) {
+	for _, bs := range benchSpaces(b) {
+		candidate := bs.space.(interface {
+			Candidate(index uint64, buf []byte) []byte
+		})
+		b.Run(bs.name, func(b *testing.B) {
+			start := benchRange(bs.space, 0).Start.Uint64()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				word := string(candidate.Candidate(start+uint64(i), nil))
+				sum := md5.Sum([]byte(word))
+				if hex.EncodeToString(sum[:]) == benchHash {
+					b.Fatal("unexpected match")
+				}
+			}
+			reportHashRate(b)
+		})
+	}
+}
+
+// BenchmarkIterator - инкрементальный итератор с переиспользуемым буфером и сравнением сырых дайджестов.
+func BenchmarkIterator(b *testing.B) {
+	targets, err := newTargetSet([]string{benchHash})
+	if err != nil {
+		b.Fatal(err)
+	}
+	for _, bs := range benchSpaces(b) {
+		b.Run(bs.name, func(b *testing.B) {
+			r := benchRange(bs.space, b.N)
+			b.ResetTimer()
+			if searchRange(context.Background(), bs.space, r, targets, 1); targets.password() != "" {
+				b.Fatal("unexpected match")
+			}
+			reportHashRate(b)
+		})
+	}
+}
+
+// BenchmarkIteratorParallel - итератор, когда диапазон делится между GOMAXPROCS горутинами.
+func BenchmarkIteratorParallel(b *testing.B) {
+	targets, err := newTargetSet([]string{benchHash})
+	if err != nil {
+		b.Fatal(err)
+	}
+	for _, bs := range benchSpaces(b) {
+		b.Run(bs.name, func(b *testing.B) {
+			r := benchRange(bs.space, b.N)
+			b.ResetTimer()
+			if searchRange(context.Background(), bs.space, r, targets, runtime.GOMAXPROCS(0)); targets.password() != "" {
+				b.Fatal("unexpected match")
+			}
+			reportHashRate(b)
+		})
+	}
+}
+
+// BenchmarkIteratorBig - тот же перебор в пространстве, номера которого не помещаются в uint64:
+// big.Int используется только для установки итератора на начало диапазона.
+func BenchmarkIteratorBig(b *testing.B) {
+	targets, err := newTargetSet([]string{benchHash})
+	if err != nil {
+		b.Fatal(err)
+	}
+	space := keyspace.Space{Alphabet: mask.All, MinLength: 1, MaxLength: 12}
+	r := benchRange(space, b.N)
+	b.ResetTimer()
+	if searchRange(context.Background(), space, r, targets, 1); targets.password() != "" {
+		b.Fatal("unexpected match")
+	}
+	reportHashRate(b)
+}
+
+// BenchmarkIteratorBatch - пакетная задача: каждый кандидат ищется в наборе из 10 000 дайджестов.
+func BenchmarkIteratorBatch(b *testing.B) {
+	hashes := make([]string, 10_000)
+	for i := range hashes {
+		sum := md5.Sum([]byte{'#', byte(i >> 8), byte(i)})
+		hashes[i] = hex.EncodeToString(sum[:])
+	}
+	targets, err := newTargetSet(hashes)
+	if err != nil {
+		b.Fatal(err)
+	}
+	for _, bs := range benchSpaces(b) {
+		b.Run(bs.name, func(b *testing.B) {
+			r := benchRange(bs.space, b.N)
+			b.ResetTimer()
+			if searchRange(context.Background(), bs.space, r, targets, 1); len(targets.matches()) != 0 {
+				b.Fatal("unexpected match")
+			}
+			reportHashRate(b)
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package processor
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"sync"
+
+	"common/models"
+)
+
+// targetSet - искомые дайджесты подзадачи: один хеш обычной задачи или все хеши пакетной.
+// Набор дайджестов после создания только читается, поэтому проверка кандидата не берёт блокировку;
+// она нужна лишь для записи найденных паролей, которые приходят из нескольких горутин.
+type targetSet struct {
+	digests map[[md5.Size]byte]string // дайджест -> hex-хеш в том виде, в каком его прислал менеджер
+	single  [md5.Size]byte            // единственный дайджест: проверяется сравнением массивов без обращения к map
+
+	mu    sync.Mutex
+	found map[[md5.Size]byte]string // дайджест -> найденный пароль
+}
+
+// newTargetSet разбирает hex-хеши подзадачи.
+func newTargetSet(hashes []string) (*targetSet, error) {
+	t := &targetSet{
+		digests: make(map[[md5.Size]byte]string, len(hashes)),
+		found:   make(map[[md5.Size]byte]string),
+	}
+	for _, hash := range hashes {
+		var digest [md5.Size]byte
+		decoded, err := hex.DecodeString(hash)
+		if err != nil || len(decoded) != md5.Size {
+			return nil, fmt.Errorf("некорректный MD5-хеш %q", hash)
+		}
+		copy(digest[:], decoded)
+		t.digests[digest] = hash
+		t.single = digest
+	}
+	if len(t.digests) == 0 {
+		return nil, fmt.Errorf("не задан ни один хеш")
+	}
+	return t, nil
+}
+
+// matcher возвращает функцию проверки кандидата для одной горутины перебора.
+// Функция возвращает true, когда найдены пароли для всех хешей набора и перебор можно прекратить.
+func (t *targetSet) matcher() func(candidate []byte) bool {
+	if len(t.digests) == 1 {
+		target := t.single
+		return func(candidate []byte) bool {
+			return md5.Sum(candidate) == target && t.record(target, candidate)
+		}
+	}
+	return func(candidate []byte) bool {
+		sum := md5.Sum(candidate)
+		if _, ok := t.digests[sum]; !ok {
+			return false
+		}
+		return t.record(sum, candidate)
+	}
+}
+
+// record запоминает пароль для дайджеста (первый найденный) и сообщает, найдены ли все хеши.
+// Кандидат копируется: буфер итератора переиспользуется.
+func (t *targetSet) record(digest [md5.Size]byte, candidate []byte) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.found[digest]; !ok {
+		t.found[digest] = string(candidate)
+	}
+	return len(t.found) == len(t.digests)
+}
+
+// complete сообщает, найдены ли пароли для всех хешей набора.
+func (t *targetSet) complete() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.found) == len(t.digests)
+}
+
+// password возвращает пароль единственного хеша обычной задачи или пустую строку.
+func (t *targetSet) password() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.found[t.single]
+}
+
+// matches возвращает все найденные пары хеш-пароль пакетной задачи.
+func (t *targetSet) matches() []models.HashMatch {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	matches := make([]models.HashMatch, 0, len(t.found))
+	for digest, password := range t.found {
+		matches = append(matches, models.HashMatch{Hash: t.digests[digest], Result: password})
+	}
+	return matches
+}